@@ -1,6 +1,6 @@
 module github.com/Huangkai1008/libradb
 
-go 1.22.3
+go 1.23
 
 require (
 	github.com/emirpasic/gods/v2 v2.0.0-alpha
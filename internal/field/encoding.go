@@ -0,0 +1,96 @@
+package field
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	// nullMarker sorts NULL before every other value.
+	nullMarker    byte = 0x00
+	notNullMarker byte = 0x01
+
+	// The bytes of variable-length values are escaped, 0x00 is written as 0x00 0xFF,
+	// and the value ends with 0x00 0x01, so no encoding is a prefix of another.
+	escapeByte     byte = 0x00
+	escapedByte    byte = 0xFF
+	terminatorByte byte = 0x01
+
+	signBit = 1 << 31
+)
+
+// EncodeKey returns the memcomparable encoding of the value.
+//
+// The encoding preserves the order of the values,
+// comparing the encodings of two values with bytes.Compare
+// gives the same result as comparing the values themselves,
+// except that floats are totally ordered (-0 sorts before +0).
+// NULL sorts before every other value.
+func EncodeKey(v Value) []byte {
+	return AppendKey(nil, v, ASC)
+}
+
+// AppendKey appends the memcomparable encoding of the value sorted in the order to dst.
+//
+// The encoding of a DESC value is the bitwise inversion of the ASC one.
+func AppendKey(dst []byte, v Value, order SortOrder) []byte {
+	start := len(dst)
+	dst = appendKey(dst, v)
+	if order == DESC {
+		for i := start; i < len(dst); i++ {
+			dst[i] = ^dst[i]
+		}
+	}
+	return dst
+}
+
+func appendKey(dst []byte, v Value) []byte {
+	if IsNull(v) {
+		return append(dst, nullMarker)
+	}
+
+	dst = append(dst, notNullMarker)
+	switch v := v.(type) {
+	case IntegerValue:
+		// Flip the sign bit so that negative integers sort before positive ones.
+		return binary.BigEndian.AppendUint32(dst, uint32(v.val)^signBit)
+	case FloatValue:
+		// Flip the sign bit of positive floats, and every bit of negative floats,
+		// since the larger the magnitude of a negative float, the smaller it is.
+		bits := math.Float32bits(v.val)
+		if bits&signBit != 0 {
+			bits = ^bits
+		} else {
+			bits |= signBit
+		}
+		return binary.BigEndian.AppendUint32(dst, bits)
+	case BooleanValue:
+		if v.val {
+			return append(dst, 1)
+		}
+		return append(dst, 0)
+	case VarcharValue:
+		return appendEscaped(dst, []byte(v.val))
+	case BinaryValue:
+		return appendEscaped(dst, v.val)
+	case TupleValue:
+		for i, elem := range v.val {
+			dst = AppendKey(dst, elem, v.t.Order(i))
+		}
+		return dst
+	default:
+		panic(fmt.Sprintf("unsupported type: %T", v))
+	}
+}
+
+func appendEscaped(dst []byte, b []byte) []byte {
+	for _, c := range b {
+		if c == escapeByte {
+			dst = append(dst, escapeByte, escapedByte)
+		} else {
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, escapeByte, terminatorByte)
+}
@@ -0,0 +1,175 @@
+package field_test
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/util"
+)
+
+// assertOrderPreserved asserts that the encodings of the values compare the same way as the values do.
+func assertOrderPreserved(t *testing.T, values []field.Value) {
+	t.Helper()
+	for _, v1 := range values {
+		for _, v2 := range values {
+			expected := v1.Compare(v2)
+			actual := bytes.Compare(field.EncodeKey(v1), field.EncodeKey(v2))
+			assert.Equal(t, expected, actual, "compare %v with %v", v1, v2)
+		}
+	}
+}
+
+func valuesOf(typ field.Type, vals ...any) []field.Value {
+	values := make([]field.Value, len(vals))
+	for i, val := range vals {
+		values[i] = field.NewValue(typ, val)
+	}
+	return values
+}
+
+func TestEncodeKey(t *testing.T) {
+	t.Run("should preserve the order of integers", func(t *testing.T) {
+		assertOrderPreserved(t, valuesOf(field.NewInteger(),
+			math.MinInt32, -1000, -256, -1, 0, 1, 255, 256, 1000, math.MaxInt32,
+		))
+	})
+
+	t.Run("should preserve the order of floats", func(t *testing.T) {
+		assertOrderPreserved(t, valuesOf(field.NewFloat(),
+			math.Inf(-1), -math.MaxFloat32, -1.5, -1.0, -math.SmallestNonzeroFloat32,
+			0.0, math.SmallestNonzeroFloat32, 0.5, 1.0, 2.25, math.MaxFloat32, math.Inf(1),
+		))
+	})
+
+	t.Run("should order negative zero before positive zero", func(t *testing.T) {
+		negativeZero := field.EncodeKey(field.NewValue(field.NewFloat(), math.Copysign(0, -1)))
+		positiveZero := field.EncodeKey(field.NewValue(field.NewFloat(), 0.0))
+
+		assert.Equal(t, -1, bytes.Compare(negativeZero, positiveZero))
+	})
+
+	t.Run("should preserve the order of booleans", func(t *testing.T) {
+		assertOrderPreserved(t, valuesOf(field.NewBoolean(), false, true))
+	})
+
+	t.Run("should preserve the order of varchars", func(t *testing.T) {
+		assertOrderPreserved(t, valuesOf(field.NewVarchar(),
+			"", "\x00", "\x00\x00", "\x00\x01", "\x01", "a", "a\x00", "a\x00b", "a\x01", "ab", "abc", "b", "\xff",
+		))
+	})
+
+	t.Run("should preserve the order of binaries", func(t *testing.T) {
+		assertOrderPreserved(t, valuesOf(field.NewBinary(),
+			[]byte{}, []byte{0x00}, []byte{0x00, 0xFF}, []byte{0x01}, []byte{0xFF}, []byte{0xFF, 0x00},
+		))
+	})
+
+	t.Run("should escape zero bytes", func(t *testing.T) {
+		encoded := field.EncodeKey(field.NewValue(field.NewBinary(), []byte{0x61, 0x00, 0x62}))
+
+		assert.Equal(t, []byte{0x01, 0x61, 0x00, 0xFF, 0x62, 0x00, 0x01}, encoded)
+	})
+
+	t.Run("should order NULL first", func(t *testing.T) {
+		null := field.EncodeKey(nil)
+		for _, v := range []field.Value{
+			field.NewValue(field.NewInteger(), math.MinInt32),
+			field.NewValue(field.NewFloat(), math.Inf(-1)),
+			field.NewValue(field.NewBoolean(), false),
+			field.NewValue(field.NewVarchar(), ""),
+		} {
+			assert.Equal(t, -1, bytes.Compare(null, field.EncodeKey(v)))
+		}
+	})
+
+	t.Run("should invert the order of DESC values", func(t *testing.T) {
+		values := valuesOf(field.NewVarchar(), "", "a", "ab", "b")
+		for i := 1; i < len(values); i++ {
+			prev := field.AppendKey(nil, values[i-1], field.DESC)
+			cur := field.AppendKey(nil, values[i], field.DESC)
+			assert.Equal(t, 1, bytes.Compare(prev, cur))
+		}
+		assert.Equal(t, 1, bytes.Compare(field.AppendKey(nil, nil, field.DESC), field.AppendKey(nil, values[0], field.DESC)))
+	})
+
+	t.Run("should preserve the order of tuples", func(t *testing.T) {
+		varchar, integer := field.NewVarchar(), field.NewInteger()
+		typ := field.NewTuple([]field.Type{varchar, integer}, field.WithSortOrders(field.ASC, field.DESC))
+		tuple := func(vals ...any) field.Value {
+			values := make([]field.Value, len(vals))
+			for i, val := range vals {
+				values[i] = field.NewValue([]field.Type{varchar, integer}[i], val)
+			}
+			return field.NewValue(typ, values)
+		}
+
+		assertOrderPreserved(t, []field.Value{
+			tuple(""),
+			tuple("", 1),
+			tuple("", -1),
+			tuple("a"),
+			tuple("a", 100),
+			tuple("a", 0),
+			tuple("a\x00", 5),
+			tuple("ab"),
+			tuple("ab", 3),
+		})
+	})
+}
+
+// encodedKey wraps an encoded key to search it with the util functions.
+type encodedKey []byte
+
+func (k encodedKey) Compare(other encodedKey) int {
+	return bytes.Compare(k, other)
+}
+
+func benchmarkSearch[T interface{ Compare(T) int }](b *testing.B, keys []T) {
+	b.Helper()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		util.InsertIndex(keys[i%len(keys)], keys)
+	}
+}
+
+func BenchmarkKeyCompare(b *testing.B) {
+	const n = 1024
+	varchar, integer := field.NewVarchar(), field.NewInteger()
+	tupleType := field.NewTuple([]field.Type{varchar, integer})
+
+	keysOf := map[string]func(i int) field.Value{
+		"integer": func(i int) field.Value {
+			return field.NewValue(integer, i)
+		},
+		"varchar": func(i int) field.Value {
+			return field.NewValue(varchar, fmt.Sprintf("user-%08d", i))
+		},
+		"tuple": func(i int) field.Value {
+			return field.NewValue(tupleType, []field.Value{
+				field.NewValue(varchar, fmt.Sprintf("user-%04d", i/16)),
+				field.NewValue(integer, i%16),
+			})
+		},
+	}
+
+	for _, name := range []string{"integer", "varchar", "tuple"} {
+		values := make([]field.Value, n)
+		encoded := make([]encodedKey, n)
+		for i := range n {
+			values[i] = keysOf[name](i)
+			encoded[i] = field.EncodeKey(values[i])
+		}
+
+		b.Run(name+"/value", func(b *testing.B) {
+			benchmarkSearch(b, values)
+		})
+		b.Run(name+"/encoded", func(b *testing.B) {
+			benchmarkSearch(b, encoded)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package field
+
+// SortOrder is the direction an element of a tuple is sorted in.
+type SortOrder uint8
+
+const (
+	ASC SortOrder = iota
+	DESC
+)
+
+// Tuple is a composite type made of an ordered list of element types.
+//
+// Tuple values are compared lexicographically element by element,
+// each element is sorted in its own order, so a tuple can serve as a multi-column key.
+type Tuple struct {
+	allowNull bool
+	types     []Type
+	// orders are the sort orders of the elements, all ASC if empty.
+	orders []SortOrder
+}
+
+// WithSortOrders sets the sort order of every element of the tuple.
+func WithSortOrders(orders ...SortOrder) Option[*Tuple] {
+	return func(t *Tuple) {
+		t.orders = orders
+	}
+}
+
+func NewTuple(types []Type, options ...Option[*Tuple]) *Tuple {
+	t := &Tuple{
+		types: types,
+	}
+	applyOptions(t, options...)
+	return t
+}
+
+func (t *Tuple) TypeID() TypeID {
+	return TUPLE
+}
+
+// ByteSize returns the maximum byte size of the tuple,
+// variable-length elements take another 4 bytes to store their length.
+func (t *Tuple) ByteSize() int {
+	byteSize := 0
+	for _, typ := range t.types {
+		byteSize += typ.ByteSize()
+		if IsVarLen(typ) {
+			byteSize += 4 //nolint:mnd // 4 bytes for the length of the element
+		}
+	}
+	return byteSize
+}
+
+func (t *Tuple) Validate() {
+	if len(t.types) == 0 {
+		panic("tuple must have at least 1 element")
+	}
+	if len(t.orders) != 0 && len(t.orders) != len(t.types) {
+		panic("sort orders must match the elements")
+	}
+}
+
+func (t *Tuple) AllowNull() bool {
+	return t.allowNull
+}
+
+func (t *Tuple) setAllowNull(b bool) {
+	t.allowNull = b
+}
+
+// Types returns the element types of the tuple.
+func (t *Tuple) Types() []Type {
+	return t.types
+}
+
+// Order returns the sort order of the i-th element.
+func (t *Tuple) Order(i int) SortOrder {
+	if len(t.orders) == 0 {
+		return ASC
+	}
+	return t.orders[i]
+}
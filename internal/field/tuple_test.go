@@ -0,0 +1,49 @@
+package field_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+)
+
+func TestTuple_New(t *testing.T) {
+	t.Run("should succeed without error", func(t *testing.T) {
+		t.Run("default options", func(t *testing.T) {
+			assert.NotPanics(t, func() {
+				sut := field.NewTuple([]field.Type{field.NewInteger(), field.NewVarchar()})
+				assert.Len(t, sut.Types(), 2)
+			})
+		})
+
+		t.Run("with allow null option", func(t *testing.T) {
+			assert.NotPanics(t,
+				func() {
+					sut := field.NewTuple(
+						[]field.Type{field.NewInteger()},
+						field.WithAllowNull[*field.Tuple](true),
+					)
+					assert.True(t, sut.AllowNull())
+				},
+			)
+		})
+	})
+
+	t.Run("should raise error when no element types", func(t *testing.T) {
+		assert.Panics(t, func() {
+			field.NewTuple(nil)
+		})
+	})
+}
+
+func TestTuple_ByteSize(t *testing.T) {
+	sut := field.NewTuple([]field.Type{
+		field.NewInteger(),
+		field.NewVarchar(field.WithLength(5)),
+		field.NewBoolean(),
+	})
+
+	assert.Equal(t, 4+4+20+1, sut.ByteSize())
+	assert.True(t, field.IsVarLen(sut))
+}
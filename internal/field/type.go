@@ -8,6 +8,7 @@ const (
 	BOOLEAN
 	FLOAT
 	BINARY
+	TUPLE
 )
 
 type Type interface {
@@ -45,7 +46,7 @@ func WithAllowNull[T Nullable](allowNull bool) Option[T] {
 }
 
 func IsVarLen(t Type) bool {
-	return t.TypeID() == VARCHAR || t.TypeID() == BINARY
+	return t.TypeID() == VARCHAR || t.TypeID() == BINARY || t.TypeID() == TUPLE
 }
 
 // Length returns the length of the field.
@@ -37,6 +37,8 @@ func NewValue(t Type, val any) Value {
 		return FloatValue{t: t.(*Float), val: float32(val.(float64))}
 	case BINARY:
 		return BinaryValue{t: t.(*Binary), val: val.([]byte)}
+	case TUPLE:
+		return TupleValue{t: t.(*Tuple), val: val.([]Value)}
 	default:
 		panic("not implemented")
 	}
@@ -81,11 +83,39 @@ func FromBytes(t Type, bytes []byte) (Value, error) {
 		return FloatValue{t: t.(*Float), val: val}, nil
 	case BINARY:
 		return BinaryValue{t: t.(*Binary), val: bytes}, nil
+	case TUPLE:
+		return tupleFromBytes(t.(*Tuple), bytes)
 	default:
 		return nil, ErrValueNil
 	}
 }
 
+func tupleFromBytes(t *Tuple, bytes []byte) (Value, error) {
+	values := make([]Value, len(t.types))
+	offset := 0
+	for i, typ := range t.types {
+		byteSize := typ.ByteSize()
+		if IsVarLen(typ) {
+			if offset+4 > len(bytes) {
+				return nil, ErrByteSizeMismatch
+			}
+			byteSize = int(binary.LittleEndian.Uint32(bytes[offset:]))
+			offset += 4
+		}
+		if offset+byteSize > len(bytes) {
+			return nil, ErrByteSizeMismatch
+		}
+
+		v, err := FromBytes(typ, bytes[offset:offset+byteSize])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		offset += byteSize
+	}
+	return TupleValue{t: t, val: values}, nil
+}
+
 type IntegerValue struct {
 	t   *Integer
 	val int32
@@ -226,3 +256,63 @@ func (v BinaryValue) Val() any {
 func (v BinaryValue) ToBytes() []byte {
 	return v.val
 }
+
+// TupleValue holds the element values of a tuple.
+//
+// A tuple value may hold fewer values than its type has elements,
+// such a prefix sorts before every tuple value it is a prefix of,
+// so it can be used as the lower bound of them.
+type TupleValue struct {
+	t   *Tuple
+	val []Value
+}
+
+func (v TupleValue) Compare(t Value) int {
+	other := t.(TupleValue).val
+	for i := 0; i < len(v.val) && i < len(other); i++ {
+		c := v.val[i].Compare(other[i])
+		if v.t.Order(i) == DESC {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(v.val), len(other))
+}
+
+// Prefix returns the tuple value made of the first n elements.
+func (v TupleValue) Prefix(n int) TupleValue {
+	return TupleValue{t: v.t, val: v.val[:min(n, len(v.val))]}
+}
+
+// Len returns the number of elements the value holds.
+func (v TupleValue) Len() int {
+	return len(v.val)
+}
+
+func (v TupleValue) Type() Type {
+	return v.t
+}
+
+func (v TupleValue) Val() any {
+	return v.val
+}
+
+// ToBytes concatenates the bytes of the elements,
+// variable-length elements are prefixed with their byte size.
+func (v TupleValue) ToBytes() []byte {
+	b := make([]byte, 0, v.t.ByteSize())
+	for _, elem := range v.val {
+		bytes := elem.ToBytes()
+		if IsVarLen(elem.Type()) {
+			b = binary.LittleEndian.AppendUint32(b, uint32(len(bytes)))
+		}
+		b = append(b, bytes...)
+	}
+	return b
+}
+
+func (v TupleValue) String() string {
+	return fmt.Sprint(v.val)
+}
@@ -257,3 +257,116 @@ func TestBinaryValue_Compare(t *testing.T) {
 		assert.Equal(t, tt.expected, equality)
 	}
 }
+
+func TestTupleValue_ToBytes(t *testing.T) {
+	typ := field.NewTuple([]field.Type{field.NewVarchar(), field.NewInteger(), field.NewBinary()})
+	var tests = []struct {
+		name string
+		val  []any
+	}{
+		{"empty varchar", []any{"", 0, []byte{}}},
+		{"ascii", []any{"Alice", 42, []byte{1, 2}}},
+		{"unicode", []any{"你好，世界", -1, []byte{3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := field.NewValue(typ, []field.Value{
+				field.NewValue(typ.Types()[0], tt.val[0]),
+				field.NewValue(typ.Types()[1], tt.val[1]),
+				field.NewValue(typ.Types()[2], tt.val[2]),
+			})
+
+			bytes := v.ToBytes()
+			newV, err := field.FromBytes(typ, bytes)
+
+			require.NoError(t, err)
+			assert.Zero(t, v.Compare(newV))
+			assert.Equal(t, v.Val(), newV.Val())
+		})
+	}
+
+	t.Run("truncated bytes", func(t *testing.T) {
+		v := field.NewValue(typ, []field.Value{
+			field.NewValue(typ.Types()[0], "Alice"),
+			field.NewValue(typ.Types()[1], 42),
+			field.NewValue(typ.Types()[2], []byte{1}),
+		})
+
+		_, err := field.FromBytes(typ, v.ToBytes()[:10])
+
+		assert.ErrorIs(t, err, field.ErrByteSizeMismatch)
+	})
+}
+
+func TestTupleValue_Compare(t *testing.T) {
+	intType, varcharType := field.NewInteger(), field.NewVarchar()
+	typ := field.NewTuple([]field.Type{intType, varcharType})
+	tuple := func(values ...any) field.Value {
+		elems := make([]field.Value, len(values))
+		for i, val := range values {
+			elems[i] = field.NewValue(typ.Types()[i], val)
+		}
+		return field.NewValue(typ, elems)
+	}
+
+	var tests = []struct {
+		name     string
+		val1     field.Value
+		val2     field.Value
+		expected int
+	}{
+		{"equal", tuple(1, "a"), tuple(1, "a"), 0},
+		{"first element decides", tuple(1, "b"), tuple(2, "a"), -1},
+		{"second element decides", tuple(2, "b"), tuple(2, "a"), 1},
+		{"prefix sorts first", tuple(2), tuple(2, "a"), -1},
+		{"longer sorts last", tuple(2, "a"), tuple(2), 1},
+		{"prefix of other value", tuple(1), tuple(2, "a"), -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.val1.Compare(tt.val2))
+		})
+	}
+}
+
+func TestTupleValue_CompareWithSortOrders(t *testing.T) {
+	typ := field.NewTuple(
+		[]field.Type{field.NewInteger(), field.NewInteger()},
+		field.WithSortOrders(field.ASC, field.DESC),
+	)
+	tuple := func(values ...int) field.TupleValue {
+		elems := make([]field.Value, len(values))
+		for i, val := range values {
+			elems[i] = field.NewValue(typ.Types()[i], val)
+		}
+		v, _ := field.NewValue(typ, elems).(field.TupleValue)
+		return v
+	}
+
+	var tests = []struct {
+		name     string
+		val1     field.TupleValue
+		val2     field.TupleValue
+		expected int
+	}{
+		{"ascending element decides", tuple(1, 1), tuple(2, 2), -1},
+		{"descending element decides", tuple(1, 1), tuple(1, 2), 1},
+		{"equal", tuple(1, 2), tuple(1, 2), 0},
+		{"prefix sorts first", tuple(1), tuple(1, 9), -1},
+		{"prefix of value", tuple(1, 9).Prefix(1), tuple(1), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.val1.Compare(tt.val2))
+		})
+	}
+
+	t.Run("mismatched sort orders", func(t *testing.T) {
+		assert.Panics(t, func() {
+			field.NewTuple([]field.Type{field.NewInteger()}, field.WithSortOrders(field.ASC, field.DESC))
+		})
+	})
+}
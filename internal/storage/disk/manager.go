@@ -19,5 +19,9 @@ type Manager interface {
 	ReadPage(table.PageNumber, []byte) error
 	// WritePage writes a page to disk.
 	WritePage(table.PageNumber, []byte) error
+	// DeallocatePage frees the page on disk, so reading it fails until it is written again.
+	DeallocatePage(table.PageNumber) error
+	// Sync commits the written pages to stable storage.
+	Sync() error
 	io.Closer
 }
@@ -47,6 +47,21 @@ var _ = Describe("Disk space manager", func() {
 					Expect(pageContent).To(Equal(contents))
 				})
 			})
+
+			When("read deallocated page", func() {
+				It("should return an error until it is written again", func() {
+					p := table.NewDataPage(true)
+					Expect(diskManager.WritePage(p.PageNumber(), p.Buffer())).To(Succeed())
+					Expect(diskManager.DeallocatePage(p.PageNumber())).To(Succeed())
+
+					pageContent := make([]byte, config.PageSize)
+					err := diskManager.ReadPage(p.PageNumber(), pageContent)
+					Expect(err).Should(MatchError(disk.ErrPageNotAllocated))
+
+					Expect(diskManager.WritePage(p.PageNumber(), p.Buffer())).To(Succeed())
+					Expect(diskManager.ReadPage(p.PageNumber(), pageContent)).To(Succeed())
+				})
+			})
 		})
 	}
 
@@ -64,7 +79,9 @@ var _ = Describe("Disk space manager", func() {
 
 	Describe("Disk space manager", Ordered, func() {
 		BeforeAll(func() {
-			diskManager, _ = disk.NewSpaceManager("/tmp")
+			var err error
+			diskManager, err = disk.NewSpaceManager(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
 		})
 
 		AfterAll(func() {
@@ -74,6 +91,72 @@ var _ = Describe("Disk space manager", func() {
 		AssertSpaceManagerBehavior()
 	})
 
+	Describe("Free pages of disk space manager", func() {
+		var dataDir string
+		var spaceManager *disk.SpaceManager
+
+		BeforeEach(func() {
+			var err error
+			dataDir = GinkgoT().TempDir()
+			spaceManager, err = disk.NewSpaceManager(dataDir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		// writePages writes n new pages and returns them.
+		writePages := func(n int) []*table.DataPage {
+			pages := make([]*table.DataPage, n)
+			for i := range pages {
+				pages[i] = table.NewDataPage(true)
+				Expect(spaceManager.WritePage(pages[i].PageNumber(), pages[i].Buffer())).To(Succeed())
+			}
+			return pages
+		}
+
+		It("should hand out the page number of a deallocated page again", func() {
+			pages := writePages(3)
+			Expect(spaceManager.DeallocatePage(pages[1].PageNumber())).To(Succeed())
+
+			p := table.NewDataPage(true)
+			Expect(p.PageNumber()).To(Equal(pages[1].PageNumber()))
+			Expect(spaceManager.WritePage(p.PageNumber(), p.Buffer())).To(Succeed())
+			Expect(table.NewDataPage(true).PageNumber()).To(BeNumerically(">", pages[2].PageNumber()))
+			Expect(spaceManager.Close()).To(Succeed())
+		})
+
+		It("should not hand out the page number of a deallocated page written again", func() {
+			pages := writePages(2)
+			Expect(spaceManager.DeallocatePage(pages[0].PageNumber())).To(Succeed())
+			Expect(spaceManager.WritePage(pages[0].PageNumber(), pages[0].Buffer())).To(Succeed())
+
+			Expect(table.NewDataPage(true).PageNumber()).To(BeNumerically(">", pages[1].PageNumber()))
+			Expect(spaceManager.Close()).To(Succeed())
+		})
+
+		It("should persist the deallocated pages", func() {
+			pages := writePages(4)
+			Expect(spaceManager.DeallocatePage(pages[2].PageNumber())).To(Succeed())
+			Expect(spaceManager.DeallocatePage(pages[1].PageNumber())).To(Succeed())
+			Expect(spaceManager.Sync()).To(Succeed())
+			Expect(spaceManager.Close()).To(Succeed())
+
+			By("Taking the page numbers of the pages persisted as free")
+			// The generator is shared, so the page numbers released before the reopening are taken first.
+			Expect(table.NewDataPage(true).PageNumber()).To(Equal(pages[1].PageNumber()))
+			Expect(table.NewDataPage(true).PageNumber()).To(Equal(pages[2].PageNumber()))
+
+			By("Reopening the space manager")
+			reopened, err := disk.NewSpaceManager(dataDir)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(reopened.Close)
+			pageContent := make([]byte, config.PageSize)
+			for _, p := range pages[1:3] {
+				Expect(reopened.ReadPage(p.PageNumber(), pageContent)).Should(MatchError(disk.ErrPageNotAllocated))
+			}
+			Expect(reopened.ReadPage(pages[0].PageNumber(), pageContent)).To(Succeed())
+			Expect(table.NewDataPage(true).PageNumber()).To(Equal(pages[1].PageNumber()))
+			Expect(table.NewDataPage(true).PageNumber()).To(Equal(pages[2].PageNumber()))
+		})
+	})
 })
 
 func TestDiskSpaceManager(t *testing.T) {
@@ -38,6 +38,19 @@ func (m *MemoryDiskManager) WritePage(pageNumber table.PageNumber, bytes []byte)
 	return nil
 }
 
+func (m *MemoryDiskManager) DeallocatePage(pageNumber table.PageNumber) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.pages, pageNumber)
+	return nil
+}
+
+// Sync does nothing, the pages are only kept in memory.
+func (m *MemoryDiskManager) Sync() error {
+	return nil
+}
+
 func (m *MemoryDiskManager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -1,18 +1,32 @@
 package disk
 
 import (
+	"encoding/binary"
 	"errors"
 	"io"
 	"os"
+	"slices"
+	"sync"
 
 	"github.com/Huangkai1008/libradb/internal/config"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
 )
 
+// freeListEntryByteSize is the byte size of a page number in the free list file.
+const freeListEntryByteSize = 4
+
 type SpaceManager struct {
 	dataFile *os.File
+	// freeListPath is the file the free pages are persisted in, by Sync and Close.
+	freeListPath string
+
+	mu sync.Mutex
+	// freePages holds the deallocated pages not written again since.
+	freePages map[table.PageNumber]struct{}
 }
 
+// NewSpaceManager opens the data file of the directory, creating it if absent.
+// The free pages persisted before are released, so that the new pages take their page numbers.
 func NewSpaceManager(dataDir string) (*SpaceManager, error) {
 	filePath := dataDir + "/libra.db"
 	dataFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0644)
@@ -20,17 +34,25 @@ func NewSpaceManager(dataDir string) (*SpaceManager, error) {
 		return nil, err
 	}
 
-	return &SpaceManager{dataFile: dataFile}, nil
+	m := &SpaceManager{
+		dataFile:     dataFile,
+		freeListPath: dataDir + "/libra.free",
+		freePages:    make(map[table.PageNumber]struct{}),
+	}
+	if err = m.readFreeList(); err != nil {
+		return nil, errors.Join(err, dataFile.Close())
+	}
+	return m, nil
 }
 
 func (m *SpaceManager) ReadPage(number table.PageNumber, bytes []byte) error {
-	offset := int64(number-1) * int64(config.PageSize)
-	_, err := m.dataFile.Seek(offset, 0)
-	if err != nil {
-		return err
+	if m.isFree(number) {
+		return PageNotAllocated(number)
 	}
 
-	_, err = m.dataFile.Read(bytes)
+	// The page is read at its offset, so that the concurrent reads and writes do not share the file offset.
+	offset := int64(number-1) * int64(config.PageSize)
+	_, err := m.dataFile.ReadAt(bytes, offset)
 	if errors.Is(err, io.EOF) {
 		return PageNotAllocated(number)
 	}
@@ -39,15 +61,94 @@ func (m *SpaceManager) ReadPage(number table.PageNumber, bytes []byte) error {
 
 func (m *SpaceManager) WritePage(number table.PageNumber, bytes []byte) error {
 	offset := int64(number-1) * int64(config.PageSize)
-	_, err := m.dataFile.Seek(offset, 0)
-	if err != nil {
+	if _, err := m.dataFile.WriteAt(bytes, offset); err != nil {
 		return err
 	}
 
-	_, err = m.dataFile.Write(bytes)
-	return err
+	m.mu.Lock()
+	if _, ok := m.freePages[number]; ok {
+		delete(m.freePages, number)
+		table.ReclaimPageNumber(number)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// DeallocatePage frees the page, and releases its page number so that a new page takes it.
+// The file is not truncated, and the page keeps its contents until it is written again.
+func (m *SpaceManager) DeallocatePage(number table.PageNumber) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.freePages[number] = struct{}{}
+	table.ReleasePageNumber(number)
+	return nil
+}
+
+// Sync commits the written pages to stable storage, then persists the free pages.
+func (m *SpaceManager) Sync() error {
+	if err := m.dataFile.Sync(); err != nil {
+		return err
+	}
+	return m.writeFreeList()
 }
 
+func (m *SpaceManager) isFree(number table.PageNumber) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.freePages[number]
+	return ok
+}
+
+// Close persists the free pages and closes the data file.
 func (m *SpaceManager) Close() error {
-	return m.dataFile.Close()
+	return errors.Join(m.writeFreeList(), m.dataFile.Close())
+}
+
+// readFreeList reads the free pages back from the free list file, if any.
+// They are released from the largest to the smallest, so that the smallest page number is taken first.
+func (m *SpaceManager) readFreeList() error {
+	buf, err := os.ReadFile(m.freeListPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := len(buf) - freeListEntryByteSize; i >= 0; i -= freeListEntryByteSize {
+		number := table.PageNumber(binary.LittleEndian.Uint32(buf[i:]))
+		m.freePages[number] = struct{}{}
+		table.ReleasePageNumber(number)
+	}
+	return nil
+}
+
+// writeFreeList replaces the free list file with the free pages in ascending order,
+// a temporary file is renamed over it so that a crash leaves the previous one whole.
+func (m *SpaceManager) writeFreeList() error {
+	m.mu.Lock()
+	numbers := make([]table.PageNumber, 0, len(m.freePages))
+	for number := range m.freePages {
+		numbers = append(numbers, number)
+	}
+	m.mu.Unlock()
+	slices.Sort(numbers)
+
+	buf := make([]byte, 0, len(numbers)*freeListEntryByteSize)
+	for _, number := range numbers {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(number))
+	}
+	f, err := os.Create(m.freeListPath + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	return os.Rename(m.freeListPath+".tmp", m.freeListPath)
 }
@@ -0,0 +1,166 @@
+// Package art implements in-memory indexes on an adaptive radix tree, for hot tables.
+//
+// The indexes key the records by the memcomparable encoding of their keys, so they iterate
+// in key order and a point lookup visits at most one node per key byte without comparing keys.
+// They keep nothing on disk, and are rebuilt from a durable index such as the clustered B+ tree
+// on startup.
+//
+// See V. Leis et al., The Adaptive Radix Tree: ARTful Indexing for Main-Memory Databases.
+package art
+
+import (
+	"iter"
+	"sync"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+var (
+	// ErrKeyExists is returned when putting a key already in the index.
+	ErrKeyExists = index.ErrKeyExists
+	// ErrClosed is returned when using a closed index.
+	ErrClosed = index.ErrClosed
+)
+
+var _ index.Index = (*Index)(nil)
+
+// Index is an in-memory index of the records of a schema, keyed by the keys they are put under.
+type Index struct {
+	mu     sync.RWMutex
+	tree   *ds.ART[*table.Record]
+	schema *table.Schema
+	closed bool
+}
+
+func NewIndex(schema *table.Schema) *Index {
+	return &Index{tree: ds.NewART[*table.Record](), schema: schema}
+}
+
+// Build returns an index of the records of the clustered index, such as the clustered B+ tree,
+// keyed by the keys the clustered index extracts from them.
+func Build(schema *table.Schema, clustered index.Index) (*Index, error) {
+	idx := NewIndex(schema)
+	for record, err := range clustered.Range(nil, nil) {
+		if err != nil {
+			return nil, err
+		}
+		idx.tree.Put(field.EncodeKey(index.KeyOf(clustered, record)), record)
+	}
+	return idx, nil
+}
+
+// NewFactory returns the factory of the indexes in an index catalog,
+// the indexes keep their records in memory, not in the buffer manager.
+func NewFactory() index.Factory {
+	return func(_ string, schema *table.Schema, _ memory.BufferManager) (index.Index, error) {
+		return NewIndex(schema), nil
+	}
+}
+
+func (idx *Index) Get(key index.Key) (*table.Record, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.closed {
+		return nil, ErrClosed
+	}
+	record, _ := idx.tree.Get(field.EncodeKey(key))
+	return record, nil
+}
+
+func (idx *Index) Put(key index.Key, record *table.Record) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.closed {
+		return ErrClosed
+	}
+	k := field.EncodeKey(key)
+	if _, ok := idx.tree.Get(k); ok {
+		return ErrKeyExists
+	}
+	idx.tree.Put(k, record)
+	return nil
+}
+
+func (idx *Index) Delete(key index.Key) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.closed {
+		return ErrClosed
+	}
+	idx.tree.Delete(field.EncodeKey(key))
+	return nil
+}
+
+// Range returns a sequence of the records whose key lies in [lo, hi),
+// in ascending key order.
+// A nil lo or hi leaves the corresponding side of the range unbounded.
+//
+// The index is read-locked while iterating, so the loop body must not write to it.
+func (idx *Index) Range(lo, hi index.Key) iter.Seq2[*table.Record, error] {
+	var loKey, hiKey []byte
+	if lo != nil {
+		loKey = field.EncodeKey(lo)
+	}
+	if hi != nil {
+		hiKey = field.EncodeKey(hi)
+	}
+	return idx.scan(func() iter.Seq2[[]byte, *table.Record] {
+		return idx.tree.Range(loKey, hiKey)
+	})
+}
+
+// Prefix returns a sequence of the records whose key starts with the prefix, in ascending key order.
+// The prefix is a whole key, or a tuple of the leading elements of the tuple keys,
+// since a tuple encodes to its null marker followed by the encodings of its elements.
+//
+// The index is read-locked while iterating, so the loop body must not write to it.
+func (idx *Index) Prefix(prefix index.Key) iter.Seq2[*table.Record, error] {
+	return idx.scan(func() iter.Seq2[[]byte, *table.Record] {
+		return idx.tree.Prefix(field.EncodeKey(prefix))
+	})
+}
+
+// Stats returns the statistics of the index, which takes no pages.
+func (idx *Index) Stats() (*index.Stats, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.closed {
+		return nil, ErrClosed
+	}
+	return &index.Stats{RecordCount: idx.tree.Len()}, nil
+}
+
+// Close drops the records of the index.
+func (idx *Index) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.closed = true
+	idx.tree = ds.NewART[*table.Record]()
+	return nil
+}
+
+func (idx *Index) scan(entries func() iter.Seq2[[]byte, *table.Record]) iter.Seq2[*table.Record, error] {
+	return func(yield func(*table.Record, error) bool) {
+		idx.mu.RLock()
+		defer idx.mu.RUnlock()
+
+		if idx.closed {
+			yield(nil, ErrClosed)
+			return
+		}
+		for _, record := range entries() {
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
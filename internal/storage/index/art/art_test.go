@@ -0,0 +1,303 @@
+package art_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/index/art"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("ART index", func() {
+	const recordCount = 1000
+
+	var schema *table.Schema
+	var pkType field.Type
+	var idx *art.Index
+
+	keysOf := func(seq func(func(*table.Record, error) bool)) []int {
+		var keys []int
+		for record, err := range seq {
+			Expect(err).ToNot(HaveOccurred())
+			keys = append(keys, int(record.GetKey().Val().(int32)))
+		}
+		return keys
+	}
+
+	BeforeEach(func() {
+		schema = table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar())
+		pkType = field.NewInteger()
+		idx = art.NewIndex(schema)
+		// Negative keys check that the keys are ordered by their encoding.
+		for _, i := range rand.Perm(recordCount) {
+			key := i - recordCount/2
+			Expect(idx.Put(field.NewValue(pkType, key), table.NewRecordFromLiteral(key, "name"))).To(Succeed())
+		}
+	})
+
+	It("should get, put and delete records", func() {
+		record, err := idx.Get(field.NewValue(pkType, -3))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record).ToNot(BeNil())
+		Expect(idx.Put(field.NewValue(pkType, -3), record)).To(MatchError(art.ErrKeyExists))
+
+		Expect(idx.Delete(field.NewValue(pkType, -3))).To(Succeed())
+		record, err = idx.Get(field.NewValue(pkType, -3))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record).To(BeNil())
+
+		stats, err := idx.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats).To(Equal(&index.Stats{RecordCount: recordCount - 1}))
+	})
+
+	It("should range over the records in key order", func() {
+		Expect(keysOf(idx.Range(field.NewValue(pkType, -3), field.NewValue(pkType, 3)))).
+			To(Equal([]int{-3, -2, -1, 0, 1, 2}))
+		Expect(keysOf(idx.Range(field.NewValue(pkType, recordCount/2-2), nil))).
+			To(Equal([]int{recordCount/2 - 2, recordCount/2 - 1}))
+
+		keys := keysOf(idx.Range(nil, nil))
+		Expect(keys).To(HaveLen(recordCount))
+		for i, key := range keys {
+			Expect(key).To(Equal(i - recordCount/2))
+		}
+	})
+
+	It("should scan the records of a key prefix", func() {
+		tupleType := field.NewTuple([]field.Type{field.NewVarchar(), field.NewInteger()})
+		schema = table.NewSchema().WithField("city_id", tupleType)
+		idx = art.NewIndex(schema)
+		for _, city := range []string{"rome", "paris", "oslo"} {
+			for id := 3; id > 0; id-- {
+				key := field.NewValue(tupleType, []field.Value{
+					field.NewValue(field.NewVarchar(), city), field.NewValue(pkType, id),
+				})
+				Expect(idx.Put(key, table.NewRecord(key))).To(Succeed())
+			}
+		}
+
+		var ids []int32
+		prefix := field.NewValue(tupleType, []field.Value{field.NewValue(field.NewVarchar(), "paris")})
+		for record, err := range idx.Prefix(prefix) {
+			Expect(err).ToNot(HaveOccurred())
+			values, _ := record.GetKey().Val().([]field.Value)
+			Expect(values[0].Val()).To(Equal("paris"))
+			ids = append(ids, values[1].Val().(int32))
+		}
+		Expect(ids).To(Equal([]int32{1, 2, 3}))
+	})
+
+	It("should be built from the clustered B+ tree", func() {
+		bufferManager := memory.NewBufferPool(64, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+		DeferCleanup(bufferManager.Close)
+		tree, err := bplustree.NewBPlusTree(&bplustree.Metadata{Order: 4, Schema: schema}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+		for _, key := range rand.Perm(recordCount) {
+			Expect(tree.Put(field.NewValue(pkType, key), table.NewRecordFromLiteral(key, "name"))).To(Succeed())
+		}
+
+		idx, err = art.Build(schema, tree)
+		Expect(err).ToNot(HaveOccurred())
+		keys := keysOf(idx.Range(nil, nil))
+		Expect(keys).To(HaveLen(recordCount))
+		for i, key := range keys {
+			Expect(key).To(Equal(i))
+		}
+	})
+
+	It("should be built from a clustered B+ tree of a composite key", func() {
+		bufferManager := memory.NewBufferPool(64, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+		DeferCleanup(bufferManager.Close)
+		tree, err := bplustree.NewBPlusTree(&bplustree.Metadata{
+			Order:      4,
+			Schema:     schema,
+			KeyColumns: []bplustree.KeyColumn{{Index: 1}, {Index: 0}},
+		}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+		// The records share their first column, not their key.
+		var records []*table.Record
+		for _, name := range []string{"rome", "paris", "oslo"} {
+			record := table.NewRecordFromLiteral(1, name)
+			Expect(tree.Put(tree.KeyOf(record), record)).To(Succeed())
+			records = append(records, record)
+		}
+
+		idx, err = art.Build(schema, tree)
+		Expect(err).ToNot(HaveOccurred())
+		stats, err := idx.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.RecordCount).To(Equal(len(records)))
+		for _, record := range records {
+			found, getErr := idx.Get(tree.KeyOf(record))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(found).To(Equal(record))
+		}
+	})
+
+	It("should not be used once closed", func() {
+		Expect(idx.Close()).To(Succeed())
+		_, err := idx.Get(field.NewValue(pkType, 1))
+		Expect(err).To(MatchError(art.ErrClosed))
+		for _, err = range idx.Range(nil, nil) {
+			Expect(err).To(MatchError(art.ErrClosed))
+		}
+	})
+})
+
+var _ = Describe("ART secondary index", func() {
+	const (
+		nameColumn = 1
+		ageColumn  = 2
+	)
+
+	var clustered *bplustree.BPlusTree
+	var schema *table.Schema
+	var ageType field.Type
+
+	put := func(indexes []*art.SecondaryIndex, values ...any) error {
+		record := table.NewRecordFromLiteral(values...)
+		if err := clustered.Put(record.GetKey(), record); err != nil {
+			return err
+		}
+		for _, idx := range indexes {
+			if err := idx.Put(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	namesOf := func(records []*table.Record) []string {
+		names := make([]string, len(records))
+		for i, record := range records {
+			names[i] = record.Get(nameColumn).Val().(string)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		schema = table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar()).
+			WithField("age", field.NewInteger())
+		ageType = field.NewInteger()
+
+		bufferManager := memory.NewBufferPool(32, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+		DeferCleanup(bufferManager.Close)
+
+		var err error
+		clustered, err = bplustree.NewBPlusTree(&bplustree.Metadata{Order: 2, Schema: schema}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should reject an invalid column", func() {
+		_, err := art.NewSecondaryIndex(clustered, schema, 3)
+		Expect(err).To(MatchError(art.ErrInvalidColumn))
+	})
+
+	It("should be rebuilt from the clustered B+ tree", func() {
+		for id := 0; id < 50; id++ {
+			Expect(put(nil, id, fmt.Sprintf("name-%02d", id), 20+id%5)).To(Succeed())
+		}
+
+		idx, err := art.NewSecondaryIndex(clustered, schema, ageColumn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(idx.Len()).To(BeZero())
+		Expect(idx.Rebuild()).To(Succeed())
+		Expect(idx.Len()).To(Equal(50))
+
+		records, err := idx.Get(field.NewValue(ageType, 22))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namesOf(records)).To(HaveLen(10))
+		for i, record := range records {
+			Expect(record.GetKey().Val()).To(Equal(int32(2 + 5*i)))
+		}
+
+		unique, err := art.NewSecondaryIndex(clustered, schema, ageColumn, art.WithUnique(true))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(unique.Rebuild()).To(MatchError(art.ErrKeyExists))
+	})
+
+	It("should be rebuilt from a clustered B+ tree of a composite key", func() {
+		bufferManager := memory.NewBufferPool(32, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+		DeferCleanup(bufferManager.Close)
+		composite, err := bplustree.NewBPlusTree(&bplustree.Metadata{
+			Order:      2,
+			Schema:     schema,
+			KeyColumns: []bplustree.KeyColumn{{Index: 0}, {Index: nameColumn}},
+		}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+		// The records share their first column, not their key.
+		for _, name := range []string{"alice", "bob", "carol"} {
+			record := table.NewRecordFromLiteral(1, name, 30)
+			Expect(composite.Put(composite.KeyOf(record), record)).To(Succeed())
+		}
+
+		idx, err := art.NewSecondaryIndex(composite, schema, ageColumn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(idx.Rebuild()).To(Succeed())
+		Expect(idx.Len()).To(Equal(3))
+		records, err := idx.Get(field.NewValue(ageType, 30))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namesOf(records)).To(Equal([]string{"alice", "bob", "carol"}))
+	})
+
+	It("should keep up with the clustered records", func() {
+		idx, err := art.NewSecondaryIndex(clustered, schema, ageColumn)
+		Expect(err).ToNot(HaveOccurred())
+		names, err := art.NewSecondaryIndex(clustered, schema, nameColumn, art.WithUnique(true))
+		Expect(err).ToNot(HaveOccurred())
+		indexes := []*art.SecondaryIndex{idx, names}
+
+		Expect(put(indexes, 1, "alice", 30)).To(Succeed())
+		Expect(put(indexes, 2, "bob", 25)).To(Succeed())
+		Expect(put(indexes, 3, "carol", 30)).To(Succeed())
+		Expect(put(indexes, 4, "dave", 35)).To(Succeed())
+		Expect(names.Put(table.NewRecordFromLiteral(5, "alice", 40))).To(MatchError(art.ErrKeyExists))
+
+		records, err := idx.Get(field.NewValue(ageType, 30))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namesOf(records)).To(Equal([]string{"alice", "carol"}))
+
+		var ordered []string
+		for record, rangeErr := range idx.Range(field.NewValue(ageType, 25), field.NewValue(ageType, 35)) {
+			Expect(rangeErr).ToNot(HaveOccurred())
+			ordered = append(ordered, record.Get(nameColumn).Val().(string))
+		}
+		Expect(ordered).To(Equal([]string{"bob", "alice", "carol"}))
+
+		// Another record holding the name is not indexed under it.
+		names.Delete(table.NewRecordFromLiteral(5, "alice", 40))
+		Expect(names.PrimaryKeys(field.NewValue(field.NewVarchar(), "alice"))).To(HaveLen(1))
+
+		record := table.NewRecordFromLiteral(1, "alice", 30)
+		Expect(clustered.Delete(record.GetKey())).To(Succeed())
+		records, err = idx.Get(field.NewValue(ageType, 30))
+		Expect(err).To(MatchError(art.ErrDanglingEntry))
+		Expect(records).To(BeNil())
+
+		idx.Delete(record)
+		names.Delete(record)
+		records, err = idx.Get(field.NewValue(ageType, 30))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(namesOf(records)).To(Equal([]string{"carol"}))
+		Expect(names.PrimaryKeys(field.NewValue(field.NewVarchar(), "alice"))).To(BeEmpty())
+	})
+})
+
+func TestART(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "ART Suite")
+}
@@ -0,0 +1,76 @@
+package art_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/index/art"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+func benchmarkGet(b *testing.B, idx index.Index, keys []field.Value) {
+	b.Helper()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if record, err := idx.Get(keys[i%len(keys)]); err != nil || record == nil {
+			b.Fatalf("get %v: %v, %v", keys[i%len(keys)], record, err)
+		}
+	}
+}
+
+// BenchmarkGet compares the point lookups of the ART index with the ones of the B+ tree,
+// whose pages all fit in the buffer pool.
+func BenchmarkGet(b *testing.B) {
+	const n = 10000
+	varchar, integer := field.NewVarchar(), field.NewInteger()
+
+	keysOf := map[string]func(i int) field.Value{
+		"integer": func(i int) field.Value {
+			return field.NewValue(integer, i)
+		},
+		"varchar": func(i int) field.Value {
+			return field.NewValue(varchar, fmt.Sprintf("user-%08d", i))
+		},
+	}
+
+	for _, name := range []string{"integer", "varchar"} {
+		schema := table.NewSchema().
+			WithField("id", keysOf[name](0).Type()).
+			WithField("name", varchar)
+		keys := make([]field.Value, n)
+		records := make([]*table.Record, n)
+		for i, j := range rand.Perm(n) {
+			keys[i] = keysOf[name](j)
+			records[i] = table.NewRecord(keys[i], field.NewValue(varchar, "name"))
+		}
+
+		bufferManager := memory.NewBufferPool(4096, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+		tree, err := bplustree.NewBPlusTree(&bplustree.Metadata{Order: 64, Schema: schema}, bufferManager)
+		if err != nil {
+			b.Fatal(err)
+		}
+		artIndex := art.NewIndex(schema)
+		for i, key := range keys {
+			if err = tree.Put(key, records[i]); err != nil {
+				b.Fatal(err)
+			}
+			if err = artIndex.Put(key, records[i]); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.Run(name+"/art", func(b *testing.B) {
+			benchmarkGet(b, artIndex, keys)
+		})
+		b.Run(name+"/bplustree", func(b *testing.B) {
+			benchmarkGet(b, tree, keys)
+		})
+		_ = bufferManager.Close()
+	}
+}
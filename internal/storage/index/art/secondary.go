@@ -0,0 +1,210 @@
+package art
+
+import (
+	"errors"
+	"iter"
+	"sync"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+var (
+	// ErrInvalidColumn is returned when the indexed column is out of the schema.
+	ErrInvalidColumn = errors.New("invalid index column")
+	// ErrDanglingEntry is returned when a secondary index entry
+	// points to a record missing in the clustered index.
+	ErrDanglingEntry = errors.New("secondary index entry points to a missing record")
+)
+
+type SecondaryIndexOption func(*SecondaryIndex)
+
+// WithUnique makes the secondary index reject duplicate secondary keys.
+func WithUnique(unique bool) SecondaryIndexOption {
+	return func(idx *SecondaryIndex) {
+		idx.unique = unique
+	}
+}
+
+// SecondaryIndex indexes the records of a clustered index on an arbitrary column in memory,
+// mapping the secondary keys to the primary keys, the keys the clustered index extracts from the records.
+//
+// A unique index keys the entries by the encoding of the secondary key only.
+// A non-unique index appends the encoding of the primary key to it,
+// which tells the records sharing a secondary key apart. Since the encodings
+// are self-delimiting, the entries of a secondary key are the ones prefixed by its encoding.
+//
+// The secondary index starts empty and is filled by Rebuild from the clustered index,
+// after which callers must put and delete the records on both of them.
+type SecondaryIndex struct {
+	mu        sync.RWMutex
+	clustered index.Index
+	entries   *ds.ART[index.Key]
+	// column is the position of the indexed column in the clustered records.
+	column int
+	unique bool
+}
+
+func NewSecondaryIndex(
+	clustered index.Index,
+	schema *table.Schema,
+	column int,
+	options ...SecondaryIndexOption,
+) (*SecondaryIndex, error) {
+	if column < 0 || column >= schema.Length() {
+		return nil, ErrInvalidColumn
+	}
+
+	idx := &SecondaryIndex{
+		clustered: clustered,
+		entries:   ds.NewART[index.Key](),
+		column:    column,
+	}
+	for _, option := range options {
+		option(idx)
+	}
+	return idx, nil
+}
+
+// Rebuild replaces the entries of the index with the ones of all the clustered records,
+// or returns ErrKeyExists if a unique index finds a duplicate secondary key.
+func (idx *SecondaryIndex) Rebuild() error {
+	entries := ds.NewART[index.Key]()
+	for record, err := range idx.clustered.Range(nil, nil) {
+		if err != nil {
+			return err
+		}
+		key, primaryKey := idx.entryOf(record)
+		if entries.Put(key, primaryKey) {
+			return ErrKeyExists
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.entries = entries
+	return nil
+}
+
+// Len returns the number of entries.
+func (idx *SecondaryIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return idx.entries.Len()
+}
+
+// Put adds the entry of the clustered record into the index.
+func (idx *SecondaryIndex) Put(record *table.Record) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key, primaryKey := idx.entryOf(record)
+	if _, ok := idx.entries.Get(key); ok {
+		return ErrKeyExists
+	}
+	idx.entries.Put(key, primaryKey)
+	return nil
+}
+
+// Delete removes the entry of the clustered record from the index,
+// or does nothing if the record is not indexed.
+func (idx *SecondaryIndex) Delete(record *table.Record) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key, primaryKey := idx.entryOf(record)
+	if idx.unique {
+		// The secondary key may be taken by another record.
+		if indexed, ok := idx.entries.Get(key); !ok || indexed.Compare(primaryKey) != 0 {
+			return
+		}
+	}
+	idx.entries.Delete(key)
+}
+
+// PrimaryKeys returns the primary keys of the records whose secondary key equals the key,
+// in ascending order.
+func (idx *SecondaryIndex) PrimaryKeys(key index.Key) []index.Key {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var primaryKeys []index.Key
+	for _, primaryKey := range idx.entries.Prefix(field.EncodeKey(key)) {
+		primaryKeys = append(primaryKeys, primaryKey)
+	}
+	return primaryKeys
+}
+
+// Get returns the clustered records whose secondary key equals the key,
+// in ascending order of their primary keys.
+func (idx *SecondaryIndex) Get(key index.Key) ([]*table.Record, error) {
+	return idx.records(idx.PrimaryKeys(key))
+}
+
+// Prefix returns the clustered records whose secondary key starts with the prefix,
+// a tuple of the leading elements of tuple secondary keys, in ascending secondary key order.
+func (idx *SecondaryIndex) Prefix(prefix index.Key) ([]*table.Record, error) {
+	return idx.records(idx.PrimaryKeys(prefix))
+}
+
+// Range returns a sequence of the clustered records whose secondary key lies in [lo, hi),
+// in ascending secondary key order.
+// A nil lo or hi leaves the corresponding side of the range unbounded.
+func (idx *SecondaryIndex) Range(lo, hi index.Key) iter.Seq2[*table.Record, error] {
+	var loKey, hiKey []byte
+	if lo != nil {
+		loKey = field.EncodeKey(lo)
+	}
+	if hi != nil {
+		// The entries of hi are prefixed by its encoding, so they are not less than it.
+		hiKey = field.EncodeKey(hi)
+	}
+
+	return func(yield func(*table.Record, error) bool) {
+		idx.mu.RLock()
+		var primaryKeys []index.Key
+		for _, primaryKey := range idx.entries.Range(loKey, hiKey) {
+			primaryKeys = append(primaryKeys, primaryKey)
+		}
+		idx.mu.RUnlock()
+
+		for _, primaryKey := range primaryKeys {
+			record, err := idx.clustered.Get(primaryKey)
+			if err == nil && record == nil {
+				err = ErrDanglingEntry
+			}
+			if !yield(record, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// records returns the clustered records of the primary keys.
+func (idx *SecondaryIndex) records(primaryKeys []index.Key) ([]*table.Record, error) {
+	records := make([]*table.Record, 0, len(primaryKeys))
+	for _, primaryKey := range primaryKeys {
+		record, err := idx.clustered.Get(primaryKey)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			return nil, ErrDanglingEntry
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// entryOf returns the key and the primary key of the entry of the clustered record in the index.
+func (idx *SecondaryIndex) entryOf(record *table.Record) ([]byte, index.Key) {
+	secondaryKey, primaryKey := record.Get(idx.column), index.KeyOf(idx.clustered, record)
+	key := field.EncodeKey(secondaryKey)
+	if !idx.unique {
+		key = field.AppendKey(key, primaryKey, field.ASC)
+	}
+	return key, primaryKey
+}
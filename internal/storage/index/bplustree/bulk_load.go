@@ -0,0 +1,376 @@
+package bplustree
+
+import (
+	"errors"
+	"math"
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+	"github.com/Huangkai1008/libradb/pkg/typing"
+)
+
+const DefaultFillFactor = 1.0
+
+var (
+	// ErrUnsortedInput is returned when the bulk loaded records are not sorted by key.
+	ErrUnsortedInput = errors.New("records are not sorted by key")
+	// ErrInvalidFillFactor is returned when the fill factor is not in (0, 1].
+	ErrInvalidFillFactor = errors.New("fill factor must be in (0, 1]")
+)
+
+type BulkLoadOption func(*bulkLoader)
+
+// WithFillFactor sets the fraction of the 2 * Order entries each node is packed to.
+// Nodes are never packed below Order entries regardless of the fill factor,
+// unless their page is full of large records before.
+func WithFillFactor(fillFactor float64) BulkLoadOption {
+	return func(loader *bulkLoader) {
+		loader.fillFactor = fillFactor
+	}
+}
+
+// bulkLoader builds a B+ tree bottom-up.
+//
+// The leaves are packed from the sorted records one after another,
+// then every inner level is packed from the separators and page numbers
+// of the level below, until a single root remains.
+type bulkLoader struct {
+	meta          *Metadata
+	bufferManager memory.BufferManager
+	fillFactor    float64
+
+	// prevLeaf is kept pinned until the next leaf is linked to it.
+	prevLeaf *LeafNode
+	prevKey  encodedKey
+	// children are the (separator, page number) pairs of the level being packed.
+	children []Pair
+}
+
+// BulkLoad builds a B+ tree from records already sorted by key in ascending order.
+//
+// It is much cheaper than putting the records one by one,
+// since no node is ever split and the nodes are packed to the fill factor.
+// The Bloom filter of the tree, if enabled, is built from the loaded keys.
+// The caller remains responsible for closing the records iterator.
+func BulkLoad(
+	meta *Metadata,
+	bufferManager memory.BufferManager,
+	records typing.Iterator[*table.Record],
+	options ...BulkLoadOption,
+) (*BPlusTree, error) {
+	loader := &bulkLoader{
+		meta:          meta,
+		bufferManager: bufferManager,
+		fillFactor:    DefaultFillFactor,
+	}
+	for _, option := range options {
+		option(loader)
+	}
+	if loader.fillFactor <= 0 || loader.fillFactor > 1 {
+		return nil, ErrInvalidFillFactor
+	}
+	if err := meta.init(); err != nil {
+		return nil, err
+	}
+
+	if err := loader.loadLeaves(records); err != nil {
+		return nil, err
+	}
+	if len(loader.children) == 0 {
+		return NewBPlusTree(meta, bufferManager)
+	}
+
+	height := uint32(1)
+	for len(loader.children) > 1 {
+		if err := loader.loadInnerLevel(); err != nil {
+			return nil, err
+		}
+		height++
+	}
+
+	meta.rootPageNumber = loader.children[0].value
+	meta.height = height
+	tree := &BPlusTree{meta: meta, bufferManager: bufferManager}
+	if err := tree.RebuildFilter(); err != nil {
+		return nil, err
+	}
+	if err := tree.initMetaPage(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func (loader *bulkLoader) loadLeaves(records typing.Iterator[*table.Record]) error {
+	order := int(loader.meta.Order)
+	p := newPacker(loader.capacity(order), order, 2*order, //nolint:mnd // 2*order is the threshold.
+		(*table.Record).ByteSize, table.DataPageByteSize, loader.emitLeaf)
+
+	for record := records.Next(); record != nil; record = records.Next() {
+		key := encodeKey(loader.meta.keyOf(record))
+		if loader.prevKey != nil && key.Compare(loader.prevKey) <= 0 {
+			loader.release()
+			return ErrUnsortedInput
+		}
+		loader.prevKey = key
+		if record.ByteSize() > table.MaxRecordByteSize {
+			loader.release()
+			return ErrRecordTooLarge
+		}
+
+		if err := p.add(record); err != nil {
+			loader.release()
+			return err
+		}
+	}
+	if err := records.Err(); err != nil {
+		loader.release()
+		return err
+	}
+
+	err := p.flush()
+	loader.release()
+	return err
+}
+
+func (loader *bulkLoader) loadInnerLevel() error {
+	order := int(loader.meta.Order)
+	children := loader.children
+	loader.children = nil
+
+	// An inner node with n keys has n + 1 children.
+	p := newPacker(loader.capacity(order)+1, order+1, 2*order+1, //nolint:mnd // 2*order is the threshold.
+		func(child Pair) int {
+			return newIndexRecord(child.key, child.value).ByteSize()
+		},
+		func(children []Pair) int {
+			return table.DataPageByteSize(indexRecordsOf(children))
+		},
+		loader.emitInner,
+	)
+	for _, child := range children {
+		if err := p.add(child); err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+// capacity returns the number of keys a node is packed to.
+func (loader *bulkLoader) capacity(order int) int {
+	maxKeys := 2 * order //nolint:mnd // 2*order is the threshold.
+	capacity := int(math.Ceil(float64(maxKeys) * loader.fillFactor))
+	return max(min(capacity, maxKeys), order, 1)
+}
+
+func (loader *bulkLoader) emitLeaf(records []*table.Record) error {
+	options := []LeafNodeOption{WithDataRecords(records)}
+	if loader.prevLeaf != nil {
+		options = append(options, WithLeafPrev(loader.prevLeaf.PageNumber()))
+	}
+
+	leaf, err := NewLeafNode(loader.meta, loader.bufferManager, options...)
+	if err != nil {
+		return err
+	}
+
+	separator := leaf.keys[0]
+	if loader.prevLeaf != nil {
+		separator = shortestSeparator(loader.prevLeaf.keys[len(loader.prevLeaf.keys)-1], separator)
+		loader.prevLeaf.page.SetNext(leaf.PageNumber())
+		loader.prevLeaf.unpin(true)
+	}
+	loader.prevLeaf = leaf
+	loader.children = append(loader.children, Pair{key: separator, value: leaf.PageNumber()})
+	return nil
+}
+
+func (loader *bulkLoader) emitInner(children []Pair) error {
+	node, err := NewInnerNode(loader.meta, loader.bufferManager, WithIndexRecords(indexRecordsOf(children)))
+	if err != nil {
+		return err
+	}
+	node.unpin(true)
+
+	// The separator of the first child is the separator of the subtree in the parent level.
+	loader.children = append(loader.children, Pair{key: children[0].key, value: node.PageNumber()})
+	return nil
+}
+
+func indexRecordsOf(children []Pair) []*table.Record {
+	records := make([]*table.Record, len(children))
+	for i, child := range children {
+		records[i] = newIndexRecord(child.key, child.value)
+	}
+	return records
+}
+
+// release unpins the last packed leaf.
+func (loader *bulkLoader) release() {
+	if loader.prevLeaf != nil {
+		loader.prevLeaf.unpin(true)
+		loader.prevLeaf = nil
+	}
+}
+
+// packer groups a stream of entries into nodes of target entries.
+//
+// It holds back min entries before emitting a node,
+// so that the tail can always be split into nodes
+// holding between min and max entries.
+// A node whose page is full of large entries is closed before it holds target entries,
+// and is only emitted once the next node is closed, so that a short tail can be packed with it.
+type packer[T any] struct {
+	target int
+	min    int
+	max    int
+	// size returns the bytes an entry takes in a page without key prefix compression.
+	size func(T) int
+	// pageSize returns the bytes a page holding the entries takes.
+	pageSize func([]T) int
+	buf      []T
+	// headBytes is the size of a page holding the entries of the next node without key prefix compression,
+	// which bounds the size it takes.
+	headBytes int
+	// pending is the last closed node not emitted yet.
+	pending []T
+	emit    func([]T) error
+}
+
+func newPacker[T any](
+	target, minEntries, maxEntries int,
+	size func(T) int,
+	pageSize func([]T) int,
+	emit func([]T) error,
+) *packer[T] {
+	p := &packer[T]{
+		target:   target,
+		min:      minEntries,
+		max:      maxEntries,
+		size:     size,
+		pageSize: pageSize,
+		buf:      make([]T, 0, target+minEntries),
+		emit:     emit,
+	}
+	p.resetHead()
+	return p
+}
+
+func (p *packer[T]) add(entry T) error {
+	p.buf = append(p.buf, entry)
+	if len(p.buf) <= p.target {
+		p.headBytes += p.size(entry)
+	}
+
+	for {
+		head := min(len(p.buf), p.target)
+		n := p.nodeLength()
+		if n == head && len(p.buf) < p.target+p.min {
+			return nil
+		}
+		if err := p.closeHead(n); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *packer[T]) flush() error {
+	// A tail shorter than min entries, left after a node full of large entries, is packed again with that node.
+	if p.pending != nil && len(p.buf) < p.min {
+		p.buf = append(p.pending, p.buf...)
+		p.pending = nil
+	}
+
+	for len(p.buf) > 0 {
+		if len(p.buf) <= p.max && p.fits(p.buf) {
+			if err := p.closeHead(len(p.buf)); err != nil {
+				return err
+			}
+			break
+		}
+		if k := p.splitPoint(); k > 0 {
+			if err := p.closeHead(k); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.closeHead(p.nodeLength()); err != nil {
+			return err
+		}
+	}
+
+	if p.pending == nil {
+		return nil
+	}
+	err := p.emit(p.pending)
+	p.pending = nil
+	return err
+}
+
+// splitPoint returns where the buffered entries split into two nodes, 0 if they do not fit in two pages.
+//
+// The entries are split evenly if the halves fit in pages,
+// otherwise where both sides fit and take as close bytes as possible.
+func (p *packer[T]) splitPoint() int {
+	n := len(p.buf)
+	half := n / 2 //nolint:mnd // split the tail evenly.
+	if n-half <= p.max && p.fits(p.buf[:half]) && p.fits(p.buf[half:]) {
+		return half
+	}
+
+	best, bestDiff := 0, 0
+	for k := max(n-p.max, 1); k < n && k <= p.max; k++ {
+		left, right := p.pageSize(p.buf[:k]), p.pageSize(p.buf[k:])
+		if left > config.PageSize || right > config.PageSize {
+			continue
+		}
+		if diff := abs(left - right); best == 0 || diff < bestDiff {
+			best, bestDiff = k, diff
+		}
+	}
+	return best
+}
+
+// nodeLength returns the number of entries of the next node, up to target and as many as its page holds.
+func (p *packer[T]) nodeLength() int {
+	n := min(len(p.buf), p.target)
+	if p.headBytes <= config.PageSize {
+		return n
+	}
+	// An entry always fits in a page on its own.
+	for n > 1 && !p.fits(p.buf[:n]) {
+		n--
+	}
+	return n
+}
+
+// closeHead closes a node of the first n entries, and emits the node closed before.
+func (p *packer[T]) closeHead(n int) error {
+	if p.pending != nil {
+		if err := p.emit(p.pending); err != nil {
+			return err
+		}
+	}
+	p.pending = append([]T{}, p.buf[:n]...)
+	p.buf = append(p.buf[:0], p.buf[n:]...)
+	p.resetHead()
+	return nil
+}
+
+func (p *packer[T]) fits(entries []T) bool {
+	return p.pageSize(entries) <= config.PageSize
+}
+
+func (p *packer[T]) resetHead() {
+	p.headBytes = table.DataPageByteSize(nil)
+	for _, entry := range p.buf[:min(len(p.buf), p.target)] {
+		p.headBytes += p.size(entry)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,219 @@
+package bplustree_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// sliceIterator iterates the records of a slice.
+type sliceIterator struct {
+	records []*table.Record
+	pos     int
+	err     error
+}
+
+func (it *sliceIterator) Next() *table.Record {
+	if it.pos >= len(it.records) {
+		return nil
+	}
+	record := it.records[it.pos]
+	it.pos++
+	return record
+}
+
+func (it *sliceIterator) Err() error {
+	return it.err
+}
+
+func (it *sliceIterator) Close() error {
+	return nil
+}
+
+func sortedRecords(keys ...int) *sliceIterator {
+	records := make([]*table.Record, len(keys))
+	for i, key := range keys {
+		records[i] = table.NewRecordFromLiteral(key, fmt.Sprintf("name-%d", key), key, key%2 == 0, float64(key))
+	}
+	return &sliceIterator{records: records}
+}
+
+func keyRange(n int) []int {
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i] = i
+	}
+	return keys
+}
+
+var _ = Describe("Bulk load B+ tree", func() {
+	const poolSize = 16
+
+	var schema *table.Schema
+	var bufferManager memory.BufferManager
+	var pkType field.Type
+
+	BeforeEach(func() {
+		schema = table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar()).
+			WithField("age", field.NewInteger()).
+			WithField("is_student", field.NewBoolean()).
+			WithField("score", field.NewFloat())
+		pkType = field.NewInteger()
+
+		replacer := memory.NewLRUKReplacer(2)
+		diskManager := disk.NewMemoryDiskManager()
+		bufferManager = memory.NewBufferPool(poolSize, diskManager, replacer)
+		DeferCleanup(bufferManager.Close)
+	})
+
+	DescribeTable("should load sorted records",
+		func(order uint16, recordCount int, fillFactor float64) {
+			tree, err := bplustree.BulkLoad(&bplustree.Metadata{
+				Order:  order,
+				Schema: schema,
+			}, bufferManager, sortedRecords(keyRange(recordCount)...), bplustree.WithFillFactor(fillFactor))
+			Expect(err).ToNot(HaveOccurred())
+
+			By("Scan all records forward")
+			count := 0
+			for record, scanErr := range tree.All() {
+				Expect(scanErr).ToNot(HaveOccurred())
+				Expect(record.GetKey()).To(Equal(field.NewValue(pkType, count)))
+				count++
+			}
+			Expect(count).To(Equal(recordCount))
+
+			By("Scan all records backward")
+			count = 0
+			for record, scanErr := range tree.Backward() {
+				Expect(scanErr).ToNot(HaveOccurred())
+				count++
+				Expect(record.GetKey()).To(Equal(field.NewValue(pkType, recordCount-count)))
+			}
+			Expect(count).To(Equal(recordCount))
+
+			By("Get every record")
+			for i := 0; i < recordCount; i++ {
+				record, getErr := tree.Get(field.NewValue(pkType, i))
+				Expect(getErr).ToNot(HaveOccurred())
+				Expect(record).ToNot(BeNil())
+			}
+		},
+		Entry("empty input", uint16(2), 0, 1.0),
+		Entry("a single leaf", uint16(2), 3, 1.0),
+		Entry("two levels", uint16(2), 10, 1.0),
+		Entry("full pages", uint16(2), 500, 1.0),
+		Entry("half full pages", uint16(2), 500, 0.5),
+		Entry("low fill factor", uint16(3), 500, 0.1),
+		Entry("odd fill factor", uint16(5), 777, 0.7),
+	)
+
+	It("should put after bulk load", func() {
+		tree, err := bplustree.BulkLoad(&bplustree.Metadata{
+			Order:  2,
+			Schema: schema,
+		}, bufferManager, sortedRecords(0, 2, 4, 6, 8, 10, 12, 14, 16, 18), bplustree.WithFillFactor(1))
+		Expect(err).ToNot(HaveOccurred())
+
+		for key := 1; key < 20; key += 2 {
+			record := table.NewRecordFromLiteral(key, fmt.Sprintf("name-%d", key), key, false, float64(key))
+			Expect(tree.Put(field.NewValue(pkType, key), record)).To(Succeed())
+		}
+
+		count := 0
+		for record, scanErr := range tree.All() {
+			Expect(scanErr).ToNot(HaveOccurred())
+			Expect(record.GetKey()).To(Equal(field.NewValue(pkType, count)))
+			count++
+		}
+		Expect(count).To(Equal(20))
+	})
+
+	It("should pack the wide records into pages by bytes", func() {
+		const recordCount = 500
+		name := strings.Repeat("n", 250)
+		records := make([]*table.Record, recordCount)
+		for i := range records {
+			records[i] = table.NewRecordFromLiteral(i, name, i, false, float64(i))
+		}
+
+		tree, err := bplustree.BulkLoad(&bplustree.Metadata{
+			Order:  60,
+			Schema: schema,
+		}, bufferManager, &sliceIterator{records: records})
+		Expect(err).ToNot(HaveOccurred())
+		// Writing a page holding more records than fit panics.
+		Expect(bufferManager.FlushAll()).To(Succeed())
+		report, err := tree.Verify()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.OK()).To(BeTrue(), report.String())
+
+		for i := 0; i < recordCount; i++ {
+			record, getErr := tree.Get(field.NewValue(pkType, i))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).To(Equal(records[i]))
+		}
+	})
+
+	It("should pack the long separators into inner pages by bytes", func() {
+		const recordCount = 2000
+		schema = table.NewSchema().WithField("id", field.NewVarchar())
+		// The keys of a group share a long prefix, so the separators between them cannot be shortened.
+		keys := make([]string, recordCount)
+		records := make([]*table.Record, recordCount)
+		for i := range records {
+			keys[i] = fmt.Sprintf("%05d-%s-%05d", i/40, strings.Repeat("p", 150), i)
+			records[i] = table.NewRecordFromLiteral(keys[i])
+		}
+
+		tree, err := bplustree.BulkLoad(&bplustree.Metadata{
+			Order:  60,
+			Schema: schema,
+		}, bufferManager, &sliceIterator{records: records})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bufferManager.FlushAll()).To(Succeed())
+		report, err := tree.Verify()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.OK()).To(BeTrue(), report.String())
+
+		for _, key := range keys {
+			record, getErr := tree.Get(field.NewValue(field.NewVarchar(), key))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+		}
+	})
+
+	DescribeTable("should reject invalid input",
+		func(records *sliceIterator, fillFactor float64, expected error) {
+			_, err := bplustree.BulkLoad(&bplustree.Metadata{
+				Order:  2,
+				Schema: schema,
+			}, bufferManager, records, bplustree.WithFillFactor(fillFactor))
+			Expect(err).To(MatchError(expected))
+
+			By("Releasing every pinned page")
+			for i := 0; i < poolSize; i++ {
+				Expect(bufferManager.ApplyNewPage(1, table.NewDataPage(true))).To(Succeed())
+			}
+		},
+		Entry("unsorted keys", sortedRecords(append(keyRange(20), 3)...), 1.0, bplustree.ErrUnsortedInput),
+		Entry("duplicate keys", sortedRecords(1, 2, 2), 1.0, bplustree.ErrUnsortedInput),
+		Entry("too large record", &sliceIterator{records: []*table.Record{
+			table.NewRecordFromLiteral(1, strings.Repeat("x", table.MaxRecordByteSize), 1, false, 1.0),
+		}}, 1.0, bplustree.ErrRecordTooLarge),
+		Entry("zero fill factor", sortedRecords(1), 0.0, bplustree.ErrInvalidFillFactor),
+		Entry("too large fill factor", sortedRecords(1), 1.5, bplustree.ErrInvalidFillFactor),
+		Entry("iterator error", &sliceIterator{err: errors.New("broken")}, 1.0, errors.New("broken")),
+	)
+})
@@ -0,0 +1,21 @@
+package bplustree
+
+import (
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+// RootPageNumber exposes the root page number of the tree to the tests.
+func (tree *BPlusTree) RootPageNumber() table.PageNumber {
+	return tree.meta.rootPageNumber
+}
+
+// FilterOf exposes the Bloom filter of the tree to the tests.
+func FilterOf(tree *BPlusTree) *ds.BloomFilter {
+	return tree.meta.Filter()
+}
+
+// FilterDeletesOf exposes the number of keys deleted since the Bloom filter of the tree was built to the tests.
+func FilterDeletesOf(tree *BPlusTree) int {
+	return tree.meta.filterDeletes
+}
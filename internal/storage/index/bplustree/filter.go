@@ -0,0 +1,83 @@
+package bplustree
+
+import (
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+// DefaultExpectedKeys is the number of keys the Bloom filter is sized for by default.
+const DefaultExpectedKeys = 1024
+
+func (meta *Metadata) expectedKeys() int {
+	if meta.ExpectedKeys > 0 {
+		return meta.ExpectedKeys
+	}
+	return DefaultExpectedKeys
+}
+
+// Filter returns the Bloom filter of the keys, or nil if it is disabled.
+// It is part of the metadata so that Flush persists it along with it.
+func (meta *Metadata) Filter() *ds.BloomFilter {
+	return meta.filter
+}
+
+// mayContain returns false if the Bloom filter rules the key out.
+func (tree *BPlusTree) mayContain(key encodedKey) bool {
+	return tree.meta.filter == nil || tree.meta.filter.MayContain(key)
+}
+
+// addToFilter adds the key put in the tree to the Bloom filter,
+// and rebuilds it twice as large once it holds more keys than it is sized for.
+func (tree *BPlusTree) addToFilter(key encodedKey) error {
+	filter := tree.meta.filter
+	if filter == nil {
+		return nil
+	}
+
+	filter.Add(key)
+	if filter.Count() <= filter.Capacity() {
+		return nil
+	}
+	return tree.RebuildFilter()
+}
+
+// removeFromFilter accounts for a key deleted from the tree,
+// the bits of which the Bloom filter cannot clear.
+// Once the deleted keys are half of the keys in the filter, it is rebuilt
+// so that they stop passing as false positives.
+func (tree *BPlusTree) removeFromFilter() error {
+	filter := tree.meta.filter
+	if filter == nil {
+		return nil
+	}
+
+	tree.meta.filterDeletes++
+	if tree.meta.filterDeletes*2 < filter.Count() {
+		return nil
+	}
+	return tree.RebuildFilter()
+}
+
+// RebuildFilter rebuilds the Bloom filter from the keys in the tree,
+// sized for ExpectedKeys or twice the keys, whichever is larger.
+// It does nothing if the filter is disabled.
+func (tree *BPlusTree) RebuildFilter() error {
+	if tree.meta.FalsePositiveRate <= 0 {
+		return nil
+	}
+
+	var keys []encodedKey
+	for record, err := range tree.All() {
+		if err != nil {
+			return err
+		}
+		keys = append(keys, encodeKey(tree.meta.keyOf(record)))
+	}
+
+	filter := ds.NewBloomFilter(max(tree.meta.expectedKeys(), 2*len(keys)), tree.meta.FalsePositiveRate)
+	for _, key := range keys {
+		filter.Add(key)
+	}
+	tree.meta.filter = filter
+	tree.meta.filterDeletes = 0
+	return nil
+}
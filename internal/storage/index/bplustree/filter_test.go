@@ -0,0 +1,232 @@
+package bplustree_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// keptDiskManager is a disk manager the buffer pool does not close, so that a tree can be reopened on it.
+type keptDiskManager struct {
+	disk.Manager
+}
+
+func (m keptDiskManager) Close() error {
+	return nil
+}
+
+// countingBufferManager counts the pages fetched.
+type countingBufferManager struct {
+	memory.BufferManager
+	fetches int
+}
+
+func (m *countingBufferManager) FetchPage(
+	pageNumber table.PageNumber,
+	schema *table.Schema,
+	opts ...memory.FetchOption,
+) (table.Page, error) {
+	m.fetches++
+	return m.BufferManager.FetchPage(pageNumber, schema, opts...)
+}
+
+var _ = Describe("Bloom filter of B+ tree", func() {
+	const recordCount = 500
+
+	var schema *table.Schema
+	var bufferManager *countingBufferManager
+	var pkType field.Type
+
+	newRecord := func(key int) *table.Record {
+		return table.NewRecordFromLiteral(key, fmt.Sprintf("name-%d", key), key, key%2 == 0, float64(key))
+	}
+
+	newTree := func(fpRate float64, expectedKeys int) *bplustree.BPlusTree {
+		tree, err := bplustree.NewBPlusTree(&bplustree.Metadata{
+			Order:             4,
+			Schema:            schema,
+			FalsePositiveRate: fpRate,
+			ExpectedKeys:      expectedKeys,
+		}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+		return tree
+	}
+
+	// missedFetches returns the pages fetched getting recordCount absent keys.
+	missedFetches := func(tree *bplustree.BPlusTree) int {
+		fetches := bufferManager.fetches
+		for i := recordCount; i < 2*recordCount; i++ {
+			record, err := tree.Get(field.NewValue(pkType, i))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record).To(BeNil())
+		}
+		return bufferManager.fetches - fetches
+	}
+
+	BeforeEach(func() {
+		schema = table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar()).
+			WithField("age", field.NewInteger()).
+			WithField("is_student", field.NewBoolean()).
+			WithField("score", field.NewFloat())
+		pkType = field.NewInteger()
+
+		replacer := memory.NewLRUKReplacer(2)
+		diskManager := disk.NewMemoryDiskManager()
+		bufferManager = &countingBufferManager{
+			BufferManager: memory.NewBufferPool(64, diskManager, replacer),
+		}
+		DeferCleanup(bufferManager.Close)
+	})
+
+	It("should skip the pages for absent keys", func() {
+		tree := newTree(0.01, 0)
+		for i := 0; i < recordCount; i++ {
+			Expect(tree.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+		for i := 0; i < recordCount; i++ {
+			record, err := tree.Get(field.NewValue(pkType, i))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+		}
+
+		Expect(missedFetches(tree)).To(BeNumerically("<", recordCount/10))
+		Expect(missedFetches(newTree(0, 0))).To(BeNumerically(">=", recordCount))
+	})
+
+	It("should grow the filter beyond the expected keys", func() {
+		tree := newTree(0.01, 16)
+		for i := 0; i < recordCount; i++ {
+			Expect(tree.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+		Expect(bplustree.FilterOf(tree).Capacity()).To(BeNumerically(">=", recordCount))
+
+		for i := 0; i < recordCount; i++ {
+			record, err := tree.Get(field.NewValue(pkType, i))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+		}
+		Expect(missedFetches(tree)).To(BeNumerically("<", recordCount/10))
+	})
+
+	It("should only count inserted keys", func() {
+		tree := newTree(0.01, 0)
+		Expect(tree.Put(field.NewValue(pkType, 1), newRecord(1))).To(Succeed())
+		Expect(tree.Upsert(field.NewValue(pkType, 1), newRecord(1))).To(Succeed())
+		Expect(tree.Put(field.NewValue(pkType, 1), newRecord(1))).To(MatchError(bplustree.ErrKeyExists))
+		Expect(tree.Upsert(field.NewValue(pkType, 2), newRecord(2))).To(Succeed())
+
+		Expect(bplustree.FilterOf(tree).Count()).To(Equal(2))
+	})
+
+	It("should rebuild the filter after deletes", func() {
+		tree := newTree(0.01, 0)
+		for i := 0; i < recordCount; i++ {
+			Expect(tree.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+		for i := 0; i < recordCount; i++ {
+			Expect(tree.Delete(field.NewValue(pkType, i))).To(Succeed())
+		}
+
+		Expect(bplustree.FilterOf(tree).Count()).To(BeZero())
+		fetches := bufferManager.fetches
+		for i := 0; i < recordCount; i++ {
+			record, err := tree.Get(field.NewValue(pkType, i))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record).To(BeNil())
+		}
+		Expect(bufferManager.fetches - fetches).To(BeNumerically("<", recordCount/10))
+	})
+
+	It("should only count the deletes of present keys", func() {
+		tree := newTree(0.5, 0)
+		for i := 0; i < 10; i++ {
+			Expect(tree.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+		filter := bplustree.FilterOf(tree)
+
+		By("Deleting absent keys, half of which pass the filter")
+		for i := recordCount; i < 2*recordCount; i++ {
+			Expect(tree.Delete(field.NewValue(pkType, i))).To(Succeed())
+		}
+		Expect(bplustree.FilterDeletesOf(tree)).To(BeZero())
+		Expect(bplustree.FilterOf(tree)).To(BeIdenticalTo(filter))
+
+		Expect(tree.Delete(field.NewValue(pkType, 3))).To(Succeed())
+		Expect(bplustree.FilterDeletesOf(tree)).To(Equal(1))
+	})
+
+	It("should persist the filter in the metadata of the tree", func() {
+		diskManager := keptDiskManager{disk.NewMemoryDiskManager()}
+		pool := memory.NewBufferPool(16, diskManager, memory.NewLRUKReplacer(2))
+		newMeta := func(expectedKeys int) *bplustree.Metadata {
+			return &bplustree.Metadata{Order: 4, Schema: schema, FalsePositiveRate: 0.01, ExpectedKeys: expectedKeys}
+		}
+		tree, err := bplustree.NewBPlusTree(newMeta(20*recordCount), pool)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < recordCount; i++ {
+			Expect(tree.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+		Expect(tree.Delete(field.NewValue(pkType, 0))).To(Succeed())
+		filter, err := bplustree.FilterOf(tree).MarshalBinary()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(filter)).To(BeNumerically(">", 2*config.PageSize), "the filter spans several pages")
+
+		By("Closing the tree and the buffer pool")
+		Expect(tree.Close()).To(Succeed())
+		Expect(pool.Close()).To(Succeed())
+
+		By("Reopening the tree on a new buffer pool")
+		bufferManager = &countingBufferManager{
+			BufferManager: memory.NewBufferPool(16, diskManager, memory.NewLRUKReplacer(2)),
+		}
+		reopened, err := bplustree.OpenBPlusTree(newMeta(recordCount), tree.MetaPageNumber(), bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bplustree.FilterOf(reopened).MarshalBinary()).To(Equal(filter))
+		Expect(bplustree.FilterDeletesOf(reopened)).To(Equal(1))
+		for i := 1; i < recordCount; i++ {
+			record, getErr := reopened.Get(field.NewValue(pkType, i))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+		}
+		Expect(missedFetches(reopened)).To(BeNumerically("<", recordCount/10))
+
+		By("Persisting a smaller filter over the pages of the larger one")
+		Expect(reopened.RebuildFilter()).To(Succeed())
+		filter, err = bplustree.FilterOf(reopened).MarshalBinary()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(filter)).To(BeNumerically("<", config.PageSize/2))
+		Expect(reopened.Close()).To(Succeed())
+		reopened, err = bplustree.OpenBPlusTree(newMeta(recordCount), tree.MetaPageNumber(), bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bplustree.FilterOf(reopened).MarshalBinary()).To(Equal(filter))
+		Expect(bplustree.FilterDeletesOf(reopened)).To(BeZero())
+		Expect(bufferManager.Close()).To(Succeed())
+	})
+
+	It("should build the filter from bulk loaded keys", func() {
+		tree, err := bplustree.BulkLoad(&bplustree.Metadata{
+			Order:             4,
+			Schema:            schema,
+			FalsePositiveRate: 0.01,
+		}, bufferManager, sortedRecords(keyRange(recordCount)...))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(bplustree.FilterOf(tree).Count()).To(Equal(recordCount))
+		for i := 0; i < recordCount; i++ {
+			record, getErr := tree.Get(field.NewValue(pkType, i))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+		}
+		Expect(missedFetches(tree)).To(BeNumerically("<", recordCount/10))
+	})
+})
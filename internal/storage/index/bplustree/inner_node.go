@@ -5,6 +5,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/Huangkai1008/libradb/internal/config"
 	"github.com/Huangkai1008/libradb/internal/storage/memory"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
 	"github.com/Huangkai1008/libradb/internal/util"
@@ -25,9 +26,9 @@ type InnerNode struct {
 	page          *table.DataPage
 	bufferManager memory.BufferManager
 
-	// keys present the minimum key on the child page they point to,
+	// keys present the encoded minimum key on the child page they point to,
 	// are sorted in ascending Order.
-	keys []Key
+	keys []encodedKey
 	// children present the child page numbers.
 	children []table.PageNumber
 }
@@ -41,7 +42,7 @@ func NewInnerNode(
 	node := &InnerNode{
 		meta:          meta,
 		bufferManager: buffManager,
-		keys:          make([]Key, 0, threshold),
+		keys:          make([]encodedKey, 0, threshold),
 		children:      make([]table.PageNumber, 0, threshold+1),
 	}
 
@@ -79,7 +80,7 @@ func WithIndexRecords(records []*table.Record) InnerNodeOption {
 		}
 		for i, record := range records {
 			if i > 0 {
-				node.keys = append(node.keys, record.GetKey())
+				node.keys = append(node.keys, keyOfIndexRecord(record))
 			}
 
 			val := record.Get(1).Val()
@@ -90,6 +91,10 @@ func WithIndexRecords(records []*table.Record) InnerNodeOption {
 
 // Get the leaf node that may contain the key.
 func (node *InnerNode) Get(key Key) (*LeafNode, error) {
+	return node.get(encodeKey(key))
+}
+
+func (node *InnerNode) get(key encodedKey) (*LeafNode, error) {
 	index := util.SearchIndex(key, node.keys)
 	pageNumber := node.getChild(index)
 	node.unpin(false)
@@ -98,10 +103,14 @@ func (node *InnerNode) Get(key Key) (*LeafNode, error) {
 		return nil, err
 	}
 
-	return child.Get(key)
+	return child.get(key)
 }
 
 func (node *InnerNode) Put(key Key, record *table.Record) (*Pair, error) {
+	return node.write(encodeKey(key), insertFunc(record))
+}
+
+func (node *InnerNode) write(key encodedKey, fn writeFunc) (*Pair, error) {
 	defer node.unpin(true)
 
 	index := util.SearchIndex(key, node.keys)
@@ -111,7 +120,7 @@ func (node *InnerNode) Put(key Key, record *table.Record) (*Pair, error) {
 		return nil, err
 	}
 
-	pair, err := child.Put(key, record)
+	pair, err := child.write(key, fn)
 	if err != nil {
 		return nil, err
 	}
@@ -132,11 +141,9 @@ func (node *InnerNode) Put(key Key, record *table.Record) (*Pair, error) {
 		return nil, nil //nolint:nilnil // nil is returned to indicate no split is needed.
 	}
 
-	// When an inner node splits, the first d entries are kept in the left node
-	// and the last d entries are moved to the right node.
-	// The middle key is moved up to the parent node.
-	splitKey = node.keys[node.meta.Order]
-	rightRecords := node.page.Shrink(node.meta.Order + 1)
+	splitPoint := node.splitPoint()
+	splitKey = node.keys[splitPoint]
+	rightRecords := node.page.Shrink(uint16(splitPoint) + 1)
 	rightNode, err := NewInnerNode(
 		node.meta,
 		node.bufferManager,
@@ -148,21 +155,25 @@ func (node *InnerNode) Put(key Key, record *table.Record) (*Pair, error) {
 		return nil, err
 	}
 
-	node.keys = node.keys[:node.meta.Order]
-	node.children = node.children[:node.meta.Order+1]
+	node.keys = node.keys[:splitPoint]
+	node.children = node.children[:splitPoint+1]
 	node.page.SetPrev(rightNode.page.PageNumber())
-	node.unpin(true)
+	rightNode.unpin(true)
 	return &Pair{key: splitKey, value: rightNode.page.PageNumber()}, nil
 }
 
 func (node *InnerNode) Delete(key Key) error {
-	leafNode, err := node.Get(key)
+	return node.delete(encodeKey(key))
+}
+
+func (node *InnerNode) delete(key encodedKey) error {
+	// get unpins the node itself.
+	leafNode, err := node.get(key)
 	if err != nil {
 		return err
 	}
 
-	node.unpin(false)
-	return leafNode.Delete(key)
+	return leafNode.delete(key)
 }
 
 func (node *InnerNode) PageNumber() table.PageNumber {
@@ -184,7 +195,7 @@ func innerNodeFromPage(
 	for i := uint16(0); i < recordCount; i++ {
 		record := node.page.Get(i)
 		if i > 0 {
-			node.keys = append(node.keys, record.GetKey())
+			node.keys = append(node.keys, keyOfIndexRecord(record))
 		}
 		val := record.Get(1).Val()
 		node.children = append(node.children, table.PageNumber(val.(int32)))
@@ -192,6 +203,12 @@ func innerNodeFromPage(
 	return node
 }
 
+// keyOfIndexRecord returns the encoded key stored in the index record.
+func keyOfIndexRecord(record *table.Record) encodedKey {
+	key, _ := record.GetKey().Val().([]byte)
+	return key
+}
+
 func (node *InnerNode) getChild(index int) table.PageNumber {
 	return node.children[index]
 }
@@ -215,7 +232,47 @@ func (node *InnerNode) String() string {
 	return buffer.String()
 }
 
+// splitPoint returns the index of the key moved up to the parent node when the node splits.
+//
+// When an inner node splits, the first d entries are kept in the left node
+// and the last d entries are moved to the right node.
+// If the node overflows its page before, which happens when the keys are long,
+// it splits where both sides fit in a page and take as close bytes as possible instead.
+func (node *InnerNode) splitPoint() int {
+	order := int(node.meta.Order)
+	records := node.records()
+	if len(node.keys) > 2*order && //nolint:mnd // 2*order is the threshold.
+		table.DataPageByteSize(records[:order+1]) <= config.PageSize &&
+		table.DataPageByteSize(records[order+1:]) <= config.PageSize {
+		return order
+	}
+
+	// The split key k keeps the records up to k in the left node, each side keeps its own child.
+	splitPoint, bestDiff := len(node.keys)/2, -1 //nolint:mnd // split in the middle.
+	for k := range node.keys {
+		left, right := table.DataPageByteSize(records[:k+1]), table.DataPageByteSize(records[k+1:])
+		if left > config.PageSize || right > config.PageSize {
+			continue
+		}
+		if diff := abs(left - right); bestDiff == -1 || diff < bestDiff {
+			splitPoint, bestDiff = k, diff
+		}
+	}
+	return splitPoint
+}
+
+// isOverflowed returns true if the node holds more than 2 * Order keys,
+// or its records no longer fit in the page.
 func (node *InnerNode) isOverflowed() bool {
-	// FIXME: use the byte size of used space to determine if the node is overflowed.
-	return len(node.keys) > int(2*node.meta.Order) //nolint:mnd // 2*order is the threshold.
+	return len(node.keys) > int(2*node.meta.Order) || //nolint:mnd // 2*order is the threshold.
+		node.page.ByteSize() > config.PageSize
+}
+
+func (node *InnerNode) records() []*table.Record {
+	recordCount := node.page.RecordCount()
+	records := make([]*table.Record, recordCount)
+	for i := uint16(0); i < recordCount; i++ {
+		records[i] = node.page.Get(i)
+	}
+	return records
 }
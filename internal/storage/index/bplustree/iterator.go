@@ -1,12 +1,26 @@
 package bplustree
 
 import (
+	"errors"
+
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
 )
 
+var (
+	// ErrNotLeafNode is returned when a sibling link points to a non-leaf page.
+	ErrNotLeafNode = errors.New("not a leaf node")
+)
+
+// RecordIterator iterates the records along the leaf chain.
+//
+// The leaf the iterator currently stays on is kept pinned,
+// and it is unpinned as soon as the iterator moves past it.
+// Close must be called to unpin the last visited leaf.
 type RecordIterator struct {
 	cur *LeafNode
 	pos int
+	err error
 }
 
 func NewRecordIterator(head *LeafNode, startPos int) *RecordIterator {
@@ -16,75 +30,98 @@ func NewRecordIterator(head *LeafNode, startPos int) *RecordIterator {
 	}
 }
 
+// newErrRecordIterator returns an iterator which yields nothing but the error.
+func newErrRecordIterator(err error) *RecordIterator {
+	return &RecordIterator{err: err}
+}
+
 func (it *RecordIterator) Prev() *table.Record {
-	var record *table.Record
+	if it.cur == nil || it.err != nil {
+		return nil
+	}
+
+	if it.pos >= len(it.cur.keys) {
+		it.pos = len(it.cur.keys) - 1
+	}
 
-	defer func() {
-		if record != nil {
-			it.pos--
+	// Move to prev leaf page until find a non-empty one.
+	for it.pos < 0 {
+		prevPageNumber := it.cur.page.PrevPageNumber()
+		if prevPageNumber == table.InvalidPageNumber {
+			return nil
 		}
-	}()
 
-	if it.pos >= 0 {
-		if it.pos == len(it.cur.records()) {
-			it.pos--
+		if !it.moveTo(prevPageNumber) {
+			return nil
 		}
-		record = it.cur.records()[it.pos]
-		return record
+		it.pos = len(it.cur.keys) - 1
 	}
 
-	// Move to prev leaf page.
-	prevPageNumber := it.cur.page.PrevPageNumber()
-	if prevPageNumber == table.InvalidPageNumber {
+	record := it.cur.page.Get(uint16(it.pos))
+	it.pos--
+	return record
+}
+
+func (it *RecordIterator) Next() *table.Record {
+	if it.cur == nil || it.err != nil {
 		return nil
 	}
 
-	leaf, err := BPlusNodeFrom(prevPageNumber, it.cur.meta, it.cur.bufferManager)
-	if err != nil {
-		return nil
+	if it.pos < 0 {
+		it.pos = 0
 	}
 
-	cur, ok := leaf.(*LeafNode)
-	if !ok {
-		return nil
+	// Move to next leaf page until find a non-empty one.
+	for it.pos >= len(it.cur.keys) {
+		nextPageNumber := it.cur.page.NextPageNumber()
+		if nextPageNumber == table.InvalidPageNumber {
+			return nil
+		}
+
+		if !it.moveTo(nextPageNumber) {
+			return nil
+		}
+		it.pos = 0
 	}
 
-	it.cur, it.pos = cur, len(cur.records())-1
-	record = it.cur.records()[it.pos]
+	record := it.cur.page.Get(uint16(it.pos))
+	it.pos++
 	return record
 }
 
-func (it *RecordIterator) Next() *table.Record {
-	var record *table.Record
-
-	defer func() {
-		if record != nil {
-			it.pos++
-		}
-	}()
-
-	if it.pos < len(it.cur.records()) {
-		record = it.cur.records()[it.pos]
-		return record
-	}
+func (it *RecordIterator) Err() error {
+	return it.err
+}
 
-	// Move to next leaf page.
-	nextPageNumber := it.cur.page.NextPageNumber()
-	if nextPageNumber == table.InvalidPageNumber {
-		return nil
+// Close unpins the leaf the iterator stays on.
+// It is safe to call Close more than once.
+func (it *RecordIterator) Close() error {
+	if it.cur != nil {
+		it.cur.unpin(false)
+		it.cur = nil
 	}
+	return nil
+}
 
-	leaf, err := BPlusNodeFrom(nextPageNumber, it.cur.meta, it.cur.bufferManager)
+// moveTo fetches the sibling leaf and unpins the current one.
+// It records the error and returns false if the sibling cannot be fetched.
+//
+// The sibling is fetched as used once, so that a long scan does not push out the pages fetched often.
+func (it *RecordIterator) moveTo(pageNumber table.PageNumber) bool {
+	node, err := BPlusNodeFrom(pageNumber, it.cur.meta, it.cur.bufferManager, memory.WithUseOnce())
 	if err != nil {
-		return nil
+		it.err = err
+		return false
 	}
 
-	cur, ok := leaf.(*LeafNode)
+	leaf, ok := node.(*LeafNode)
 	if !ok {
-		return nil
+		node.unpin(false)
+		it.err = ErrNotLeafNode
+		return false
 	}
 
-	it.cur, it.pos = cur, 0
-	record = it.cur.records()[it.pos]
-	return record
+	it.cur.unpin(false)
+	it.cur = leaf
+	return true
 }
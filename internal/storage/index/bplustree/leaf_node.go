@@ -6,6 +6,8 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
 	"github.com/Huangkai1008/libradb/internal/storage/memory"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
 	"github.com/Huangkai1008/libradb/internal/util"
@@ -13,7 +15,13 @@ import (
 
 var (
 	// ErrKeyExists is returned when the key already exists in the leaf node.
-	ErrKeyExists = errors.New("key already exists")
+	ErrKeyExists = index.ErrKeyExists
+	// ErrKeyNotFound is returned when updating a key absent from the tree.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrKeyChanged is returned when an update changes the key of the record.
+	ErrKeyChanged = errors.New("update changes the key")
+	// ErrRecordTooLarge is returned when a record is larger than table.MaxRecordByteSize.
+	ErrRecordTooLarge = index.ErrRecordTooLarge
 )
 
 type LeafNodeOption func(*LeafNode)
@@ -24,8 +32,8 @@ type LeafNode struct {
 	page          *table.DataPage
 	bufferManager memory.BufferManager
 
-	// keys present the primary key of the record.
-	keys []Key
+	// keys present the encoded primary key of the record.
+	keys []encodedKey
 }
 
 func NewLeafNode(
@@ -38,7 +46,7 @@ func NewLeafNode(
 		meta:          meta,
 		page:          table.NewDataPage(true),
 		bufferManager: buffManager,
-		keys:          make([]Key, 0, threshold),
+		keys:          make([]encodedKey, 0, threshold),
 	}
 
 	applyLeafNodeOptions(node, options...)
@@ -74,7 +82,7 @@ func WithDataRecords(records []*table.Record) LeafNodeOption {
 			node.page.Append(record)
 		}
 		for _, record := range records {
-			node.keys = append(node.keys, record.GetKey())
+			node.keys = append(node.keys, encodeKey(node.meta.keyOf(record)))
 		}
 	}
 }
@@ -86,28 +94,55 @@ func (node *LeafNode) Get(key Key) (*LeafNode, error) {
 	return node, nil
 }
 
+//nolint:revive // implement the interface method
+func (node *LeafNode) get(key encodedKey) (*LeafNode, error) {
+	return node, nil
+}
+
 // Put the key and record identifier into the subtree rooted by node.
 // If key already exists, raise an error.
 func (node *LeafNode) Put(key Key, record *table.Record) (*Pair, error) {
-	defer node.unpin(true)
+	return node.write(encodeKey(key), insertFunc(record))
+}
 
-	if slices.Contains(node.keys, key) {
-		return nil, ErrKeyExists
+func (node *LeafNode) write(key encodedKey, fn writeFunc) (*Pair, error) {
+	index := util.FindIndex(key, node.keys)
+	var old *table.Record
+	if index != -1 {
+		old = node.page.Get(uint16(index))
 	}
 
-	insertIndex := util.InsertIndex(key, node.keys)
-	node.keys = slices.Insert(node.keys, insertIndex, key)
+	record, err := fn(old)
+	if err == nil && record != nil && record.ByteSize() > table.MaxRecordByteSize {
+		err = ErrRecordTooLarge
+	}
+	if err != nil || record == nil {
+		node.unpin(false)
+		return nil, err
+	}
+	defer node.unpin(true)
 
-	node.insertRecord(insertIndex, record)
+	if old != nil {
+		// Update the record in place.
+		node.page.Replace(uint16(index), record)
+	} else {
+		index = util.InsertIndex(key, node.keys)
+		node.keys = slices.Insert(node.keys, index, key)
+		node.insertRecord(index, record)
+	}
 
 	if !node.isOverflowed() {
 		return nil, nil //nolint:nilnil // nil is returned to indicate no split is needed.
 	}
+	return node.split(index)
+}
 
-	// When the leaf splits, it returns the first entry in the right node as the split key.
-	// `d` entries remain in the left node; `d + 1` entries are moved to the right node.
-	rightKeys := append([]Key{}, node.keys[node.meta.Order:]...)
-	rightRecords := node.page.Shrink(node.meta.Order)
+// split moves the records from the split point on to a new right sibling,
+// and returns the shortest key separating the two nodes as the split key.
+func (node *LeafNode) split(written int) (*Pair, error) {
+	splitPoint := node.splitPoint(written)
+	rightKeys := append([]encodedKey{}, node.keys[splitPoint:]...)
+	rightRecords := node.page.Shrink(uint16(splitPoint))
 	rightNode, err := NewLeafNode(
 		node.meta,
 		node.bufferManager,
@@ -120,10 +155,13 @@ func (node *LeafNode) Put(key Key, record *table.Record) (*Pair, error) {
 	}
 	rightPageNumber := rightNode.page.PageNumber()
 	rightNode.unpin(true)
-	node.keys = node.keys[:node.meta.Order]
+	if err = node.relinkNext(rightPageNumber); err != nil {
+		return nil, err
+	}
+	node.keys = node.keys[:splitPoint]
 	node.page.SetNext(rightPageNumber)
 
-	splitKey := rightKeys[0]
+	splitKey := shortestSeparator(node.keys[len(node.keys)-1], rightKeys[0])
 	pair := &Pair{
 		key:   splitKey,
 		value: rightPageNumber,
@@ -131,9 +169,55 @@ func (node *LeafNode) Put(key Key, record *table.Record) (*Pair, error) {
 	return pair, nil
 }
 
+// splitPoint returns the index of the first record moved to the right sibling.
+//
+// When the leaf splits, `d` entries remain in the left node; `d + 1` entries are moved to the right node.
+// If the halves do not fit in a page, which happens when the written record is large,
+// the leaf splits right before or after the written record instead,
+// one of which always leaves both sides fitting, so the record is relocated next to the leaf.
+func (node *LeafNode) splitPoint(written int) int {
+	middle := len(node.keys) / 2 //nolint:mnd // split in the middle.
+	records := node.records()
+	for _, splitPoint := range []int{middle, written, written + 1} {
+		if splitPoint > 0 && splitPoint < len(records) &&
+			table.DataPageByteSize(records[:splitPoint]) <= config.PageSize &&
+			table.DataPageByteSize(records[splitPoint:]) <= config.PageSize {
+			return splitPoint
+		}
+	}
+	return middle
+}
+
+// relinkNext points the prev link of the next sibling to the page number.
+func (node *LeafNode) relinkNext(pageNumber table.PageNumber) error {
+	nextPageNumber := node.page.NextPageNumber()
+	if nextPageNumber == table.InvalidPageNumber {
+		return nil
+	}
+
+	p, err := node.bufferManager.FetchPage(nextPageNumber, node.meta.Schema)
+	if err != nil {
+		return err
+	}
+
+	next, ok := p.(*table.DataPage)
+	if !ok {
+		node.bufferManager.Unpin(nextPageNumber, false)
+		return errors.New("not a data page")
+	}
+	next.SetPrev(pageNumber)
+	node.bufferManager.Unpin(nextPageNumber, true)
+	return nil
+}
+
 func (node *LeafNode) Delete(key Key) error {
+	return node.delete(encodeKey(key))
+}
+
+func (node *LeafNode) delete(key encodedKey) error {
 	index := util.FindIndex(key, node.keys)
 	if index == -1 {
+		node.unpin(false)
 		return nil
 	}
 
@@ -159,7 +243,7 @@ func leafNodeFromPage(
 	}
 
 	for _, record := range node.records() {
-		node.keys = append(node.keys, record.GetKey())
+		node.keys = append(node.keys, encodeKey(meta.keyOf(record)))
 	}
 
 	return node
@@ -170,6 +254,10 @@ func (node *LeafNode) Order() uint16 {
 }
 
 func (node *LeafNode) GetRecord(key Key) *table.Record {
+	return node.getRecord(encodeKey(key))
+}
+
+func (node *LeafNode) getRecord(key encodedKey) *table.Record {
 	index := util.FindIndex(key, node.keys)
 	if index == -1 {
 		return nil
@@ -178,9 +266,11 @@ func (node *LeafNode) GetRecord(key Key) *table.Record {
 	return node.page.Get(uint16(index))
 }
 
+// isOverflowed returns true if the node holds more than 2 * Order keys,
+// or its records no longer fit in the page.
 func (node *LeafNode) isOverflowed() bool {
-	// FIXME: use the byte size of used space to determine if the node is overflowed.
-	return len(node.keys) > int(2*node.meta.Order) //nolint:mnd // 2*order is the threshold.
+	return len(node.keys) > int(2*node.meta.Order) || //nolint:mnd // 2*order is the threshold.
+		node.page.ByteSize() > config.PageSize
 }
 
 func (node *LeafNode) insertRecord(index int, record *table.Record) {
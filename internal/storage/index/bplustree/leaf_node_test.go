@@ -1,6 +1,7 @@
 package bplustree_test
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 
@@ -142,4 +143,31 @@ func (suite *LeafNodeTestSuite) TestLeafNodePut() {
 		suite.Require().NoError(err)
 		suite.NotNil(pair)
 	})
+	suite.Run("should truncate the split key", func() {
+		schema := table.NewSchema().
+			WithField("url", field.NewVarchar()).
+			WithField("visits", field.NewInteger())
+		leafNode, err := bplustree.NewLeafNode(&bplustree.Metadata{
+			Order:  10,
+			Schema: schema,
+		}, suite.bufferManager)
+		suite.Require().NoError(err)
+
+		urlType := field.NewVarchar()
+		url := func(i int) string {
+			return fmt.Sprintf("https://example.com/articles/%03d", i)
+		}
+		var pair *bplustree.Pair
+		for i := 0; i <= suite.timesToOverflow(leafNode); i++ {
+			pair, err = leafNode.Put(field.NewValue(urlType, url(i)), table.NewRecordFromLiteral(url(i), i))
+			suite.Require().NoError(err)
+		}
+		suite.Require().NotNil(pair)
+
+		leftLast := field.EncodeKey(field.NewValue(urlType, url(9)))
+		rightFirst := field.EncodeKey(field.NewValue(urlType, url(10)))
+		suite.Less(len(pair.Key()), len(rightFirst))
+		suite.Equal(-1, bytes.Compare(leftLast, pair.Key()))
+		suite.LessOrEqual(bytes.Compare(pair.Key(), rightFirst), 0)
+	})
 }
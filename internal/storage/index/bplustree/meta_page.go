@@ -0,0 +1,300 @@
+package bplustree
+
+import (
+	"errors"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+// filterChunkByteSize is the number of bytes of the Bloom filter a filter page holds.
+const filterChunkByteSize = table.MaxRecordByteSize
+
+// metaSchema is the schema of the metadata page of a tree,
+// the filter page number is the first page of the Bloom filter, or table.InvalidPageNumber without one.
+// The statistics columns hold the statistics ANALYZE saved, if analyzed is true.
+//
+//nolint:gochecknoglobals // The schema is never modified.
+var metaSchema = table.NewSchema().
+	WithField("root_page_number", field.NewInteger()).
+	WithField("height", field.NewInteger()).
+	WithField("filter_page_number", field.NewInteger()).
+	WithField("filter_deletes", field.NewInteger()).
+	WithField("analyzed", field.NewBoolean()).
+	WithField("record_count", field.NewInteger()).
+	WithField("page_count", field.NewInteger()).
+	WithField("statistics_height", field.NewInteger()).
+	WithField("fill_factor", field.NewFloat()).
+	WithField("distinct_keys", field.NewInteger())
+
+// The positions of the statistics columns in metaSchema.
+const (
+	analyzedColumn = iota + 4
+	recordCountColumn
+	pageCountColumn
+	statisticsHeightColumn
+	fillFactorColumn
+	distinctKeysColumn
+)
+
+// filterSchema is the schema of the filter pages, each holds a chunk of the Bloom filter bytes
+// and links to the page of the next chunk.
+//
+//nolint:gochecknoglobals // The schema is never modified.
+var filterSchema = table.NewSchema().
+	WithField("filter", field.NewBinary())
+
+// OpenBPlusTree opens the tree whose metadata page Flush persisted,
+// the Bloom filter is read back from its pages, or rebuilt if it was not persisted.
+func OpenBPlusTree(
+	meta *Metadata,
+	metaPageNumber table.PageNumber,
+	bufferManager memory.BufferManager,
+) (*BPlusTree, error) {
+	if err := meta.init(); err != nil {
+		return nil, err
+	}
+
+	tree := &BPlusTree{meta: meta, bufferManager: bufferManager}
+	p, err := tree.fetchDataPage(metaPageNumber, metaSchema)
+	if err != nil {
+		return nil, err
+	}
+	record := p.Get(0)
+	bufferManager.Unpin(metaPageNumber, false)
+
+	intOf := func(i int) int32 {
+		return record.Get(i).Val().(int32)
+	}
+	meta.metaPageNumber = metaPageNumber
+	meta.rootPageNumber = table.PageNumber(intOf(0))
+	meta.height = uint32(intOf(1))
+	meta.filterPageNumber = table.PageNumber(intOf(2)) //nolint:mnd // the filter page number column.
+	meta.filterDeletes = int(intOf(3))                 //nolint:mnd // the filter deletes column.
+	if analyzed, _ := record.Get(analyzedColumn).Val().(bool); analyzed {
+		meta.statistics = &index.Statistics{
+			Stats: index.Stats{
+				RecordCount: int(intOf(recordCountColumn)),
+				PageCount:   int(intOf(pageCountColumn)),
+				Height:      int(intOf(statisticsHeightColumn)),
+				FillFactor:  float64(record.Get(fillFactorColumn).Val().(float32)),
+			},
+			DistinctKeys: int(intOf(distinctKeysColumn)),
+		}
+	}
+	if meta.FalsePositiveRate <= 0 {
+		meta.filter = nil
+		return tree, nil
+	}
+	if meta.filterPageNumber == table.InvalidPageNumber {
+		return tree, tree.RebuildFilter()
+	}
+	if err = tree.readFilter(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// MetaPageNumber returns the page the metadata of the tree is persisted in.
+func (tree *BPlusTree) MetaPageNumber() table.PageNumber {
+	return tree.meta.metaPageNumber
+}
+
+// Flush persists the metadata of the tree and its Bloom filter in the metadata page and the filter pages,
+// which the buffer manager writes to disk like the other pages.
+func (tree *BPlusTree) Flush() error {
+	if tree.closed.Load() {
+		return ErrClosed
+	}
+
+	if err := tree.writeFilter(); err != nil {
+		return err
+	}
+	return tree.writeMeta()
+}
+
+// SaveStatistics persists the statistics in the metadata page of the tree,
+// which the buffer manager writes to disk like the other pages.
+func (tree *BPlusTree) SaveStatistics(statistics *index.Statistics) error {
+	if tree.closed.Load() {
+		return ErrClosed
+	}
+
+	saved := *statistics
+	tree.meta.statistics = &saved
+	return tree.writeMeta()
+}
+
+// SavedStatistics returns the statistics SaveStatistics persisted, or index.ErrNotAnalyzed if there are none.
+func (tree *BPlusTree) SavedStatistics() (*index.Statistics, error) {
+	if tree.closed.Load() {
+		return nil, ErrClosed
+	}
+	if tree.meta.statistics == nil {
+		return nil, index.ErrNotAnalyzed
+	}
+	saved := *tree.meta.statistics
+	return &saved, nil
+}
+
+// initMetaPage allocates the metadata page of a new tree and writes the metadata in it.
+func (tree *BPlusTree) initMetaPage() error {
+	p := table.NewDataPage(true)
+	if err := tree.bufferManager.ApplyNewPage(tree.meta.tableSpaceID, p); err != nil {
+		return err
+	}
+	p.Append(tree.metaRecord())
+	tree.bufferManager.Unpin(p.PageNumber(), true)
+
+	tree.meta.metaPageNumber = p.PageNumber()
+	return nil
+}
+
+func (tree *BPlusTree) writeMeta() error {
+	p, err := tree.fetchDataPage(tree.meta.metaPageNumber, metaSchema)
+	if err != nil {
+		return err
+	}
+	p.Replace(0, tree.metaRecord())
+	tree.bufferManager.Unpin(p.PageNumber(), true)
+	return nil
+}
+
+func (tree *BPlusTree) metaRecord() *table.Record {
+	meta := tree.meta
+	statistics := meta.statistics
+	if statistics == nil {
+		statistics = &index.Statistics{}
+	}
+	return table.NewRecordFromLiteral(
+		int(meta.rootPageNumber),
+		int(meta.height),
+		int(meta.filterPageNumber),
+		meta.filterDeletes,
+		meta.statistics != nil,
+		statistics.RecordCount,
+		statistics.PageCount,
+		statistics.Height,
+		statistics.FillFactor,
+		statistics.DistinctKeys,
+	)
+}
+
+// writeFilter writes the Bloom filter over the chain of filter pages,
+// reusing the pages of the chain written before, and frees the pages it no longer needs.
+func (tree *BPlusTree) writeFilter() error {
+	var data []byte
+	if tree.meta.filter != nil {
+		var err error
+		if data, err = tree.meta.filter.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+
+	var prev *table.DataPage
+	next := tree.meta.filterPageNumber
+	tree.meta.filterPageNumber = table.InvalidPageNumber
+	for len(data) > 0 {
+		chunk := data[:min(len(data), filterChunkByteSize)]
+		data = data[len(chunk):]
+
+		p, err := tree.nextFilterPage(next, table.NewRecord(field.NewValue(filterSchema.FieldTypes[0], chunk)))
+		if err != nil {
+			if prev != nil {
+				tree.bufferManager.Unpin(prev.PageNumber(), true)
+			}
+			return err
+		}
+		if next != table.InvalidPageNumber {
+			next = p.NextPageNumber()
+		}
+
+		if prev == nil {
+			tree.meta.filterPageNumber = p.PageNumber()
+		} else {
+			prev.SetNext(p.PageNumber())
+			tree.bufferManager.Unpin(prev.PageNumber(), true)
+		}
+		prev = p
+	}
+	if prev != nil {
+		prev.SetNext(table.InvalidPageNumber)
+		tree.bufferManager.Unpin(prev.PageNumber(), true)
+	}
+
+	// The rest of the chain written before holds no chunk any more.
+	for next != table.InvalidPageNumber {
+		p, err := tree.fetchDataPage(next, filterSchema)
+		if err != nil {
+			return err
+		}
+		pageNumber := next
+		next = p.NextPageNumber()
+		tree.bufferManager.Unpin(pageNumber, false)
+		if err = tree.bufferManager.DeletePage(pageNumber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextFilterPage writes the chunk record in the page of the chain written before,
+// or in a new page at the end of the chain. The page is returned pinned.
+func (tree *BPlusTree) nextFilterPage(pageNumber table.PageNumber, record *table.Record) (*table.DataPage, error) {
+	if pageNumber != table.InvalidPageNumber {
+		p, err := tree.fetchDataPage(pageNumber, filterSchema)
+		if err != nil {
+			return nil, err
+		}
+		p.Replace(0, record)
+		return p, nil
+	}
+
+	p := table.NewDataPage(true)
+	p.Append(record)
+	if err := tree.bufferManager.ApplyNewPage(tree.meta.tableSpaceID, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// readFilter reads the Bloom filter back from the chain of filter pages.
+func (tree *BPlusTree) readFilter() error {
+	var data []byte
+	for pageNumber := tree.meta.filterPageNumber; pageNumber != table.InvalidPageNumber; {
+		p, err := tree.fetchDataPage(pageNumber, filterSchema)
+		if err != nil {
+			return err
+		}
+		chunk, _ := p.Get(0).Get(0).Val().([]byte)
+		data = append(data, chunk...)
+		next := p.NextPageNumber()
+		tree.bufferManager.Unpin(pageNumber, false)
+		pageNumber = next
+	}
+
+	filter := &ds.BloomFilter{}
+	if err := filter.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	tree.meta.filter = filter
+	return nil
+}
+
+// fetchDataPage fetches the data page, the caller is responsible for unpinning it.
+func (tree *BPlusTree) fetchDataPage(pageNumber table.PageNumber, schema *table.Schema) (*table.DataPage, error) {
+	p, err := tree.bufferManager.FetchPage(pageNumber, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	dataPage, ok := p.(*table.DataPage)
+	if !ok {
+		tree.bufferManager.Unpin(pageNumber, false)
+		return nil, errors.New("not a data page")
+	}
+	return dataPage, nil
+}
@@ -1,6 +1,7 @@
 package bplustree
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/Huangkai1008/libradb/internal/field"
@@ -9,11 +10,12 @@ import (
 )
 
 type Pair struct {
-	key   Key
+	key   encodedKey
 	value table.PageNumber
 }
 
-func (p Pair) Key() Key {
+// Key returns the memcomparable encoding of the split key.
+func (p Pair) Key() []byte {
 	return p.key
 }
 
@@ -23,6 +25,20 @@ func (p Pair) Value() table.PageNumber {
 
 type Key = field.Value
 
+// encodedKey is the memcomparable encoding of a key.
+//
+// The nodes keep their keys encoded and compare them with bytes.Compare,
+// which is much cheaper than comparing field values.
+type encodedKey []byte
+
+func encodeKey(key Key) encodedKey {
+	return field.EncodeKey(key)
+}
+
+func (k encodedKey) Compare(other encodedKey) int {
+	return bytes.Compare(k, other)
+}
+
 // BPlusNode represents a page in the B+ tree.
 //
 // Pages can be either non-leaf (index/internal) nodes or leaf nodes.
@@ -43,19 +59,49 @@ type BPlusNode interface {
 	// PageNumber returns the page number of the page underlying the node.
 	PageNumber() table.PageNumber
 
+	// get and delete are Get and Delete taking the encoded key,
+	// so that the key is encoded only once on the way down the tree.
+	get(key encodedKey) (*LeafNode, error)
+	delete(key encodedKey) error
+	// write the record fn returns under the key into the subtree rooted by node,
+	// it splits the same way as Put.
+	write(key encodedKey, fn writeFunc) (*Pair, error)
+
 	// isOverflowed returns true if the node is overflowed.
 	isOverflowed() bool
 	// unpin buffer page.
 	unpin(markDirty bool)
 }
 
+// writeFunc returns the record to write under a key given the record stored under it,
+// which is nil if the key is absent. Returning a nil record writes nothing.
+type writeFunc func(old *table.Record) (*table.Record, error)
+
+// insertFunc writes the record if the key is absent.
+func insertFunc(record *table.Record) writeFunc {
+	return func(old *table.Record) (*table.Record, error) {
+		if old != nil {
+			return nil, ErrKeyExists
+		}
+		return record, nil
+	}
+}
+
+// upsertFunc writes the record whether the key is present or not.
+func upsertFunc(record *table.Record) writeFunc {
+	return func(*table.Record) (*table.Record, error) {
+		return record, nil
+	}
+}
+
 // BPlusNodeFrom creates a new B+ tree page.
 func BPlusNodeFrom(
 	pageNumber table.PageNumber,
 	meta *Metadata,
 	buffManager memory.BufferManager,
+	opts ...memory.FetchOption,
 ) (BPlusNode, error) {
-	p, err := buffManager.FetchPage(pageNumber, meta.Schema)
+	p, err := buffManager.FetchPage(pageNumber, meta.Schema, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +117,36 @@ func BPlusNodeFrom(
 	return innerNodeFromPage(meta, buffManager, dataPage), nil
 }
 
-func newIndexRecord(key Key, pageNumber table.PageNumber) *table.Record {
-	return table.NewRecord(key, field.NewValue(field.NewInteger(), int(pageNumber)))
+// comparePrefix compares the key truncated to the length of the bound with the bound,
+// so that every key starting with a composite bound compares equal to it.
+//
+// Since the encoding of each tuple element is prefix-free,
+// the encoding of a key prefix is a byte prefix of the encoding of the key.
+func comparePrefix(key, bound encodedKey) int {
+	return bytes.Compare(key[:min(len(key), len(bound))], bound)
+}
+
+// shortestSeparator returns the shortest key s with left < s <= right,
+// which is the prefix of right one byte longer than the prefix it shares with left.
+//
+// Splits use it as the separator instead of the whole first key of the right node,
+// which keeps the inner nodes small when the keys share long prefixes.
+func shortestSeparator(left, right encodedKey) encodedKey {
+	n := 0
+	for n < len(left) && n < len(right) && left[n] == right[n] {
+		n++
+	}
+	if n == len(right) {
+		return right
+	}
+	return right[: n+1 : n+1]
+}
+
+// newIndexRecord makes the record of an inner page,
+// which stores the encoded key as it is.
+func newIndexRecord(key encodedKey, pageNumber table.PageNumber) *table.Record {
+	return table.NewRecord(
+		field.NewValue(field.NewBinary(), []byte(key)),
+		field.NewValue(field.NewInteger(), int(pageNumber)),
+	)
 }
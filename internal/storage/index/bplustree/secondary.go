@@ -0,0 +1,174 @@
+package bplustree
+
+import (
+	"errors"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var (
+	// ErrDanglingEntry is returned when a secondary index entry
+	// points to a record missing in the clustered tree.
+	ErrDanglingEntry = errors.New("secondary index entry points to a missing record")
+)
+
+type SecondaryIndexOption func(*SecondaryIndex)
+
+// WithUnique makes the secondary index reject duplicate secondary keys.
+func WithUnique(unique bool) SecondaryIndexOption {
+	return func(index *SecondaryIndex) {
+		index.unique = unique
+	}
+}
+
+// WithSecondaryOrder sets the order of the secondary index tree,
+// which defaults to the order of the clustered tree.
+func WithSecondaryOrder(order uint16) SecondaryIndexOption {
+	return func(index *SecondaryIndex) {
+		index.order = order
+	}
+}
+
+// SecondaryIndex indexes the records of a clustered tree on an arbitrary column.
+//
+// Each entry of the secondary index is a (secondary key, primary key) pair,
+// and lookups go back to the clustered tree for the full record.
+// A unique index keys the entries by the secondary key only,
+// so putting a duplicate secondary key fails with ErrKeyExists.
+// A non-unique index keys the entries by the tuple of both keys instead,
+// which tells the records sharing a secondary key apart.
+//
+// The secondary index does not follow the changes of the clustered tree,
+// callers must put and delete the records on both of them.
+type SecondaryIndex struct {
+	clustered *BPlusTree
+	tree      *BPlusTree
+	// column is the position of the indexed column in the clustered records.
+	column int
+	unique bool
+	order  uint16
+	// entryType is the tuple type of the entry keys of a non-unique index.
+	entryType *field.Tuple
+}
+
+func NewSecondaryIndex(
+	clustered *BPlusTree,
+	column int,
+	options ...SecondaryIndexOption,
+) (*SecondaryIndex, error) {
+	schema := clustered.meta.Schema
+	if column < 0 || column >= schema.Length() {
+		return nil, ErrInvalidColumn
+	}
+
+	index := &SecondaryIndex{
+		clustered: clustered,
+		column:    column,
+		order:     clustered.meta.Order,
+	}
+	for _, option := range options {
+		option(index)
+	}
+
+	keyName, keyType := schema.FieldNames[column], schema.FieldTypes[column]
+	pkName, pkType := clustered.meta.key()
+	entrySchema := table.NewSchema()
+	if index.unique {
+		entrySchema.WithField(keyName, keyType).WithField(pkName, pkType)
+	} else {
+		index.entryType = field.NewTuple([]field.Type{keyType, pkType})
+		entrySchema.WithField(keyName+"_"+pkName, index.entryType)
+	}
+
+	tree, err := NewBPlusTree(&Metadata{
+		Order:        index.order,
+		Schema:       entrySchema,
+		tableSpaceID: clustered.meta.tableSpaceID,
+	}, clustered.bufferManager)
+	if err != nil {
+		return nil, err
+	}
+	index.tree = tree
+	return index, nil
+}
+
+// Put adds the entry of the clustered record into the index.
+func (index *SecondaryIndex) Put(record *table.Record) error {
+	key, entry := index.entryOf(record)
+	return index.tree.Put(key, entry)
+}
+
+// Delete removes the entry of the clustered record from the index,
+// or does nothing if the record is not indexed.
+func (index *SecondaryIndex) Delete(record *table.Record) error {
+	key, _ := index.entryOf(record)
+	if index.unique {
+		// The secondary key may be taken by another record.
+		entry, err := index.tree.Get(key)
+		if err != nil || entry == nil || entry.Get(1).Compare(index.clustered.meta.keyOf(record)) != 0 {
+			return err
+		}
+	}
+	return index.tree.Delete(key)
+}
+
+// PrimaryKeys returns the primary keys of the records whose secondary key equals the key,
+// in ascending order.
+func (index *SecondaryIndex) PrimaryKeys(key Key) ([]Key, error) {
+	if index.unique {
+		entry, err := index.tree.Get(key)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		return []Key{entry.Get(1)}, nil
+	}
+
+	var primaryKeys []Key
+	prefix := field.NewValue(index.entryType, []field.Value{key})
+	for entry, err := range index.tree.Range(prefix, nil) {
+		if err != nil {
+			return nil, err
+		}
+
+		values, _ := entry.GetKey().Val().([]field.Value)
+		if values[0].Compare(key) != 0 {
+			break
+		}
+		primaryKeys = append(primaryKeys, values[1])
+	}
+	return primaryKeys, nil
+}
+
+// Get returns the clustered records whose secondary key equals the key,
+// in ascending order of their primary keys.
+func (index *SecondaryIndex) Get(key Key) ([]*table.Record, error) {
+	primaryKeys, err := index.PrimaryKeys(key)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*table.Record, 0, len(primaryKeys))
+	for _, primaryKey := range primaryKeys {
+		record, getErr := index.clustered.Get(primaryKey)
+		if getErr != nil {
+			return nil, getErr
+		}
+		if record == nil {
+			return nil, ErrDanglingEntry
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// entryOf returns the key and the entry of the clustered record in the index.
+func (index *SecondaryIndex) entryOf(record *table.Record) (Key, *table.Record) {
+	secondaryKey, primaryKey := record.Get(index.column), index.clustered.meta.keyOf(record)
+	if index.unique {
+		return secondaryKey, table.NewRecord(secondaryKey, primaryKey)
+	}
+
+	key := field.NewValue(index.entryType, []field.Value{secondaryKey, primaryKey})
+	return key, table.NewRecord(key)
+}
@@ -0,0 +1,188 @@
+package bplustree_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Secondary index", func() {
+	const (
+		nameColumn = 1
+		ageColumn  = 2
+	)
+
+	var clustered *bplustree.BPlusTree
+	var pkType, nameType, ageType field.Type
+
+	put := func(indexes []*bplustree.SecondaryIndex, values ...any) error {
+		record := table.NewRecordFromLiteral(values...)
+		if err := clustered.Put(record.GetKey(), record); err != nil {
+			return err
+		}
+		for _, index := range indexes {
+			if err := index.Put(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	namesOf := func(records []*table.Record) []string {
+		names := make([]string, len(records))
+		for i, record := range records {
+			names[i] = record.Get(nameColumn).Val().(string)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		schema := table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar()).
+			WithField("age", field.NewInteger()).
+			WithField("is_student", field.NewBoolean()).
+			WithField("score", field.NewFloat())
+		pkType, nameType, ageType = field.NewInteger(), field.NewVarchar(), field.NewInteger()
+
+		replacer := memory.NewLRUKReplacer(2)
+		diskManager := disk.NewMemoryDiskManager()
+		bufferManager := memory.NewBufferPool(32, diskManager, replacer)
+		DeferCleanup(bufferManager.Close)
+
+		var err error
+		clustered, err = bplustree.NewBPlusTree(&bplustree.Metadata{
+			Order:  2,
+			Schema: schema,
+		}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should reject an invalid column", func() {
+		_, err := bplustree.NewSecondaryIndex(clustered, 5)
+		Expect(err).To(MatchError(bplustree.ErrInvalidColumn))
+	})
+
+	Describe("Non-unique secondary index", func() {
+		var index *bplustree.SecondaryIndex
+
+		BeforeEach(func() {
+			var err error
+			index, err = bplustree.NewSecondaryIndex(clustered, ageColumn, bplustree.WithSecondaryOrder(1))
+			Expect(err).ToNot(HaveOccurred())
+
+			indexes := []*bplustree.SecondaryIndex{index}
+			Expect(put(indexes, 4, "Alice", 20, true, 90.5)).To(Succeed())
+			Expect(put(indexes, 9, "Bob", 21, false, 85.5)).To(Succeed())
+			Expect(put(indexes, 6, "Charlie", 23, true, 80.5)).To(Succeed())
+			Expect(put(indexes, 2, "David", 23, false, 75.5)).To(Succeed())
+			Expect(put(indexes, 1, "Adam", 23, false, 95.5)).To(Succeed())
+			Expect(put(indexes, 3, "Grace", 20, true, 60.5)).To(Succeed())
+		})
+
+		DescribeTable("should get all records sharing the secondary key",
+			func(age int, expected []string) {
+				records, err := index.Get(field.NewValue(ageType, age))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(namesOf(records)).To(Equal(expected))
+			},
+			Entry("age 20", 20, []string{"Grace", "Alice"}),
+			Entry("age 21", 21, []string{"Bob"}),
+			Entry("age 23", 23, []string{"Adam", "David", "Charlie"}),
+			Entry("missing age", 22, []string{}),
+		)
+
+		It("should return primary keys in ascending order", func() {
+			primaryKeys, err := index.PrimaryKeys(field.NewValue(ageType, 23))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(primaryKeys).To(HaveLen(3))
+			for i, expected := range []int{1, 2, 6} {
+				Expect(primaryKeys[i].Compare(field.NewValue(pkType, expected))).To(BeZero())
+			}
+		})
+
+		It("should keep many duplicates across leaves", func() {
+			for i := 100; i < 150; i++ {
+				Expect(put([]*bplustree.SecondaryIndex{index}, i, fmt.Sprintf("name-%d", i), 30, false, 1.0)).To(Succeed())
+			}
+
+			records, err := index.Get(field.NewValue(ageType, 30))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(records).To(HaveLen(50))
+		})
+
+		It("should reject putting the same record twice", func() {
+			record := table.NewRecordFromLiteral(4, "Alice", 20, true, 90.5)
+			Expect(index.Put(record)).To(MatchError(bplustree.ErrKeyExists))
+		})
+
+		It("should delete only the entry of the record", func() {
+			record := table.NewRecordFromLiteral(2, "David", 23, false, 75.5)
+			Expect(index.Delete(record)).To(Succeed())
+			Expect(clustered.Delete(record.GetKey())).To(Succeed())
+
+			records, err := index.Get(field.NewValue(ageType, 23))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namesOf(records)).To(Equal([]string{"Adam", "Charlie"}))
+		})
+
+		It("should report entries pointing to missing records", func() {
+			Expect(clustered.Delete(field.NewValue(pkType, 9))).To(Succeed())
+
+			_, err := index.Get(field.NewValue(ageType, 21))
+			Expect(err).To(MatchError(bplustree.ErrDanglingEntry))
+		})
+	})
+
+	Describe("Unique secondary index", func() {
+		var index *bplustree.SecondaryIndex
+
+		BeforeEach(func() {
+			var err error
+			index, err = bplustree.NewSecondaryIndex(clustered, nameColumn, bplustree.WithUnique(true))
+			Expect(err).ToNot(HaveOccurred())
+
+			indexes := []*bplustree.SecondaryIndex{index}
+			Expect(put(indexes, 4, "Alice", 20, true, 90.5)).To(Succeed())
+			Expect(put(indexes, 9, "Bob", 21, false, 85.5)).To(Succeed())
+			Expect(put(indexes, 6, "Charlie", 23, true, 80.5)).To(Succeed())
+		})
+
+		It("should get the record by the secondary key", func() {
+			records, err := index.Get(field.NewValue(nameType, "Bob"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namesOf(records)).To(Equal([]string{"Bob"}))
+
+			records, err = index.Get(field.NewValue(nameType, "Eve"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(records).To(BeEmpty())
+		})
+
+		It("should reject duplicate secondary keys", func() {
+			record := table.NewRecordFromLiteral(7, "Alice", 30, false, 70.5)
+			Expect(index.Put(record)).To(MatchError(bplustree.ErrKeyExists))
+		})
+
+		It("should not delete the entry of another record", func() {
+			record := table.NewRecordFromLiteral(7, "Alice", 30, false, 70.5)
+			Expect(index.Delete(record)).To(Succeed())
+
+			records, err := index.Get(field.NewValue(nameType, "Alice"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(namesOf(records)).To(Equal([]string{"Alice"}))
+
+			By("Deleting the entry of the record itself")
+			Expect(index.Delete(table.NewRecordFromLiteral(4, "Alice", 20, true, 90.5))).To(Succeed())
+			records, err = index.Get(field.NewValue(nameType, "Alice"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(records).To(BeEmpty())
+		})
+	})
+})
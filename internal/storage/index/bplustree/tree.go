@@ -5,45 +5,143 @@
 package bplustree
 
 import (
+	"errors"
 	"fmt"
+	"iter"
 	"strings"
+	"sync/atomic"
 
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
 	"github.com/Huangkai1008/libradb/internal/storage/memory"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
 	"github.com/Huangkai1008/libradb/internal/util"
+	"github.com/Huangkai1008/libradb/pkg/ds"
 	"github.com/Huangkai1008/libradb/pkg/typing"
 )
 
+var (
+	// ErrInvalidColumn is returned when the indexed column is out of the schema.
+	ErrInvalidColumn = errors.New("invalid index column")
+	// ErrClosed is returned when using a closed tree.
+	ErrClosed = index.ErrClosed
+)
+
+var (
+	_ index.KeyedIndex       = (*BPlusTree)(nil)
+	_ index.StatisticsKeeper = (*BPlusTree)(nil)
+)
+
 // Metadata of a B+ tree.
 //
 // Each node (except the root node) must have Order ≤ x ≤ 2 * Order entries assuming no deleting happens
 // (it’s possible for leaf nodes to end up with < Order entries if you delete data).
 // The entries within each node must be sorted.
 type Metadata struct {
-	Order        uint16
-	Schema       *table.Schema
+	Order  uint16
+	Schema *table.Schema
+	// KeyColumns are the columns making up a composite key in order,
+	// the first column of the records is the key if it is empty.
+	KeyColumns []KeyColumn
+	// FalsePositiveRate enables a Bloom filter of the keys when positive,
+	// which lets Get and Delete skip the leaves for most absent keys.
+	FalsePositiveRate float64
+	// ExpectedKeys sizes the Bloom filter, DefaultExpectedKeys if zero.
+	// The filter is rebuilt twice as large once more keys are put.
+	ExpectedKeys int
 	tableSpaceID table.SpaceID
-	// rootPageNumber cannot be changed.
+	// metaPageNumber is the page the metadata is persisted in, it cannot be changed.
+	metaPageNumber table.PageNumber
 	rootPageNumber table.PageNumber
 	height         uint32
+
+	// keyName and keyType are the name and tuple type of a composite key.
+	keyName string
+	keyType *field.Tuple
+
+	// filter is the Bloom filter of the keys, nil if disabled.
+	// filterDeletes counts the keys deleted since it was built, whose bits it cannot clear.
+	filter        *ds.BloomFilter
+	filterDeletes int
+	// filterPageNumber is the first page the filter is persisted in.
+	filterPageNumber table.PageNumber
+
+	// statistics are the statistics ANALYZE saved, nil if never analyzed.
+	statistics *index.Statistics
+}
+
+// KeyColumn is a column of a composite key.
+type KeyColumn struct {
+	// Index is the position of the column in the records.
+	Index int
+	Order field.SortOrder
+}
+
+// init validates the key columns and builds the composite key type.
+func (meta *Metadata) init() error {
+	if len(meta.KeyColumns) == 0 || meta.keyType != nil {
+		return nil
+	}
+
+	names := make([]string, len(meta.KeyColumns))
+	types := make([]field.Type, len(meta.KeyColumns))
+	orders := make([]field.SortOrder, len(meta.KeyColumns))
+	for i, column := range meta.KeyColumns {
+		if column.Index < 0 || column.Index >= meta.Schema.Length() {
+			return ErrInvalidColumn
+		}
+		names[i] = meta.Schema.FieldNames[column.Index]
+		types[i] = meta.Schema.FieldTypes[column.Index]
+		orders[i] = column.Order
+	}
+
+	meta.keyName = strings.Join(names, "_")
+	meta.keyType = field.NewTuple(types, field.WithSortOrders(orders...))
+	return nil
 }
 
 func (meta *Metadata) incrHeight() {
 	meta.height++
 }
 
+// keyOf returns the key of the record.
+func (meta *Metadata) keyOf(record *table.Record) Key {
+	if meta.keyType == nil {
+		return record.GetKey()
+	}
+
+	values := make([]field.Value, len(meta.KeyColumns))
+	for i, column := range meta.KeyColumns {
+		values[i] = record.Get(column.Index)
+	}
+	return field.NewValue(meta.keyType, values)
+}
+
+// key returns the name and type of the key.
+func (meta *Metadata) key() (string, field.Type) {
+	if meta.keyType == nil {
+		return meta.Schema.FieldNames[0], meta.Schema.FieldTypes[0]
+	}
+	return meta.keyName, meta.keyType
+}
+
 // BPlusTree is used for indexing.
 //
 // An index tree starts at a root page and has a height.
 // Different from InnoDB, the root page can be updated.
 type BPlusTree struct {
-	meta *Metadata
-	root BPlusNode
+	meta   *Metadata
+	closed atomic.Bool
 
 	bufferManager memory.BufferManager
 }
 
 func NewBPlusTree(meta *Metadata, bufferManager memory.BufferManager) (*BPlusTree, error) {
+	if err := meta.init(); err != nil {
+		return nil, err
+	}
+
 	root, err := NewLeafNode(meta, bufferManager)
 	if err != nil {
 		return nil, err
@@ -52,79 +150,378 @@ func NewBPlusTree(meta *Metadata, bufferManager memory.BufferManager) (*BPlusTre
 
 	tree := &BPlusTree{
 		meta:          meta,
-		root:          root,
 		bufferManager: bufferManager,
 	}
 	tree.updateRoot(root)
+	if meta.FalsePositiveRate > 0 {
+		meta.filter = ds.NewBloomFilter(meta.expectedKeys(), meta.FalsePositiveRate)
+	}
+	if err = tree.initMetaPage(); err != nil {
+		return nil, err
+	}
 
 	return tree, nil
 }
 
+// NewFactory returns the factory of the trees of the order in an index catalog,
+// keyed by the first column of the records.
+func NewFactory(order uint16) index.Factory {
+	return func(_ string, schema *table.Schema, bufferManager memory.BufferManager) (index.Index, error) {
+		return NewBPlusTree(&Metadata{Order: order, Schema: schema}, bufferManager)
+	}
+}
+
 func (tree *BPlusTree) Get(key Key) (*table.Record, error) {
-	leafNode, err := tree.getLeafNode(key)
+	if tree.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	k := encodeKey(key)
+	if !tree.mayContain(k) {
+		return nil, nil //nolint:nilnil // nil is returned to indicate the key is absent.
+	}
+
+	leafNode, err := tree.getLeafNode(k)
 	if err != nil {
 		return nil, err
 	}
 
-	record := leafNode.GetRecord(key)
+	record := leafNode.getRecord(k)
 	leafNode.unpin(false)
 	return record, nil
 }
 
 func (tree *BPlusTree) Put(key Key, record *table.Record) error {
-	pair, err := tree.root.Put(key, record)
+	return tree.write(encodeKey(key), insertFunc(record))
+}
+
+// Upsert puts the record if the key is absent, otherwise replaces the record of the key.
+func (tree *BPlusTree) Upsert(key Key, record *table.Record) error {
+	return tree.write(encodeKey(key), upsertFunc(record))
+}
+
+// Update replaces the record of the key with the record fn returns, in its leaf page.
+// It returns ErrKeyNotFound if the key is absent.
+//
+// The record fn returns must keep the key, otherwise ErrKeyChanged is returned,
+// and returning nil leaves the record as it is.
+// If the new record no longer fits in the leaf page, the leaf splits to relocate it.
+func (tree *BPlusTree) Update(key Key, fn func(*table.Record) *table.Record) error {
+	k := encodeKey(key)
+	return tree.write(k, func(old *table.Record) (*table.Record, error) {
+		if old == nil {
+			return nil, ErrKeyNotFound
+		}
+
+		record := fn(old)
+		if record != nil && encodeKey(tree.meta.keyOf(record)).Compare(k) != 0 {
+			return nil, ErrKeyChanged
+		}
+		return record, nil
+	})
+}
+
+// write the record fn returns under the key, and grows a new root if the root splits.
+func (tree *BPlusTree) write(key encodedKey, fn writeFunc) error {
+	if tree.closed.Load() {
+		return ErrClosed
+	}
+
+	root, err := tree.fetchRoot()
+	if err != nil {
+		return err
+	}
+
+	inserted := false
+	pair, err := root.write(key, func(old *table.Record) (*table.Record, error) {
+		record, fnErr := fn(old)
+		inserted = fnErr == nil && old == nil && record != nil
+		return record, fnErr
+	})
 	if err != nil {
 		return err
 	}
+	if inserted {
+		if err = tree.addToFilter(key); err != nil {
+			return err
+		}
+	}
 
 	if pair == nil {
 		return nil
 	}
 
 	records := []*table.Record{
-		newIndexRecord(pair.Key(), tree.root.PageNumber()),
-		newIndexRecord(pair.Key(), pair.Value()),
+		newIndexRecord(pair.key, root.PageNumber()),
+		newIndexRecord(pair.key, pair.Value()),
 	}
-	root, nodeError := NewInnerNode(
+	newRoot, err := NewInnerNode(
 		tree.meta, tree.bufferManager, WithIndexRecords(records),
 	)
-	if nodeError != nil {
-		return nodeError
+	if err != nil {
+		return err
 	}
 
-	root.unpin(true)
-	tree.updateRoot(root)
+	newRoot.unpin(true)
+	tree.updateRoot(newRoot)
 	return nil
 }
 
 func (tree *BPlusTree) Delete(key Key) error {
-	return tree.root.Delete(key)
+	if tree.closed.Load() {
+		return ErrClosed
+	}
+
+	k := encodeKey(key)
+	if !tree.mayContain(k) {
+		return nil
+	}
+
+	leaf, err := tree.getLeafNode(k)
+	if err != nil {
+		return err
+	}
+	removed := leaf.getRecord(k) != nil
+	if err = leaf.delete(k); err != nil {
+		return err
+	}
+	if !removed {
+		return nil
+	}
+	return tree.removeFromFilter()
 }
 
+// Scan returns an iterator positioned at the key.
+//
+// The iterator must be closed after use to unpin the leaf it stays on.
 func (tree *BPlusTree) Scan(key Key) typing.BacktrackingIterator[*table.Record] {
-	leftMostLeaf, err := tree.getLeafNode(key)
+	return tree.scan(key)
+}
+
+func (tree *BPlusTree) scan(key Key) *RecordIterator {
+	if tree.closed.Load() {
+		return newErrRecordIterator(ErrClosed)
+	}
+
+	k := encodeKey(key)
+	leftMostLeaf, err := tree.getLeafNode(k)
 	if err != nil {
-		return nil
+		return newErrRecordIterator(err)
 	}
 
-	index := util.InsertIndex(key, leftMostLeaf.keys)
+	index := util.InsertIndex(k, leftMostLeaf.keys)
 	return NewRecordIterator(leftMostLeaf, index)
 }
 
+// All returns a sequence of all the records in ascending key order.
+func (tree *BPlusTree) All() iter.Seq2[*table.Record, error] {
+	return tree.Range(nil, nil)
+}
+
+// Range returns a sequence of the records whose key lies in [lo, hi),
+// in ascending key order.
+// A nil lo or hi leaves the corresponding side of the range unbounded.
+//
+// Breaking out of the loop early unpins the leaf the scan stays on.
+func (tree *BPlusTree) Range(lo, hi Key) iter.Seq2[*table.Record, error] {
+	return func(yield func(*table.Record, error) bool) {
+		if tree.closed.Load() {
+			yield(nil, ErrClosed)
+			return
+		}
+
+		var it *RecordIterator
+		if lo == nil {
+			leaf, err := tree.edgeLeaf(true)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			it = NewRecordIterator(leaf, 0)
+		} else {
+			it = tree.scan(lo)
+		}
+		defer it.Close()
+
+		var hiKey encodedKey
+		if hi != nil {
+			hiKey = encodeKey(hi)
+		}
+		for record := it.Next(); record != nil; record = it.Next() {
+			if hi != nil && encodeKey(tree.meta.keyOf(record)).Compare(hiKey) >= 0 {
+				return
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// ScanRange returns a sequence of the records whose key lies in [lo, hi],
+// in ascending key order.
+// Both bounds are matched as key prefixes, so a bound made of the leading columns
+// of a composite key covers every key starting with them,
+// e.g. ScanRange((5), (5)) yields all the records where a = 5 under the key (a, b).
+// A nil lo or hi leaves the corresponding side of the range unbounded.
+func (tree *BPlusTree) ScanRange(lo, hi Key) iter.Seq2[*table.Record, error] {
+	return func(yield func(*table.Record, error) bool) {
+		var hiKey encodedKey
+		if hi != nil {
+			hiKey = encodeKey(hi)
+		}
+		for record, err := range tree.Range(lo, nil) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if hi != nil && comparePrefix(encodeKey(tree.meta.keyOf(record)), hiKey) > 0 {
+				return
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns a sequence of all the records in descending key order.
+//
+// Breaking out of the loop early unpins the leaf the scan stays on.
+func (tree *BPlusTree) Backward() iter.Seq2[*table.Record, error] {
+	return func(yield func(*table.Record, error) bool) {
+		if tree.closed.Load() {
+			yield(nil, ErrClosed)
+			return
+		}
+
+		leaf, err := tree.edgeLeaf(false)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		it := NewRecordIterator(leaf, len(leaf.keys))
+		defer it.Close()
+
+		for record := it.Prev(); record != nil; record = it.Prev() {
+			if !yield(record, nil) {
+				return
+			}
+		}
+		if err = it.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Stats returns the statistics of the tree by walking every node of it.
+func (tree *BPlusTree) Stats() (*index.Stats, error) {
+	if tree.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	report, err := tree.Verify()
+	if err != nil {
+		return nil, err
+	}
+	return &index.Stats{
+		RecordCount: report.RecordCount,
+		PageCount:   report.InnerNodes + report.LeafNodes,
+		Height:      int(report.Height),
+		FillFactor:  float64(report.LeafByteSize) / float64(report.LeafNodes*config.PageSize),
+	}, nil
+}
+
+// Close the tree after flushing its metadata, using it afterwards returns ErrClosed.
+// The pages of the tree stay in the buffer manager.
+func (tree *BPlusTree) Close() error {
+	if tree.closed.Load() {
+		return nil
+	}
+	err := tree.Flush()
+	tree.closed.Store(true)
+	return err
+}
+
+// NewKey makes a key of the tree from the values of its key columns.
+// Passing fewer values than the key columns makes a key prefix,
+// which sorts before every key starting with it.
+func (tree *BPlusTree) NewKey(values ...field.Value) Key {
+	if tree.meta.keyType == nil {
+		return values[0]
+	}
+	return field.NewValue(tree.meta.keyType, values)
+}
+
+// KeyOf returns the key of the record, made of its key columns.
+func (tree *BPlusTree) KeyOf(record *table.Record) Key {
+	return tree.meta.keyOf(record)
+}
+
 func (tree *BPlusTree) String() string {
 	var buffer strings.Builder
 	buffer.WriteString("BPlusTree(")
-	buffer.WriteString(fmt.Sprintf("root=%v", tree.root))
+	root, err := tree.fetchRoot()
+	if err != nil {
+		buffer.WriteString(fmt.Sprintf("err=%v", err))
+	} else {
+		buffer.WriteString(fmt.Sprintf("root=%v", root))
+		root.unpin(false)
+	}
 	buffer.WriteString(")")
 	return buffer.String()
 }
 
 func (tree *BPlusTree) updateRoot(newRoot BPlusNode) {
-	tree.root = newRoot
 	tree.meta.rootPageNumber = newRoot.PageNumber()
 	tree.meta.incrHeight()
 }
 
-func (tree *BPlusTree) getLeafNode(key Key) (*LeafNode, error) {
-	return tree.root.Get(key)
+// fetchRoot fetches the root node from the buffer manager,
+// the caller is responsible for unpinning it.
+//
+// The root is always fetched by page number rather than cached,
+// since the root page may have been evicted and read back.
+func (tree *BPlusTree) fetchRoot() (BPlusNode, error) {
+	return BPlusNodeFrom(tree.meta.rootPageNumber, tree.meta, tree.bufferManager)
+}
+
+// edgeLeaf returns the left-most leaf if leftmost is true,
+// otherwise the right-most leaf. The returned leaf is pinned.
+func (tree *BPlusTree) edgeLeaf(leftmost bool) (*LeafNode, error) {
+	node, err := tree.fetchRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch n := node.(type) {
+		case *LeafNode:
+			return n, nil
+		case *InnerNode:
+			childIndex := 0
+			if !leftmost {
+				childIndex = len(n.children) - 1
+			}
+			n.unpin(false)
+			if node, err = BPlusNodeFrom(n.getChild(childIndex), tree.meta, tree.bufferManager); err != nil {
+				return nil, err
+			}
+		default:
+			node.unpin(false)
+			return nil, ErrNotLeafNode
+		}
+	}
+}
+
+func (tree *BPlusTree) getLeafNode(key encodedKey) (*LeafNode, error) {
+	root, err := tree.fetchRoot()
+	if err != nil {
+		return nil, err
+	}
+	return root.get(key)
 }
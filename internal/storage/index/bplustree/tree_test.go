@@ -2,6 +2,9 @@ package bplustree_test
 
 import (
 	"fmt"
+	"iter"
+	"math"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
@@ -9,6 +12,7 @@ import (
 
 	"github.com/Huangkai1008/libradb/internal/field"
 	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
 	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
 	"github.com/Huangkai1008/libradb/internal/storage/memory"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
@@ -146,7 +150,7 @@ var _ = Describe("B+ Tree Index", Ordered, func() {
 		When("Delete non-existing key in tree", func() {
 			It("should do nothing", func() {
 				By("Put a key in tree")
-				record := table.NewRecordFromLiteral()
+				record := table.NewRecordFromLiteral(4, "Alice", 20, true, 90.5)
 				err := tree.Put(field.NewValue(pkType, 4), record)
 				Expect(err).ToNot(HaveOccurred())
 
@@ -282,6 +286,508 @@ var _ = Describe("B+ Tree Index", Ordered, func() {
 		})
 	})
 
+	Describe("Scan a tree bigger than the buffer pool", func() {
+		const recordCount = 200
+
+		BeforeEach(func() {
+			replacer := memory.NewLRUKReplacer(2)
+			diskManager := disk.NewMemoryDiskManager()
+			bufferManager = memory.NewBufferPool(16, diskManager, replacer)
+			DeferCleanup(bufferManager.Close)
+
+			tree, _ = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  2,
+				Schema: schema,
+			}, bufferManager)
+
+			for i := 0; i < recordCount; i++ {
+				record := table.NewRecordFromLiteral(i, fmt.Sprintf("name-%d", i), i, i%2 == 0, float64(i))
+				Expect(tree.Put(field.NewValue(pkType, i), record)).To(Succeed())
+			}
+		})
+
+		It("should iterate all the records", func() {
+			for round := 0; round < 3; round++ {
+				By(fmt.Sprintf("Scan all records in round %d", round))
+				iterator := tree.Scan(field.NewValue(pkType, 0))
+				count := 0
+				for record := iterator.Next(); record != nil; record = iterator.Next() {
+					Expect(record.GetKey()).To(Equal(field.NewValue(pkType, count)))
+					count++
+				}
+				Expect(iterator.Err()).ToNot(HaveOccurred())
+				Expect(iterator.Close()).To(Succeed())
+				Expect(count).To(Equal(recordCount))
+			}
+		})
+
+		It("should iterate all the records backward", func() {
+			iterator := tree.Scan(field.NewValue(pkType, recordCount))
+			count := 0
+			for record := iterator.Prev(); record != nil; record = iterator.Prev() {
+				count++
+				Expect(record.GetKey()).To(Equal(field.NewValue(pkType, recordCount-count)))
+			}
+			Expect(iterator.Err()).ToNot(HaveOccurred())
+			Expect(iterator.Close()).To(Succeed())
+			Expect(count).To(Equal(recordCount))
+		})
+	})
+
+	Describe("Range over B+ tree", func() {
+		const recordCount = 100
+
+		keysOf := func(seq iter.Seq2[*table.Record, error]) []int {
+			var keys []int
+			for record, err := range seq {
+				Expect(err).ToNot(HaveOccurred())
+				keys = append(keys, int(record.GetKey().Val().(int32)))
+			}
+			return keys
+		}
+
+		BeforeEach(func() {
+			replacer := memory.NewLRUKReplacer(2)
+			diskManager := disk.NewMemoryDiskManager()
+			bufferManager = memory.NewBufferPool(16, diskManager, replacer)
+			DeferCleanup(bufferManager.Close)
+
+			tree, _ = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  2,
+				Schema: schema,
+			}, bufferManager)
+
+			for i := recordCount - 1; i >= 0; i-- {
+				record := table.NewRecordFromLiteral(i, fmt.Sprintf("name-%d", i), i, i%2 == 0, float64(i))
+				Expect(tree.Put(field.NewValue(pkType, i), record)).To(Succeed())
+			}
+		})
+
+		It("should iterate all records in ascending order", func() {
+			keys := keysOf(tree.All())
+			Expect(keys).To(HaveLen(recordCount))
+			for i, key := range keys {
+				Expect(key).To(Equal(i))
+			}
+		})
+
+		It("should iterate all records in descending order", func() {
+			keys := keysOf(tree.Backward())
+			Expect(keys).To(HaveLen(recordCount))
+			for i, key := range keys {
+				Expect(key).To(Equal(recordCount - 1 - i))
+			}
+		})
+
+		DescribeTable("should iterate records in the range",
+			func(lo, hi *int, expected []int) {
+				var loKey, hiKey bplustree.Key
+				if lo != nil {
+					loKey = field.NewValue(pkType, *lo)
+				}
+				if hi != nil {
+					hiKey = field.NewValue(pkType, *hi)
+				}
+				Expect(keysOf(tree.Range(loKey, hiKey))).To(Equal(expected))
+			},
+			Entry("bounded", ptr(10), ptr(15), []int{10, 11, 12, 13, 14}),
+			Entry("unbounded lo", nil, ptr(3), []int{0, 1, 2}),
+			Entry("unbounded hi", ptr(97), nil, []int{97, 98, 99}),
+			Entry("empty", ptr(50), ptr(50), nil),
+			Entry("out of range", ptr(200), nil, nil),
+		)
+
+		It("should release pinned pages when breaking early", func() {
+			for round := 0; round < 100; round++ {
+				for record, err := range tree.Range(field.NewValue(pkType, round%recordCount), nil) {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(record).ToNot(BeNil())
+					break
+				}
+				for record, err := range tree.Backward() {
+					Expect(err).ToNot(HaveOccurred())
+					Expect(record).ToNot(BeNil())
+					break
+				}
+			}
+
+			Expect(keysOf(tree.All())).To(HaveLen(recordCount))
+		})
+	})
+
+	Describe("Update and upsert in B+ tree", func() {
+		newRecord := func(key int, name string) *table.Record {
+			return table.NewRecordFromLiteral(key, name, key, key%2 == 0, float64(key))
+		}
+
+		nameOf := func(key int) string {
+			record, err := tree.Get(field.NewValue(pkType, key))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+			return record.Get(1).Val().(string)
+		}
+
+		BeforeEach(func() {
+			replacer := memory.NewLRUKReplacer(2)
+			diskManager := disk.NewMemoryDiskManager()
+			bufferManager = memory.NewBufferPool(16, diskManager, replacer)
+			DeferCleanup(bufferManager.Close)
+
+			tree, _ = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  50,
+				Schema: schema,
+			}, bufferManager)
+			for i := 0; i < 20; i++ {
+				Expect(tree.Put(field.NewValue(pkType, i), newRecord(i, fmt.Sprintf("name-%d", i)))).To(Succeed())
+			}
+		})
+
+		It("should insert or replace the record with upsert", func() {
+			Expect(tree.Upsert(field.NewValue(pkType, 5), newRecord(5, "Alice"))).To(Succeed())
+			Expect(tree.Upsert(field.NewValue(pkType, 100), newRecord(100, "Bob"))).To(Succeed())
+
+			Expect(nameOf(5)).To(Equal("Alice"))
+			Expect(nameOf(100)).To(Equal("Bob"))
+			report, err := tree.Verify()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.RecordCount).To(Equal(21))
+		})
+
+		It("should update the record in its leaf page", func() {
+			err := tree.Update(field.NewValue(pkType, 7), func(old *table.Record) *table.Record {
+				return newRecord(7, old.Get(1).Val().(string)+"-updated")
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(nameOf(7)).To(Equal("name-7-updated"))
+			report, err := tree.Verify()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.LeafNodes).To(Equal(1))
+		})
+
+		It("should leave the record as it is when the update returns nil", func() {
+			err := tree.Update(field.NewValue(pkType, 7), func(*table.Record) *table.Record {
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(nameOf(7)).To(Equal("name-7"))
+		})
+
+		It("should reject updating a missing key", func() {
+			err := tree.Update(field.NewValue(pkType, 100), func(old *table.Record) *table.Record {
+				return old
+			})
+			Expect(err).To(MatchError(bplustree.ErrKeyNotFound))
+		})
+
+		It("should reject an update changing the key", func() {
+			err := tree.Update(field.NewValue(pkType, 7), func(*table.Record) *table.Record {
+				return newRecord(8, "Eve")
+			})
+			Expect(err).To(MatchError(bplustree.ErrKeyChanged))
+			Expect(nameOf(7)).To(Equal("name-7"))
+		})
+
+		It("should relocate records no longer fitting in the page", func() {
+			longName := func(key int) string {
+				return fmt.Sprintf("%d-%s", key, strings.Repeat("x", 400))
+			}
+			for _, key := range []int{3, 4, 10, 11, 12, 19} {
+				err := tree.Update(field.NewValue(pkType, key), func(*table.Record) *table.Record {
+					return newRecord(key, longName(key))
+				})
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			report, err := tree.Verify()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OK()).To(BeTrue(), report.String())
+			Expect(report.LeafNodes).To(BeNumerically(">", 1))
+			Expect(report.RecordCount).To(Equal(20))
+
+			By("Reading the pages back from disk")
+			for i := 100; i < 1100; i++ {
+				Expect(tree.Put(field.NewValue(pkType, i), newRecord(i, "filler"))).To(Succeed())
+			}
+			for _, key := range []int{3, 4, 10, 11, 12, 19} {
+				Expect(nameOf(key)).To(Equal(longName(key)))
+			}
+			Expect(nameOf(5)).To(Equal("name-5"))
+		})
+
+		It("should reject a record larger than a page takes", func() {
+			err := tree.Upsert(field.NewValue(pkType, 7), newRecord(7, strings.Repeat("x", 1000)))
+			Expect(err).To(MatchError(bplustree.ErrRecordTooLarge))
+			Expect(nameOf(7)).To(Equal("name-7"))
+		})
+	})
+
+	Describe("Encoded keys", func() {
+		It("should order negative integer keys before positive ones", func() {
+			tree, _ = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  2,
+				Schema: schema,
+			}, bufferManager)
+			for _, i := range []int{3, -1, 0, -1000, 7, math.MinInt32, 1000, -7, math.MaxInt32} {
+				record := table.NewRecordFromLiteral(i, fmt.Sprintf("name-%d", i), i, false, float64(i))
+				Expect(tree.Put(field.NewValue(pkType, i), record)).To(Succeed())
+			}
+
+			var keys []int
+			for record, err := range tree.All() {
+				Expect(err).ToNot(HaveOccurred())
+				keys = append(keys, int(record.GetKey().Val().(int32)))
+			}
+			Expect(keys).To(Equal([]int{math.MinInt32, -1000, -7, -1, 0, 3, 7, 1000, math.MaxInt32}))
+		})
+
+		It("should order varchar keys byte-wise", func() {
+			nameSchema := table.NewSchema().
+				WithField("name", field.NewVarchar()).
+				WithField("age", field.NewInteger())
+			tree, _ = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  1,
+				Schema: nameSchema,
+			}, bufferManager)
+			for i, name := range []string{"b", "a\x00", "ab", "", "a", "a\x00b", "\x00"} {
+				Expect(tree.Put(field.NewValue(field.NewVarchar(), name), table.NewRecordFromLiteral(name, i))).To(Succeed())
+			}
+
+			var names []string
+			for record, err := range tree.All() {
+				Expect(err).ToNot(HaveOccurred())
+				names = append(names, record.GetKey().Val().(string))
+			}
+			Expect(names).To(Equal([]string{"", "\x00", "a", "a\x00", "a\x00b", "ab", "b"}))
+
+			record, err := tree.Get(field.NewValue(field.NewVarchar(), "a\x00"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record.Get(1).Val()).To(BeEquivalentTo(1))
+		})
+
+		It("should find keys sharing long prefixes through truncated separators", func() {
+			By("Using a small buffer pool to write the compressed pages out")
+			bufferManager = memory.NewBufferPool(16, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+			DeferCleanup(bufferManager.Close)
+
+			urlSchema := table.NewSchema().
+				WithField("url", field.NewVarchar()).
+				WithField("visits", field.NewInteger())
+			tree, _ = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  2,
+				Schema: urlSchema,
+			}, bufferManager)
+
+			urlType := field.NewVarchar()
+			url := func(i int) string {
+				return fmt.Sprintf("https://example.com/%d/articles/%d", i%7, i)
+			}
+			for i := 0; i < 200; i++ {
+				Expect(tree.Put(field.NewValue(urlType, url(i)), table.NewRecordFromLiteral(url(i), i))).To(Succeed())
+			}
+
+			for i := 0; i < 200; i++ {
+				record, err := tree.Get(field.NewValue(urlType, url(i)))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(record).ToNot(BeNil())
+				Expect(record.Get(1).Val()).To(BeEquivalentTo(i))
+			}
+			record, err := tree.Get(field.NewValue(urlType, "https://example.com/1/articles/"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record).To(BeNil())
+
+			var prev string
+			count := 0
+			for record, err := range tree.All() {
+				Expect(err).ToNot(HaveOccurred())
+				key := record.GetKey().Val().(string)
+				Expect(key > prev || count == 0).To(BeTrue())
+				prev = key
+				count++
+			}
+			Expect(count).To(Equal(200))
+		})
+
+		It("should split the inner nodes holding long keys by bytes", func() {
+			const keyCount = 4000
+			idSchema := table.NewSchema().WithField("id", field.NewVarchar())
+			tree, _ = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  60,
+				Schema: idSchema,
+			}, bufferManager)
+			// The keys of a group share a long prefix, so the separators between them cannot be shortened.
+			keyOf := func(i int) string {
+				return fmt.Sprintf("%05d-%s-%05d", i/40, strings.Repeat("p", 150), i)
+			}
+			for i := 0; i < keyCount; i++ {
+				key := keyOf((i * 7) % keyCount)
+				Expect(tree.Put(field.NewValue(field.NewVarchar(), key), table.NewRecordFromLiteral(key))).To(Succeed())
+			}
+			// Writing a page holding more records than fit panics.
+			Expect(bufferManager.FlushAll()).To(Succeed())
+
+			report, err := tree.Verify()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OK()).To(BeTrue(), report.String())
+			Expect(report.RecordCount).To(Equal(keyCount))
+			Expect(report.Height).To(BeNumerically(">", 2))
+			for i := 0; i < keyCount; i++ {
+				record, getErr := tree.Get(field.NewValue(field.NewVarchar(), keyOf(i)))
+				Expect(getErr).ToNot(HaveOccurred())
+				Expect(record).ToNot(BeNil())
+			}
+		})
+	})
+
+	Describe("Composite key", func() {
+		var compositeSchema *table.Schema
+		var aType, bType field.Type
+
+		keysOf := func(seq iter.Seq2[*table.Record, error]) [][2]int {
+			var keys [][2]int
+			for record, err := range seq {
+				Expect(err).ToNot(HaveOccurred())
+				keys = append(keys, [2]int{
+					int(record.Get(1).Val().(int32)),
+					int(record.Get(2).Val().(int32)),
+				})
+			}
+			return keys
+		}
+
+		BeforeEach(func() {
+			compositeSchema = table.NewSchema().
+				WithField("id", field.NewInteger()).
+				WithField("a", field.NewInteger()).
+				WithField("b", field.NewInteger()).
+				WithField("name", field.NewVarchar())
+			aType, bType = field.NewInteger(), field.NewInteger()
+
+			replacer := memory.NewLRUKReplacer(2)
+			diskManager := disk.NewMemoryDiskManager()
+			bufferManager = memory.NewBufferPool(16, diskManager, replacer)
+			DeferCleanup(bufferManager.Close)
+
+			var err error
+			tree, err = bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:  2,
+				Schema: compositeSchema,
+				KeyColumns: []bplustree.KeyColumn{
+					{Index: 1, Order: field.ASC},
+					{Index: 2, Order: field.DESC},
+				},
+			}, bufferManager)
+			Expect(err).ToNot(HaveOccurred())
+
+			id := 0
+			for a := 0; a < 10; a++ {
+				for b := 0; b < 10; b++ {
+					record := table.NewRecordFromLiteral(id, a, b, fmt.Sprintf("name-%d-%d", a, b))
+					key := tree.NewKey(field.NewValue(aType, a), field.NewValue(bType, b))
+					Expect(tree.Put(key, record)).To(Succeed())
+					id++
+				}
+			}
+		})
+
+		It("should reject invalid key columns", func() {
+			_, err := bplustree.NewBPlusTree(&bplustree.Metadata{
+				Order:      2,
+				Schema:     compositeSchema,
+				KeyColumns: []bplustree.KeyColumn{{Index: 4}},
+			}, bufferManager)
+			Expect(err).To(MatchError(bplustree.ErrInvalidColumn))
+		})
+
+		It("should reject duplicate composite keys", func() {
+			record := table.NewRecordFromLiteral(1000, 3, 4, "duplicate")
+			key := tree.NewKey(field.NewValue(aType, 3), field.NewValue(bType, 4))
+			Expect(tree.Put(key, record)).To(MatchError(bplustree.ErrKeyExists))
+		})
+
+		It("should get a record by the composite key", func() {
+			record, err := tree.Get(tree.NewKey(field.NewValue(aType, 7), field.NewValue(bType, 3)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record.Get(3).Val()).To(Equal("name-7-3"))
+		})
+
+		It("should order keys by each column's sort order", func() {
+			keys := keysOf(tree.All())
+			Expect(keys).To(HaveLen(100))
+			Expect(keys[0]).To(Equal([2]int{0, 9}))
+			Expect(keys[9]).To(Equal([2]int{0, 0}))
+			Expect(keys[10]).To(Equal([2]int{1, 9}))
+			Expect(keys[99]).To(Equal([2]int{9, 0}))
+		})
+
+		It("should scan the records sharing a key prefix", func() {
+			prefix := tree.NewKey(field.NewValue(aType, 5))
+			keys := keysOf(tree.ScanRange(prefix, prefix))
+			Expect(keys).To(HaveLen(10))
+			for i, key := range keys {
+				Expect(key).To(Equal([2]int{5, 9 - i}))
+			}
+		})
+
+		It("should scan the records between key prefixes", func() {
+			keys := keysOf(tree.ScanRange(
+				tree.NewKey(field.NewValue(aType, 3)),
+				tree.NewKey(field.NewValue(aType, 4)),
+			))
+			Expect(keys).To(HaveLen(20))
+			Expect(keys[0]).To(Equal([2]int{3, 9}))
+			Expect(keys[19]).To(Equal([2]int{4, 0}))
+		})
+
+		It("should scan the records between full keys", func() {
+			keys := keysOf(tree.ScanRange(
+				tree.NewKey(field.NewValue(aType, 3), field.NewValue(bType, 2)),
+				tree.NewKey(field.NewValue(aType, 4), field.NewValue(bType, 8)),
+			))
+			Expect(keys).To(Equal([][2]int{{3, 2}, {3, 1}, {3, 0}, {4, 9}, {4, 8}}))
+		})
+
+		It("should scan with unbounded sides", func() {
+			Expect(keysOf(tree.ScanRange(nil, tree.NewKey(field.NewValue(aType, 0))))).To(HaveLen(10))
+			Expect(keysOf(tree.ScanRange(tree.NewKey(field.NewValue(aType, 9)), nil))).To(HaveLen(10))
+		})
+	})
+
+	Describe("Statistics of B+ tree", func() {
+		It("should persist the saved statistics in the metadata page", func() {
+			diskManager := keptDiskManager{disk.NewMemoryDiskManager()}
+			pool := memory.NewBufferPool(64, diskManager, memory.NewLRUKReplacer(2))
+			newMeta := func() *bplustree.Metadata {
+				return &bplustree.Metadata{Order: 4, Schema: schema}
+			}
+			tree, err := bplustree.NewBPlusTree(newMeta(), pool)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tree.SavedStatistics()
+			Expect(err).To(MatchError(index.ErrNotAnalyzed))
+
+			for key := 0; key < 100; key++ {
+				record := table.NewRecordFromLiteral(key, "name", 20, true, 90.5)
+				Expect(tree.Put(field.NewValue(pkType, key), record)).To(Succeed())
+			}
+			statistics, err := index.Analyze(tree)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tree.SaveStatistics(statistics)).To(Succeed())
+			Expect(tree.Close()).To(Succeed())
+			Expect(pool.Close()).To(Succeed())
+
+			pool = memory.NewBufferPool(64, diskManager, memory.NewLRUKReplacer(2))
+			DeferCleanup(pool.Close)
+			reopened, err := bplustree.OpenBPlusTree(newMeta(), tree.MetaPageNumber(), pool)
+			Expect(err).ToNot(HaveOccurred())
+			saved, err := reopened.SavedStatistics()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(saved.FillFactor).To(BeNumerically("~", statistics.FillFactor, 1e-6))
+			saved.FillFactor = statistics.FillFactor
+			Expect(saved).To(Equal(statistics))
+			Expect(saved.RecordCount).To(Equal(100))
+		})
+	})
+
 	Describe("WhiteBox test", func() {
 
 		BeforeEach(func() {
@@ -436,6 +942,10 @@ var _ = Describe("B+ Tree Index", Ordered, func() {
 	})
 })
 
+func ptr[T any](v T) *T {
+	return &v
+}
+
 func TestBPlusTree(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "B+ Tree Suite")
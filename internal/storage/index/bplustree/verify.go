@@ -0,0 +1,241 @@
+package bplustree
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// minInnerByteSize is the fewest bytes an inner node split for its long keys keeps.
+// It splits a page overflowed by a record into two sides of as close bytes as possible,
+// and a record takes no more than table.MaxRecordByteSize.
+const minInnerByteSize = (config.PageSize - table.MaxRecordByteSize) / 2
+
+// ViolationKind is the kind of invariant a B+ tree violates.
+type ViolationKind uint8
+
+const (
+	// UnsortedKeys means the keys of a node are not strictly ascending.
+	UnsortedKeys ViolationKind = iota + 1
+	// SeparatorBounds means a key lies outside the range the separators of its ancestors give it.
+	SeparatorBounds
+	// LeafDepth means a leaf is not at the depth equal to the height of the tree.
+	LeafDepth
+	// LeafLink means the prev and next links of adjacent leaves do not agree.
+	LeafLink
+	// Occupancy means a node holds more than 2 * Order keys or does not fit in its page,
+	// or an inner node holds fewer than Order keys in less than minInnerByteSize bytes.
+	Occupancy
+)
+
+func (kind ViolationKind) String() string {
+	switch kind {
+	case UnsortedKeys:
+		return "unsorted keys"
+	case SeparatorBounds:
+		return "separator bounds"
+	case LeafDepth:
+		return "leaf depth"
+	case LeafLink:
+		return "leaf link"
+	case Occupancy:
+		return "occupancy"
+	default:
+		return fmt.Sprintf("ViolationKind(%d)", kind)
+	}
+}
+
+// Violation is an invariant violated by a node of a B+ tree.
+type Violation struct {
+	Kind       ViolationKind
+	PageNumber table.PageNumber
+	Message    string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v at page %d: %s", v.Kind, v.PageNumber, v.Message)
+}
+
+// VerifyReport is the result of verifying a B+ tree.
+type VerifyReport struct {
+	Height      uint32
+	InnerNodes  int
+	LeafNodes   int
+	RecordCount int
+	// LeafByteSize is the number of bytes the leaf pages take.
+	LeafByteSize int
+	// UnderfullLeaves counts the non-root leaves holding fewer than Order keys,
+	// which is not a violation since deleting does not re-balance the tree.
+	UnderfullLeaves int
+	Violations      []Violation
+}
+
+// OK returns true if the tree violates no invariant.
+func (r *VerifyReport) OK() bool {
+	return len(r.Violations) == 0
+}
+
+func (r *VerifyReport) String() string {
+	var buffer strings.Builder
+	buffer.WriteString("VerifyReport(")
+	buffer.WriteString(fmt.Sprintf("height=%d, ", r.Height))
+	buffer.WriteString(fmt.Sprintf("innerNodes=%d, ", r.InnerNodes))
+	buffer.WriteString(fmt.Sprintf("leafNodes=%d, ", r.LeafNodes))
+	buffer.WriteString(fmt.Sprintf("records=%d, ", r.RecordCount))
+	buffer.WriteString(fmt.Sprintf("leafBytes=%d, ", r.LeafByteSize))
+	buffer.WriteString(fmt.Sprintf("underfullLeaves=%d, ", r.UnderfullLeaves))
+	buffer.WriteString(fmt.Sprintf("violations=%v)", r.Violations))
+	return buffer.String()
+}
+
+func (r *VerifyReport) addViolation(kind ViolationKind, pageNumber table.PageNumber, format string, args ...any) {
+	r.Violations = append(r.Violations, Violation{
+		Kind:       kind,
+		PageNumber: pageNumber,
+		Message:    fmt.Sprintf(format, args...),
+	})
+}
+
+// leafLinks are the page number and sibling links of a leaf.
+type leafLinks struct {
+	pageNumber table.PageNumber
+	prev       table.PageNumber
+	next       table.PageNumber
+}
+
+// verifier walks a B+ tree depth first and collects the violations.
+type verifier struct {
+	tree   *BPlusTree
+	report *VerifyReport
+	// leaves are the visited leaves from left to right.
+	leaves []leafLinks
+}
+
+// Verify walks every node of the tree and checks that
+//   - the keys within each node are sorted,
+//   - the separators bound the keys of their child subtrees,
+//   - all the leaves are at the depth equal to the height of the tree,
+//   - the prev and next links of the leaves agree in both directions,
+//   - the nodes hold no more than 2 * Order keys and fit in their pages,
+//     and the inner nodes hold no fewer than Order keys unless their keys are long.
+//
+// The violations are collected in the report, the error is only returned
+// when a page cannot be fetched.
+func (tree *BPlusTree) Verify() (*VerifyReport, error) {
+	v := &verifier{
+		tree:   tree,
+		report: &VerifyReport{Height: tree.meta.height},
+	}
+
+	if err := v.verifyNode(tree.meta.rootPageNumber, 1, nil, nil); err != nil {
+		return nil, err
+	}
+	v.verifyLeafLinks()
+	return v.report, nil
+}
+
+// verifyNode verifies the subtree rooted by the page at the depth,
+// whose keys must lie in [lo, hi). A nil lo or hi leaves the side unbounded.
+func (v *verifier) verifyNode(pageNumber table.PageNumber, depth uint32, lo, hi encodedKey) error {
+	node, err := BPlusNodeFrom(pageNumber, v.tree.meta, v.tree.bufferManager)
+	if err != nil {
+		return err
+	}
+
+	switch n := node.(type) {
+	case *LeafNode:
+		v.leaves = append(v.leaves, leafLinks{
+			pageNumber: pageNumber,
+			prev:       n.page.PrevPageNumber(),
+			next:       n.page.NextPageNumber(),
+		})
+		keys, byteSize := n.keys, n.page.ByteSize()
+		n.unpin(false)
+
+		v.report.LeafNodes++
+		v.report.RecordCount += len(keys)
+		v.report.LeafByteSize += byteSize
+		v.verifyKeys(pageNumber, keys, byteSize, lo, hi)
+		if depth != v.report.Height {
+			v.report.addViolation(LeafDepth, pageNumber, "leaf at depth %d, tree height %d", depth, v.report.Height)
+		}
+		if depth > 1 && len(keys) < int(v.tree.meta.Order) {
+			v.report.UnderfullLeaves++
+		}
+		return nil
+	case *InnerNode:
+		keys, children, byteSize := n.keys, append([]table.PageNumber{}, n.children...), n.page.ByteSize()
+		n.unpin(false)
+
+		v.report.InnerNodes++
+		v.verifyKeys(pageNumber, keys, byteSize, lo, hi)
+		if depth > 1 && len(keys) < int(v.tree.meta.Order) && byteSize < minInnerByteSize {
+			v.report.addViolation(Occupancy, pageNumber, "%d keys in %d bytes, order %d",
+				len(keys), byteSize, v.tree.meta.Order)
+		}
+		if depth >= v.report.Height {
+			// The leaves below are too deep, walking further may never end on a cycle.
+			v.report.addViolation(LeafDepth, pageNumber, "inner node at depth %d, tree height %d", depth, v.report.Height)
+			return nil
+		}
+
+		for i, child := range children {
+			childLo, childHi := lo, hi
+			if i > 0 {
+				childLo = keys[i-1]
+			}
+			if i < len(keys) {
+				childHi = keys[i]
+			}
+			if err = v.verifyNode(child, depth+1, childLo, childHi); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		node.unpin(false)
+		return ErrNotLeafNode
+	}
+}
+
+// verifyKeys verifies the keys of a node are sorted and lie in [lo, hi),
+// and the node neither holds too many keys nor overflows its page.
+func (v *verifier) verifyKeys(pageNumber table.PageNumber, keys []encodedKey, byteSize int, lo, hi encodedKey) {
+	if len(keys) > 2*int(v.tree.meta.Order) { //nolint:mnd // 2*order is the threshold.
+		v.report.addViolation(Occupancy, pageNumber, "%d keys, order %d", len(keys), v.tree.meta.Order)
+	}
+	if byteSize > config.PageSize {
+		v.report.addViolation(Occupancy, pageNumber, "%d bytes, page size %d", byteSize, config.PageSize)
+	}
+
+	for i, key := range keys {
+		if i > 0 && keys[i-1].Compare(key) >= 0 {
+			v.report.addViolation(UnsortedKeys, pageNumber, "key %d %x follows %x", i, key, keys[i-1])
+		}
+		if (lo != nil && key.Compare(lo) < 0) || (hi != nil && key.Compare(hi) >= 0) {
+			v.report.addViolation(SeparatorBounds, pageNumber, "key %d %x out of [%x, %x)", i, key, lo, hi)
+		}
+	}
+}
+
+// verifyLeafLinks verifies the leaves visited from left to right link to each other.
+func (v *verifier) verifyLeafLinks() {
+	for i, leaf := range v.leaves {
+		expectedPrev, expectedNext := table.InvalidPageNumber, table.InvalidPageNumber
+		if i > 0 {
+			expectedPrev = v.leaves[i-1].pageNumber
+		}
+		if i < len(v.leaves)-1 {
+			expectedNext = v.leaves[i+1].pageNumber
+		}
+
+		if leaf.prev != expectedPrev {
+			v.report.addViolation(LeafLink, leaf.pageNumber, "prev is %d, expected %d", leaf.prev, expectedPrev)
+		}
+		if leaf.next != expectedNext {
+			v.report.addViolation(LeafLink, leaf.pageNumber, "next is %d, expected %d", leaf.next, expectedNext)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package bplustree_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Verify B+ tree", func() {
+	const recordCount = 30
+
+	var schema *table.Schema
+	var bufferManager memory.BufferManager
+	var tree *bplustree.BPlusTree
+	var pkType field.Type
+
+	newRecord := func(key int) *table.Record {
+		return table.NewRecordFromLiteral(key, fmt.Sprintf("name-%d", key), key, key%2 == 0, float64(key))
+	}
+
+	kindsOf := func(report *bplustree.VerifyReport) []bplustree.ViolationKind {
+		kinds := make([]bplustree.ViolationKind, len(report.Violations))
+		for i, violation := range report.Violations {
+			kinds[i] = violation.Kind
+		}
+		return kinds
+	}
+
+	// firstLeaf returns the left-most leaf page, which must be unpinned after use.
+	firstLeaf := func() *table.DataPage {
+		pageNumber := tree.RootPageNumber()
+		for {
+			p, err := bufferManager.FetchPage(pageNumber, schema)
+			Expect(err).ToNot(HaveOccurred())
+			dataPage := p.(*table.DataPage)
+			if dataPage.IsLeaf() {
+				return dataPage
+			}
+			bufferManager.Unpin(pageNumber, false)
+			pageNumber = table.PageNumber(dataPage.Get(0).Get(1).Val().(int32))
+		}
+	}
+
+	BeforeEach(func() {
+		schema = table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar()).
+			WithField("age", field.NewInteger()).
+			WithField("is_student", field.NewBoolean()).
+			WithField("score", field.NewFloat())
+		pkType = field.NewInteger()
+
+		replacer := memory.NewLRUKReplacer(2)
+		diskManager := disk.NewMemoryDiskManager()
+		bufferManager = memory.NewBufferPool(1024, diskManager, replacer)
+		DeferCleanup(bufferManager.Close)
+
+		var err error
+		tree, err = bplustree.NewBPlusTree(&bplustree.Metadata{
+			Order:  2,
+			Schema: schema,
+		}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < recordCount; i++ {
+			key := (i * 7) % recordCount
+			Expect(tree.Put(field.NewValue(pkType, key), newRecord(key))).To(Succeed())
+		}
+	})
+
+	It("should report a valid tree", func() {
+		report, err := tree.Verify()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.OK()).To(BeTrue(), report.String())
+		Expect(report.RecordCount).To(Equal(recordCount))
+		Expect(report.Height).To(BeNumerically(">", 1))
+		Expect(report.InnerNodes).To(BeNumerically(">", 0))
+		Expect(report.LeafNodes).To(BeNumerically(">", 1))
+		Expect(report.LeafByteSize).To(BeNumerically(">", 0))
+
+		stats, err := tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.FillFactor).To(BeNumerically("~",
+			float64(report.LeafByteSize)/float64(report.LeafNodes*config.PageSize), 1e-9))
+		Expect(stats.FillFactor).To(BeNumerically(">", 0))
+		Expect(stats.FillFactor).To(BeNumerically("<", 1))
+	})
+
+	It("should count underfull leaves after deletes without violations", func() {
+		for key := 0; key < recordCount; key += 2 {
+			Expect(tree.Delete(field.NewValue(pkType, key))).To(Succeed())
+		}
+
+		report, err := tree.Verify()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.OK()).To(BeTrue(), report.String())
+		Expect(report.RecordCount).To(Equal(recordCount / 2))
+		Expect(report.UnderfullLeaves).To(BeNumerically(">", 0))
+	})
+
+	It("should report a valid bulk loaded tree", func() {
+		loaded, err := bplustree.BulkLoad(&bplustree.Metadata{
+			Order:  3,
+			Schema: schema,
+		}, bufferManager, sortedRecords(keyRange(500)...), bplustree.WithFillFactor(0.7))
+		Expect(err).ToNot(HaveOccurred())
+
+		report, err := loaded.Verify()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.OK()).To(BeTrue(), report.String())
+		Expect(report.RecordCount).To(Equal(500))
+		Expect(report.UnderfullLeaves).To(BeZero())
+	})
+
+	DescribeTable("should report a corrupted tree",
+		func(corrupt func(leaf *table.DataPage), expected bplustree.ViolationKind) {
+			leaf := firstLeaf()
+			corrupt(leaf)
+			bufferManager.Unpin(leaf.PageNumber(), true)
+
+			report, err := tree.Verify()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.OK()).To(BeFalse())
+			Expect(kindsOf(report)).To(ContainElement(expected))
+			Expect(report.Violations[0].PageNumber).ToNot(Equal(table.InvalidPageNumber))
+		},
+		Entry("with a broken leaf link", func(leaf *table.DataPage) {
+			leaf.SetNext(table.InvalidPageNumber)
+		}, bplustree.LeafLink),
+		Entry("with unsorted keys", func(leaf *table.DataPage) {
+			leaf.Append(leaf.Delete(0))
+		}, bplustree.UnsortedKeys),
+		Entry("with a key beyond the separator", func(leaf *table.DataPage) {
+			leaf.Append(newRecord(1000))
+		}, bplustree.SeparatorBounds),
+		Entry("with an overflowed leaf", func(leaf *table.DataPage) {
+			for key := -1; key >= -5; key-- {
+				leaf.Insert(0, newRecord(key))
+			}
+		}, bplustree.Occupancy),
+	)
+})
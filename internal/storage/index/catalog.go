@@ -0,0 +1,249 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var (
+	// ErrIndexExists is returned when creating an index under a name already in the catalog.
+	ErrIndexExists = errors.New("index already exists")
+	// ErrIndexNotFound is returned when an index is absent from the catalog.
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrUnknownMethod is returned when creating an index of an access method the catalog has no factory for.
+	ErrUnknownMethod = errors.New("unknown access method")
+	// ErrNotAnalyzed is returned when reading the statistics of an index never analyzed.
+	ErrNotAnalyzed = errors.New("index not analyzed")
+)
+
+// ID identifies an index in a catalog.
+type ID uint32
+
+// Method is the access method of an index.
+type Method string
+
+const (
+	BPlusTreeMethod Method = "btree"
+	HashMethod      Method = "hash"
+	LSMMethod       Method = "lsm"
+	ARTMethod       Method = "art"
+)
+
+// Factory creates the index of the name of the records of the schema,
+// the access methods storing their pages in the buffer manager use it.
+type Factory func(name string, schema *table.Schema, bufferManager memory.BufferManager) (Index, error)
+
+// Descriptor describes an index in a catalog.
+type Descriptor struct {
+	ID     ID
+	Name   string
+	Method Method
+	Schema *table.Schema
+	Index  Index
+	// statistics are the statistics of an index that is not a StatisticsKeeper.
+	statistics *Statistics
+}
+
+type CatalogOption func(*Catalog)
+
+// WithMethod registers the factory creating the indexes of the access method.
+func WithMethod(method Method, factory Factory) CatalogOption {
+	return func(c *Catalog) {
+		c.factories[method] = factory
+	}
+}
+
+// Catalog maps index IDs to the indexes and their metadata.
+//
+// The catalog only knows the access methods by their factories,
+// so choosing one does not import the package implementing it.
+type Catalog struct {
+	mu          sync.RWMutex
+	descriptors map[ID]*Descriptor
+	names       map[string]ID
+	nextID      ID
+
+	factories     map[Method]Factory
+	bufferManager memory.BufferManager
+}
+
+func NewCatalog(bufferManager memory.BufferManager, opts ...CatalogOption) *Catalog {
+	c := &Catalog{
+		descriptors:   make(map[ID]*Descriptor),
+		names:         make(map[string]ID),
+		nextID:        1,
+		factories:     make(map[Method]Factory),
+		bufferManager: bufferManager,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Create an index of the access method under the name.
+func (c *Catalog) Create(name string, method Method, schema *table.Schema) (*Descriptor, error) {
+	factory, ok := c.factories[method]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.names[name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrIndexExists, name)
+	}
+
+	idx, err := factory(name, schema, c.bufferManager)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor := &Descriptor{
+		ID:     c.nextID,
+		Name:   name,
+		Method: method,
+		Schema: schema,
+		Index:  idx,
+	}
+	c.descriptors[descriptor.ID] = descriptor
+	c.names[name] = descriptor.ID
+	c.nextID++
+	return descriptor, nil
+}
+
+// Get returns the descriptor of the index of the ID.
+func (c *Catalog) Get(id ID) (*Descriptor, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	descriptor, ok := c.descriptors[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrIndexNotFound, id)
+	}
+	return descriptor, nil
+}
+
+// Lookup returns the descriptor of the index of the name.
+func (c *Catalog) Lookup(name string) (*Descriptor, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	id, ok := c.names[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, name)
+	}
+	return c.descriptors[id], nil
+}
+
+// List returns the descriptors of all the indexes in ascending ID order.
+func (c *Catalog) List() []*Descriptor {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	descriptors := make([]*Descriptor, 0, len(c.descriptors))
+	for _, descriptor := range c.descriptors {
+		descriptors = append(descriptors, descriptor)
+	}
+	slices.SortFunc(descriptors, func(a, b *Descriptor) int {
+		return int(a.ID) - int(b.ID)
+	})
+	return descriptors
+}
+
+// Drop closes the index of the ID and removes it from the catalog.
+func (c *Catalog) Drop(id ID) error {
+	c.mu.Lock()
+	descriptor, ok := c.descriptors[id]
+	if ok {
+		delete(c.descriptors, id)
+		delete(c.names, descriptor.Name)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrIndexNotFound, id)
+	}
+	return descriptor.Index.Close()
+}
+
+// Analyze collects the statistics of the index of the ID like ANALYZE.
+//
+// A StatisticsKeeper persists them in its own metadata, such as the metadata page of a B+ tree,
+// so that they are found again once it is reopened.
+// The statistics of the other indexes are kept in the catalog, which is not persisted.
+func (c *Catalog) Analyze(id ID) (*Statistics, error) {
+	descriptor, err := c.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	statistics, err := Analyze(descriptor.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	if keeper, ok := descriptor.Index.(StatisticsKeeper); ok {
+		if err = keeper.SaveStatistics(statistics); err != nil {
+			return nil, err
+		}
+		return statistics, nil
+	}
+	c.mu.Lock()
+	saved := *statistics
+	descriptor.statistics = &saved
+	c.mu.Unlock()
+	return statistics, nil
+}
+
+// Statistics returns the statistics of the index of the ID the last Analyze saved,
+// or ErrNotAnalyzed if the index was never analyzed.
+func (c *Catalog) Statistics(id ID) (*Statistics, error) {
+	descriptor, err := c.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var statistics *Statistics
+	if keeper, ok := descriptor.Index.(StatisticsKeeper); ok {
+		if statistics, err = keeper.SavedStatistics(); err != nil && !errors.Is(err, ErrNotAnalyzed) {
+			return nil, err
+		}
+	} else {
+		c.mu.RLock()
+		statistics = descriptor.statistics
+		c.mu.RUnlock()
+	}
+	if statistics == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotAnalyzed, descriptor.Name)
+	}
+	saved := *statistics
+	return &saved, nil
+}
+
+// Histogram samples a histogram of the keys of the index of the ID,
+// of DefaultHistogramBuckets buckets built from DefaultSampleSize keys.
+// Unlike the statistics, histograms are sampled on demand and not persisted.
+func (c *Catalog) Histogram(id ID) (*Histogram, error) {
+	descriptor, err := c.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return SampleHistogram(descriptor.Index, DefaultHistogramBuckets, DefaultSampleSize)
+}
+
+// Close closes all the indexes in the catalog.
+func (c *Catalog) Close() error {
+	var errs []error
+	for _, descriptor := range c.List() {
+		if err := c.Drop(descriptor.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
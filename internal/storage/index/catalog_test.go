@@ -0,0 +1,219 @@
+package index_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/index/art"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/index/extendiblehash"
+	"github.com/Huangkai1008/libradb/internal/storage/index/lsm"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+func newCatalog(t *testing.T) *index.Catalog {
+	t.Helper()
+
+	bufferManager := memory.NewBufferPool(64, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+	t.Cleanup(func() {
+		_ = bufferManager.Close()
+	})
+	return index.NewCatalog(bufferManager,
+		index.WithMethod(index.BPlusTreeMethod, bplustree.NewFactory(2)),
+		index.WithMethod(index.HashMethod, extendiblehash.NewFactory(4)),
+		index.WithMethod(index.LSMMethod, lsm.NewFactory(t.TempDir())),
+		index.WithMethod(index.ARTMethod, art.NewFactory()),
+	)
+}
+
+func newSchema() *table.Schema {
+	return table.NewSchema().
+		WithField("id", field.NewInteger()).
+		WithField("name", field.NewVarchar())
+}
+
+func TestCatalog_Create(t *testing.T) {
+	t.Run("every access method", func(t *testing.T) {
+		catalog := newCatalog(t)
+		pkType := field.NewInteger()
+
+		for _, method := range []index.Method{
+			index.BPlusTreeMethod, index.HashMethod, index.LSMMethod, index.ARTMethod,
+		} {
+			descriptor, err := catalog.Create(string(method)+"_idx", method, newSchema())
+			require.NoError(t, err)
+			assert.Equal(t, method, descriptor.Method)
+
+			idx := descriptor.Index
+			for _, key := range []int{5, 3, 9, 1, 7} {
+				require.NoError(t, idx.Put(field.NewValue(pkType, key), table.NewRecordFromLiteral(key, "name")))
+			}
+
+			var keys []int32
+			for record, rangeErr := range idx.Range(field.NewValue(pkType, 3), field.NewValue(pkType, 9)) {
+				require.NoError(t, rangeErr)
+				keys = append(keys, record.GetKey().Val().(int32))
+			}
+			assert.Equal(t, []int32{3, 5, 7}, keys)
+
+			stats, err := idx.Stats()
+			require.NoError(t, err)
+			assert.Equal(t, 5, stats.RecordCount)
+		}
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		catalog := newCatalog(t)
+
+		_, err := catalog.Create("idx", index.BPlusTreeMethod, newSchema())
+		require.NoError(t, err)
+		_, err = catalog.Create("idx", index.HashMethod, newSchema())
+		require.ErrorIs(t, err, index.ErrIndexExists)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		catalog := newCatalog(t)
+
+		_, err := catalog.Create("idx", index.Method("gist"), newSchema())
+		require.ErrorIs(t, err, index.ErrUnknownMethod)
+	})
+}
+
+func TestCatalog_Lookup(t *testing.T) {
+	catalog := newCatalog(t)
+
+	first, err := catalog.Create("first", index.BPlusTreeMethod, newSchema())
+	require.NoError(t, err)
+	second, err := catalog.Create("second", index.HashMethod, newSchema())
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID)
+
+	descriptor, err := catalog.Get(second.ID)
+	require.NoError(t, err)
+	assert.Same(t, second, descriptor)
+
+	descriptor, err = catalog.Lookup("first")
+	require.NoError(t, err)
+	assert.Same(t, first, descriptor)
+
+	assert.Equal(t, []*index.Descriptor{first, second}, catalog.List())
+
+	_, err = catalog.Lookup("third")
+	require.ErrorIs(t, err, index.ErrIndexNotFound)
+}
+
+func TestCatalog_Drop(t *testing.T) {
+	catalog := newCatalog(t)
+	pkType := field.NewInteger()
+
+	descriptor, err := catalog.Create("idx", index.BPlusTreeMethod, newSchema())
+	require.NoError(t, err)
+	require.NoError(t, catalog.Drop(descriptor.ID))
+
+	_, err = catalog.Get(descriptor.ID)
+	require.ErrorIs(t, err, index.ErrIndexNotFound)
+	_, err = descriptor.Index.Get(field.NewValue(pkType, 1))
+	require.ErrorIs(t, err, index.ErrClosed)
+	require.ErrorIs(t, catalog.Drop(descriptor.ID), index.ErrIndexNotFound)
+
+	// The name is free again.
+	_, err = catalog.Create("idx", index.HashMethod, newSchema())
+	require.NoError(t, err)
+	require.NoError(t, catalog.Close())
+	assert.Empty(t, catalog.List())
+}
+
+func TestCatalog_Analyze(t *testing.T) {
+	catalog := newCatalog(t)
+	pkType := field.NewInteger()
+
+	for _, method := range []index.Method{index.BPlusTreeMethod, index.HashMethod, index.ARTMethod} {
+		descriptor, err := catalog.Create(string(method)+"_idx", method, newSchema())
+		require.NoError(t, err)
+		_, err = catalog.Statistics(descriptor.ID)
+		require.ErrorIs(t, err, index.ErrNotAnalyzed)
+
+		for key := 0; key < 200; key++ {
+			require.NoError(t, descriptor.Index.Put(field.NewValue(pkType, key), table.NewRecordFromLiteral(key, "name")))
+		}
+		analyzed, err := catalog.Analyze(descriptor.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 200, analyzed.RecordCount)
+		assert.InDelta(t, 200, analyzed.DistinctKeys, 10)
+		if method != index.ARTMethod {
+			assert.Positive(t, analyzed.PageCount)
+			assert.Positive(t, analyzed.Height)
+			assert.Positive(t, analyzed.FillFactor)
+		}
+
+		// Analyzing again replaces the persisted statistics.
+		require.NoError(t, descriptor.Index.Delete(field.NewValue(pkType, 0)))
+		analyzed, err = catalog.Analyze(descriptor.ID)
+		require.NoError(t, err)
+		persisted, err := catalog.Statistics(descriptor.ID)
+		require.NoError(t, err)
+		assert.InDelta(t, analyzed.FillFactor, persisted.FillFactor, 1e-6)
+		persisted.FillFactor = analyzed.FillFactor
+		assert.Equal(t, analyzed, persisted)
+		assert.Equal(t, 199, persisted.RecordCount)
+
+		histogram, err := catalog.Histogram(descriptor.ID)
+		require.NoError(t, err)
+		assert.NotEmpty(t, histogram.Bounds)
+		assert.LessOrEqual(t, len(histogram.Bounds), index.DefaultHistogramBuckets)
+	}
+
+	_, err := catalog.Analyze(index.ID(100))
+	require.ErrorIs(t, err, index.ErrIndexNotFound)
+}
+
+func TestCatalog_AnalyzePersisted(t *testing.T) {
+	dir := t.TempDir()
+	bufferManager := memory.NewBufferPool(64, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+	t.Cleanup(func() {
+		_ = bufferManager.Close()
+	})
+	catalog := index.NewCatalog(bufferManager,
+		index.WithMethod(index.BPlusTreeMethod, bplustree.NewFactory(2)),
+		index.WithMethod(index.LSMMethod, lsm.NewFactory(dir)),
+	)
+	pkType := field.NewInteger()
+
+	analyzed := make(map[index.Method]*index.Statistics)
+	for _, method := range []index.Method{index.BPlusTreeMethod, index.LSMMethod} {
+		descriptor, err := catalog.Create(string(method)+"_idx", method, newSchema())
+		require.NoError(t, err)
+		for key := 0; key < 100; key++ {
+			require.NoError(t, descriptor.Index.Put(field.NewValue(pkType, key), table.NewRecordFromLiteral(key, "name")))
+		}
+		analyzed[method], err = catalog.Analyze(descriptor.ID)
+		require.NoError(t, err)
+
+		// The statistics are saved in the metadata of the index itself.
+		keeper, ok := descriptor.Index.(index.StatisticsKeeper)
+		require.True(t, ok)
+		saved, err := keeper.SavedStatistics()
+		require.NoError(t, err)
+		assert.InDelta(t, analyzed[method].FillFactor, saved.FillFactor, 1e-6)
+		saved.FillFactor = analyzed[method].FillFactor
+		assert.Equal(t, analyzed[method], saved)
+	}
+	require.NoError(t, catalog.Close())
+
+	// The LSM tree keeps them in its manifest across a reopening.
+	reopened, err := lsm.Open(filepath.Join(dir, string(index.LSMMethod)+"_idx"), newSchema())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = reopened.Close()
+	})
+	saved, err := reopened.SavedStatistics()
+	require.NoError(t, err)
+	assert.Equal(t, analyzed[index.LSMMethod], saved)
+}
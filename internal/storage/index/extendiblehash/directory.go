@@ -0,0 +1,171 @@
+package extendiblehash
+
+import (
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+const (
+	// directoryPageDepth is the number of hash bits a directory page is indexed by,
+	// 2^directoryPageDepth directory entries fit in a directory page.
+	directoryPageDepth = 8
+	// directoryPageEntries is the number of entries of a full directory page.
+	directoryPageEntries = 1 << directoryPageDepth
+	// MaxGlobalDepth is the largest global depth of the directory,
+	// the header page lists up to 2^(MaxGlobalDepth-directoryPageDepth) directory pages.
+	MaxGlobalDepth = 16
+)
+
+// directorySchema is the schema of the directory entries,
+// each entry is the page number and the local depth of a bucket.
+//
+//nolint:gochecknoglobals // The schema is never modified.
+var directorySchema = table.NewSchema().
+	WithField("bucket_page_number", field.NewInteger()).
+	WithField("local_depth", field.NewInteger())
+
+// headerSchema is the schema of the header page entries, each entry is the page number of a directory page.
+//
+//nolint:gochecknoglobals // The schema is never modified.
+var headerSchema = table.NewSchema().
+	WithField("directory_page_number", field.NewInteger())
+
+// directory maps the low global depth bits of the key hashes to the buckets.
+//
+// It holds 2^globalDepth entries, entry i is the bucket of the keys whose hash ends with the bits of i.
+// The entries are stored in directory pages of directoryPageEntries entries each,
+// listed in order by the header page, so entry i is in the directory page i / directoryPageEntries.
+// A directory smaller than a page is stored in the first directory page alone.
+type directory struct {
+	bufferManager memory.BufferManager
+	spaceID       table.SpaceID
+	// header is pinned as long as the directory is used.
+	header *table.DataPage
+	size   int
+}
+
+func newDirectoryEntry(bucketPageNumber table.PageNumber, localDepth uint8) *table.Record {
+	return table.NewRecordFromLiteral(int(bucketPageNumber), int(localDepth))
+}
+
+func newHeaderEntry(directoryPageNumber table.PageNumber) *table.Record {
+	return table.NewRecordFromLiteral(int(directoryPageNumber))
+}
+
+// globalDepth returns the number of hash bits the directory is indexed by.
+func (d *directory) globalDepth() uint8 {
+	depth := uint8(0)
+	for size := d.size; size > 1; size >>= 1 {
+		depth++
+	}
+	return depth
+}
+
+// indexOf returns the entry of the hash.
+func (d *directory) indexOf(hash uint64) int {
+	return int(hash & (uint64(d.size) - 1))
+}
+
+// bucket returns the page number and the local depth of the bucket of the entry.
+func (d *directory) bucket(i int) (table.PageNumber, uint8, error) {
+	p, err := d.fetchPage(i / directoryPageEntries)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer d.bufferManager.Unpin(p.PageNumber(), false)
+
+	pageNumber, localDepth := bucketOf(p.Get(uint16(i % directoryPageEntries)))
+	return pageNumber, localDepth, nil
+}
+
+func (d *directory) setBucket(i int, bucketPageNumber table.PageNumber, localDepth uint8) error {
+	p, err := d.fetchPage(i / directoryPageEntries)
+	if err != nil {
+		return err
+	}
+	p.Replace(uint16(i%directoryPageEntries), newDirectoryEntry(bucketPageNumber, localDepth))
+	d.bufferManager.Unpin(p.PageNumber(), true)
+	return nil
+}
+
+// forEach calls fn on each entry in order, reading each directory page once.
+func (d *directory) forEach(fn func(i int, bucketPageNumber table.PageNumber, localDepth uint8) error) error {
+	for k := 0; k*directoryPageEntries < d.size; k++ {
+		p, err := d.fetchPage(k)
+		if err != nil {
+			return err
+		}
+		for j := uint16(0); j < p.RecordCount(); j++ {
+			pageNumber, localDepth := bucketOf(p.Get(j))
+			if err = fn(k*directoryPageEntries+int(j), pageNumber, localDepth); err != nil {
+				d.bufferManager.Unpin(p.PageNumber(), false)
+				return err
+			}
+		}
+		d.bufferManager.Unpin(p.PageNumber(), false)
+	}
+	return nil
+}
+
+// grow doubles the directory, the new entry i + size points to the bucket of entry i.
+//
+// A directory smaller than a page doubles in its page,
+// a larger one appends a copy of each directory page to the header page.
+func (d *directory) grow() error {
+	if d.size < directoryPageEntries {
+		p, err := d.fetchPage(0)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < d.size; i++ {
+			p.Append(p.Get(uint16(i)))
+		}
+		d.bufferManager.Unpin(p.PageNumber(), true)
+		d.size *= 2
+		return nil
+	}
+
+	pageCount := int(d.header.RecordCount())
+	for k := 0; k < pageCount; k++ {
+		p, err := d.fetchPage(k)
+		if err != nil {
+			return err
+		}
+		image := table.NewDataPage(true)
+		for j := uint16(0); j < p.RecordCount(); j++ {
+			image.Append(p.Get(j))
+		}
+		d.bufferManager.Unpin(p.PageNumber(), false)
+
+		if err = d.bufferManager.ApplyNewPage(d.spaceID, image); err != nil {
+			return err
+		}
+		d.header.Append(newHeaderEntry(image.PageNumber()))
+		d.bufferManager.Unpin(image.PageNumber(), true)
+	}
+	d.size *= 2
+	return nil
+}
+
+// pageCount returns the number of directory pages.
+func (d *directory) pageCount() int {
+	return int(d.header.RecordCount())
+}
+
+// fetchPage fetches the k-th directory page, the caller is responsible for unpinning it.
+func (d *directory) fetchPage(k int) (*table.DataPage, error) {
+	pageNumber, _ := d.header.Get(uint16(k)).Get(0).Val().(int32)
+	return fetchDataPage(d.bufferManager, table.PageNumber(pageNumber), directorySchema)
+}
+
+// release unpins the header page.
+func (d *directory) release(dirty bool) {
+	d.bufferManager.Unpin(d.header.PageNumber(), dirty)
+}
+
+func bucketOf(entry *table.Record) (table.PageNumber, uint8) {
+	pageNumber, _ := entry.Get(0).Val().(int32)
+	localDepth, _ := entry.Get(1).Val().(int32)
+	return table.PageNumber(pageNumber), uint8(localDepth)
+}
@@ -0,0 +1,6 @@
+package extendiblehash
+
+// HashOf exposes the hash of the keys to the tests.
+//
+//nolint:gochecknoglobals // Only exported to the tests.
+var HashOf = hashOf
@@ -0,0 +1,484 @@
+// Package extendiblehash implements a disk-resident extendible hash index.
+//
+// The index is made of a header page, directory pages and bucket pages.
+// The directory maps the low bits of the key hashes to the buckets,
+// a full bucket splits in two, and the directory doubles
+// when the bucket already uses as many hash bits as the directory.
+//
+// See https://cs186berkeley.net/notes/note4/ and
+// R. Fagin et al., Extendible Hashing - A Fast Access Method for Dynamic Files.
+package extendiblehash
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"iter"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var (
+	// ErrKeyExists is returned when putting a key already in the index.
+	ErrKeyExists = index.ErrKeyExists
+	// ErrRecordTooLarge is returned when a record is larger than table.MaxRecordByteSize.
+	ErrRecordTooLarge = index.ErrRecordTooLarge
+	// ErrDirectoryFull is returned when a bucket needs to split
+	// but the directory is already at MaxGlobalDepth.
+	ErrDirectoryFull = errors.New("hash directory is full")
+	// ErrClosed is returned when using a closed index.
+	ErrClosed = index.ErrClosed
+)
+
+var _ index.Index = (*HashIndex)(nil)
+
+// Metadata of an extendible hash index.
+type Metadata struct {
+	// Schema is the schema of the records, the first column is the key.
+	Schema *table.Schema
+	// BucketCapacity is the maximum number of records in a bucket,
+	// a bucket holds as many records as fit in its page if it is zero.
+	BucketCapacity uint16
+	tableSpaceID   table.SpaceID
+	// headerPageNumber is the page listing the directory pages, it cannot be changed.
+	headerPageNumber table.PageNumber
+}
+
+// HashIndex is an extendible hash index.
+//
+// Each point lookup reads the header page, a directory page and a single bucket page,
+// but unlike the B+ tree, a range has to read every bucket.
+// Deleting does not merge buckets nor shrink the directory.
+type HashIndex struct {
+	meta   *Metadata
+	closed atomic.Bool
+
+	bufferManager memory.BufferManager
+}
+
+func NewHashIndex(meta *Metadata, bufferManager memory.BufferManager) (*HashIndex, error) {
+	bucket := table.NewDataPage(true)
+	if err := bufferManager.ApplyNewPage(meta.tableSpaceID, bucket); err != nil {
+		return nil, err
+	}
+	bufferManager.Unpin(bucket.PageNumber(), true)
+
+	dirPage := table.NewDataPage(true)
+	dirPage.Append(newDirectoryEntry(bucket.PageNumber(), 0))
+	if err := bufferManager.ApplyNewPage(meta.tableSpaceID, dirPage); err != nil {
+		return nil, err
+	}
+	bufferManager.Unpin(dirPage.PageNumber(), true)
+
+	header := table.NewDataPage(true)
+	header.Append(newHeaderEntry(dirPage.PageNumber()))
+	if err := bufferManager.ApplyNewPage(meta.tableSpaceID, header); err != nil {
+		return nil, err
+	}
+	bufferManager.Unpin(header.PageNumber(), true)
+
+	meta.headerPageNumber = header.PageNumber()
+	return &HashIndex{meta: meta, bufferManager: bufferManager}, nil
+}
+
+// NewFactory returns the factory of the hash indexes of the bucket capacity in an index catalog.
+func NewFactory(bucketCapacity uint16) index.Factory {
+	return func(_ string, schema *table.Schema, bufferManager memory.BufferManager) (index.Index, error) {
+		return NewHashIndex(&Metadata{Schema: schema, BucketCapacity: bucketCapacity}, bufferManager)
+	}
+}
+
+func (h *HashIndex) Get(key index.Key) (*table.Record, error) {
+	if h.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	bucketPageNumber, err := h.bucketOf(key)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := h.fetchBucket(bucketPageNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer h.bufferManager.Unpin(bucketPageNumber, false)
+
+	if i := find(bucket, key); i != -1 {
+		return bucket.Get(uint16(i)), nil
+	}
+	return nil, nil //nolint:nilnil // nil is returned to indicate the key is absent.
+}
+
+// Put the record under the key, splitting the bucket of the key as long as it is full.
+func (h *HashIndex) Put(key index.Key, record *table.Record) error {
+	if h.closed.Load() {
+		return ErrClosed
+	}
+	if record.ByteSize() > table.MaxRecordByteSize {
+		return ErrRecordTooLarge
+	}
+
+	dir, err := h.fetchDirectory()
+	if err != nil {
+		return err
+	}
+	dirDirty := false
+	defer func() {
+		dir.release(dirDirty)
+	}()
+
+	hash := hashOf(key)
+	for {
+		i := dir.indexOf(hash)
+		bucketPageNumber, localDepth, bucketErr := dir.bucket(i)
+		if bucketErr != nil {
+			return bucketErr
+		}
+		bucket, fetchErr := h.fetchBucket(bucketPageNumber)
+		if fetchErr != nil {
+			return fetchErr
+		}
+
+		if find(bucket, key) != -1 {
+			h.bufferManager.Unpin(bucketPageNumber, false)
+			return ErrKeyExists
+		}
+		if h.fits(bucket, record) {
+			bucket.Append(record)
+			h.bufferManager.Unpin(bucketPageNumber, true)
+			return nil
+		}
+		h.bufferManager.Unpin(bucketPageNumber, false)
+
+		dirDirty = true
+		if localDepth == dir.globalDepth() {
+			if localDepth == MaxGlobalDepth {
+				return ErrDirectoryFull
+			}
+			if err = dir.grow(); err != nil {
+				return err
+			}
+		}
+		if err = h.split(dir, i); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *HashIndex) Delete(key index.Key) error {
+	if h.closed.Load() {
+		return ErrClosed
+	}
+
+	bucketPageNumber, err := h.bucketOf(key)
+	if err != nil {
+		return err
+	}
+	bucket, err := h.fetchBucket(bucketPageNumber)
+	if err != nil {
+		return err
+	}
+
+	i := find(bucket, key)
+	if i == -1 {
+		h.bufferManager.Unpin(bucketPageNumber, false)
+		return nil
+	}
+	bucket.Delete(uint16(i))
+	h.bufferManager.Unpin(bucketPageNumber, true)
+	return nil
+}
+
+// Range returns a sequence of the records whose key lies in [lo, hi),
+// in ascending key order.
+// A nil lo or hi leaves the corresponding side of the range unbounded.
+//
+// The hash scatters the keys over the buckets, so Range reads every bucket
+// and sorts the records in the range in memory before yielding them.
+func (h *HashIndex) Range(lo, hi index.Key) iter.Seq2[*table.Record, error] {
+	return func(yield func(*table.Record, error) bool) {
+		if h.closed.Load() {
+			yield(nil, ErrClosed)
+			return
+		}
+
+		var loKey, hiKey []byte
+		if lo != nil {
+			loKey = field.EncodeKey(lo)
+		}
+		if hi != nil {
+			hiKey = field.EncodeKey(hi)
+		}
+
+		type entry struct {
+			key    []byte
+			record *table.Record
+		}
+		var entries []entry
+		err := h.walkBuckets(func(bucket *table.DataPage) {
+			for i := uint16(0); i < bucket.RecordCount(); i++ {
+				record := bucket.Get(i)
+				key := field.EncodeKey(record.GetKey())
+				if (loKey != nil && bytes.Compare(key, loKey) < 0) || (hiKey != nil && bytes.Compare(key, hiKey) >= 0) {
+					continue
+				}
+				entries = append(entries, entry{key: key, record: record})
+			}
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		slices.SortFunc(entries, func(a, b entry) int {
+			return bytes.Compare(a.key, b.key)
+		})
+		for _, e := range entries {
+			if !yield(e.record, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Stats returns the statistics of the index by reading every bucket.
+func (h *HashIndex) Stats() (*index.Stats, error) {
+	if h.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	dir, err := h.fetchDirectory()
+	if err != nil {
+		return nil, err
+	}
+	stats := &index.Stats{
+		// The header page and the directory pages.
+		PageCount: 1 + dir.pageCount(),
+		// The header page, a directory page and a bucket page.
+		Height: 3, //nolint:mnd // a lookup reads three pages.
+	}
+	dir.release(false)
+
+	bucketCount, byteSize := 0, 0
+	err = h.walkBuckets(func(bucket *table.DataPage) {
+		bucketCount++
+		stats.RecordCount += int(bucket.RecordCount())
+		byteSize += bucket.ByteSize()
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The buckets are the leaf pages.
+	stats.PageCount += bucketCount
+	stats.FillFactor = float64(byteSize) / float64(bucketCount*config.PageSize)
+	return stats, nil
+}
+
+// Close the index, using it afterwards returns ErrClosed.
+// The pages of the index stay in the buffer manager.
+func (h *HashIndex) Close() error {
+	h.closed.Store(true)
+	return nil
+}
+
+// GlobalDepth returns the number of hash bits the directory is indexed by.
+func (h *HashIndex) GlobalDepth() (uint8, error) {
+	dir, err := h.fetchDirectory()
+	if err != nil {
+		return 0, err
+	}
+	defer dir.release(false)
+	return dir.globalDepth(), nil
+}
+
+func (h *HashIndex) String() string {
+	var buffer strings.Builder
+	buffer.WriteString("HashIndex(")
+	dir, err := h.fetchDirectory()
+	if err != nil {
+		buffer.WriteString(fmt.Sprintf("err=%v)", err))
+		return buffer.String()
+	}
+	defer dir.release(false)
+
+	buffer.WriteString(fmt.Sprintf("globalDepth=%d, ", dir.globalDepth()))
+	buffer.WriteString("buckets=[")
+	err = dir.forEach(func(i int, pageNumber table.PageNumber, localDepth uint8) error {
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(fmt.Sprintf("%d:%d", pageNumber, localDepth))
+		return nil
+	})
+	if err != nil {
+		buffer.WriteString(fmt.Sprintf("err=%v", err))
+	}
+	buffer.WriteString("])")
+	return buffer.String()
+}
+
+// split the bucket of the directory entry in two by the next hash bit,
+// the records with the bit set move to a new bucket.
+// The directory must be at a greater global depth than the local depth of the bucket.
+func (h *HashIndex) split(dir *directory, i int) error {
+	bucketPageNumber, localDepth, err := dir.bucket(i)
+	if err != nil {
+		return err
+	}
+	bucket, err := h.fetchBucket(bucketPageNumber)
+	if err != nil {
+		return err
+	}
+	defer h.bufferManager.Unpin(bucketPageNumber, true)
+
+	image := table.NewDataPage(true)
+	if err = h.bufferManager.ApplyNewPage(h.meta.tableSpaceID, image); err != nil {
+		return err
+	}
+	defer h.bufferManager.Unpin(image.PageNumber(), true)
+
+	highBit := uint64(1) << localDepth
+	for j := int(bucket.RecordCount()) - 1; j >= 0; j-- {
+		if hashOf(bucket.Get(uint16(j)).GetKey())&highBit != 0 {
+			image.Insert(0, bucket.Delete(uint16(j)))
+		}
+	}
+
+	// The entries of the bucket are the ones ending with its low local depth bits.
+	for j := i & int(highBit-1); j < dir.size; j += int(highBit) {
+		pageNumber := bucketPageNumber
+		if uint64(j)&highBit != 0 {
+			pageNumber = image.PageNumber()
+		}
+		if err = dir.setBucket(j, pageNumber, localDepth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkBuckets calls fn on each bucket once, fn must not keep the bucket.
+func (h *HashIndex) walkBuckets(fn func(bucket *table.DataPage)) error {
+	dir, err := h.fetchDirectory()
+	if err != nil {
+		return err
+	}
+	defer dir.release(false)
+
+	visited := make(map[table.PageNumber]bool)
+	return dir.forEach(func(_ int, pageNumber table.PageNumber, _ uint8) error {
+		if visited[pageNumber] {
+			return nil
+		}
+		visited[pageNumber] = true
+
+		bucket, fetchErr := h.fetchBucket(pageNumber)
+		if fetchErr != nil {
+			return fetchErr
+		}
+		fn(bucket)
+		h.bufferManager.Unpin(pageNumber, false)
+		return nil
+	})
+}
+
+// fits returns true if the bucket has room for the record.
+func (h *HashIndex) fits(bucket *table.DataPage, record *table.Record) bool {
+	if h.meta.BucketCapacity > 0 && bucket.RecordCount() >= h.meta.BucketCapacity {
+		return false
+	}
+
+	records := make([]*table.Record, 0, bucket.RecordCount()+1)
+	for i := uint16(0); i < bucket.RecordCount(); i++ {
+		records = append(records, bucket.Get(i))
+	}
+	return table.DataPageByteSize(append(records, record)) <= config.PageSize
+}
+
+// fetchDirectory fetches the header page of the directory, the caller is responsible for releasing it.
+func (h *HashIndex) fetchDirectory() (*directory, error) {
+	header, err := fetchDataPage(h.bufferManager, h.meta.headerPageNumber, headerSchema)
+	if err != nil {
+		return nil, err
+	}
+	dir := &directory{
+		bufferManager: h.bufferManager,
+		spaceID:       h.meta.tableSpaceID,
+		header:        header,
+		size:          int(header.RecordCount()) * directoryPageEntries,
+	}
+	if dir.pageCount() > 1 {
+		return dir, nil
+	}
+
+	// The directory smaller than a page holds as many entries as its page.
+	p, err := dir.fetchPage(0)
+	if err != nil {
+		dir.release(false)
+		return nil, err
+	}
+	dir.size = int(p.RecordCount())
+	h.bufferManager.Unpin(p.PageNumber(), false)
+	return dir, nil
+}
+
+// bucketOf returns the page number of the bucket of the key.
+func (h *HashIndex) bucketOf(key index.Key) (table.PageNumber, error) {
+	dir, err := h.fetchDirectory()
+	if err != nil {
+		return 0, err
+	}
+	defer dir.release(false)
+
+	pageNumber, _, err := dir.bucket(dir.indexOf(hashOf(key)))
+	return pageNumber, err
+}
+
+// fetchBucket fetches the bucket page, the caller is responsible for unpinning it.
+func (h *HashIndex) fetchBucket(pageNumber table.PageNumber) (*table.DataPage, error) {
+	return fetchDataPage(h.bufferManager, pageNumber, h.meta.Schema)
+}
+
+func fetchDataPage(
+	bufferManager memory.BufferManager,
+	pageNumber table.PageNumber,
+	schema *table.Schema,
+) (*table.DataPage, error) {
+	p, err := bufferManager.FetchPage(pageNumber, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	dataPage, ok := p.(*table.DataPage)
+	if !ok {
+		bufferManager.Unpin(pageNumber, false)
+		return nil, errors.New("not a data page")
+	}
+	return dataPage, nil
+}
+
+// find returns the position of the record of the key in the bucket, or -1 if absent.
+func find(bucket *table.DataPage, key index.Key) int {
+	for i := uint16(0); i < bucket.RecordCount(); i++ {
+		if bucket.Get(i).GetKey().Compare(key) == 0 {
+			return int(i)
+		}
+	}
+	return -1
+}
+
+// hashOf hashes the memcomparable encoding of the key,
+// so that equal keys hash the same whatever their type options are.
+func hashOf(key index.Key) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(field.EncodeKey(key))
+	return h.Sum64()
+}
@@ -0,0 +1,243 @@
+package extendiblehash_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/index/extendiblehash"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Extendible hash index", func() {
+	var schema *table.Schema
+	var bufferManager memory.BufferManager
+	var pkType field.Type
+
+	newRecord := func(key int) *table.Record {
+		return table.NewRecordFromLiteral(key, fmt.Sprintf("name-%d", key))
+	}
+
+	newHashIndex := func(capacity uint16) *extendiblehash.HashIndex {
+		hashIndex, err := extendiblehash.NewHashIndex(&extendiblehash.Metadata{
+			Schema:         schema,
+			BucketCapacity: capacity,
+		}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+		return hashIndex
+	}
+
+	BeforeEach(func() {
+		schema = table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar())
+		pkType = field.NewInteger()
+
+		replacer := memory.NewLRUKReplacer(2)
+		diskManager := disk.NewMemoryDiskManager()
+		bufferManager = memory.NewBufferPool(16, diskManager, replacer)
+		DeferCleanup(bufferManager.Close)
+	})
+
+	It("should get the records put, across directory doublings and evictions", func() {
+		const recordCount = 500
+		hashIndex := newHashIndex(4)
+
+		for i := 0; i < recordCount; i++ {
+			Expect(hashIndex.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+
+		globalDepth, err := hashIndex.GlobalDepth()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(globalDepth).To(BeNumerically(">=", 7))
+
+		for i := 0; i < recordCount; i++ {
+			record, getErr := hashIndex.Get(field.NewValue(pkType, i))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+			Expect(record.Get(1).Val()).To(Equal(fmt.Sprintf("name-%d", i)))
+		}
+
+		record, err := hashIndex.Get(field.NewValue(pkType, recordCount))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record).To(BeNil())
+	})
+
+	It("should fill buckets up to the page size without a capacity", func() {
+		hashIndex := newHashIndex(0)
+		for i := 0; i < 2000; i++ {
+			Expect(hashIndex.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+
+		globalDepth, err := hashIndex.GlobalDepth()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(globalDepth).To(BeNumerically("<", extendiblehash.MaxGlobalDepth))
+		for i := 0; i < 2000; i++ {
+			record, getErr := hashIndex.Get(field.NewValue(pkType, i))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+		}
+	})
+
+	It("should delete records", func() {
+		hashIndex := newHashIndex(4)
+		for i := 0; i < 100; i++ {
+			Expect(hashIndex.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+
+		for i := 0; i < 100; i += 2 {
+			Expect(hashIndex.Delete(field.NewValue(pkType, i))).To(Succeed())
+		}
+		Expect(hashIndex.Delete(field.NewValue(pkType, 1000))).To(Succeed())
+
+		for i := 0; i < 100; i++ {
+			record, err := hashIndex.Get(field.NewValue(pkType, i))
+			Expect(err).ToNot(HaveOccurred())
+			if i%2 == 0 {
+				Expect(record).To(BeNil())
+			} else {
+				Expect(record).ToNot(BeNil())
+			}
+		}
+
+		Expect(hashIndex.Put(field.NewValue(pkType, 0), newRecord(0))).To(Succeed())
+		record, err := hashIndex.Get(field.NewValue(pkType, 0))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record).ToNot(BeNil())
+	})
+
+	It("should not put a key twice", func() {
+		hashIndex := newHashIndex(4)
+		Expect(hashIndex.Put(field.NewValue(pkType, 1), newRecord(1))).To(Succeed())
+		Expect(hashIndex.Put(field.NewValue(pkType, 1), newRecord(1))).To(MatchError(extendiblehash.ErrKeyExists))
+		Expect(hashIndex.Put(field.NewValue(pkType, 1), newRecord(1))).To(MatchError(index.ErrKeyExists))
+	})
+
+	It("should grow the directory over several pages past 256 buckets", func() {
+		const recordCount = 3000
+		hashIndex := newHashIndex(4)
+		for i := 0; i < recordCount; i++ {
+			Expect(hashIndex.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+		}
+
+		globalDepth, err := hashIndex.GlobalDepth()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(globalDepth).To(BeNumerically(">", 8))
+		stats, err := hashIndex.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.PageCount).To(BeNumerically(">", 256))
+		Expect(stats.RecordCount).To(Equal(recordCount))
+
+		for i := 0; i < recordCount; i++ {
+			record, getErr := hashIndex.Get(field.NewValue(pkType, i))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).ToNot(BeNil())
+			Expect(record.Get(1).Val()).To(Equal(fmt.Sprintf("name-%d", i)))
+		}
+		var count int
+		for _, rangeErr := range hashIndex.Range(nil, nil) {
+			Expect(rangeErr).ToNot(HaveOccurred())
+			count++
+		}
+		Expect(count).To(Equal(recordCount))
+	})
+
+	It("should fail when the directory is full", func() {
+		By("Finding two keys whose hashes end with the same MaxGlobalDepth bits")
+		const mask = 1<<extendiblehash.MaxGlobalDepth - 1
+		seen := make(map[uint64]int)
+		var first, second int
+		for i := 0; ; i++ {
+			low := extendiblehash.HashOf(field.NewValue(pkType, i)) & mask
+			if j, ok := seen[low]; ok {
+				first, second = j, i
+				break
+			}
+			seen[low] = i
+		}
+
+		hashIndex := newHashIndex(1)
+		Expect(hashIndex.Put(field.NewValue(pkType, first), newRecord(first))).To(Succeed())
+		err := hashIndex.Put(field.NewValue(pkType, second), newRecord(second))
+		Expect(err).To(MatchError(extendiblehash.ErrDirectoryFull))
+
+		globalDepth, err := hashIndex.GlobalDepth()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(globalDepth).To(Equal(uint8(extendiblehash.MaxGlobalDepth)))
+		record, err := hashIndex.Get(field.NewValue(pkType, first))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record).ToNot(BeNil())
+	})
+
+	It("should reject a record larger than half a page", func() {
+		hashIndex := newHashIndex(0)
+		record := table.NewRecordFromLiteral(1, strings.Repeat("x", table.MaxRecordByteSize))
+		Expect(hashIndex.Put(field.NewValue(pkType, 1), record)).To(MatchError(extendiblehash.ErrRecordTooLarge))
+	})
+
+	It("should share the index interface with the B+ tree", func() {
+		tree, err := bplustree.NewBPlusTree(&bplustree.Metadata{Order: 2, Schema: schema}, bufferManager)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, idx := range []index.Index{newHashIndex(4), tree} {
+			for i := 0; i < 50; i++ {
+				Expect(idx.Put(field.NewValue(pkType, i), newRecord(i))).To(Succeed())
+			}
+			Expect(idx.Delete(field.NewValue(pkType, 7))).To(Succeed())
+
+			record, getErr := idx.Get(field.NewValue(pkType, 7))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record).To(BeNil())
+			record, getErr = idx.Get(field.NewValue(pkType, 8))
+			Expect(getErr).ToNot(HaveOccurred())
+			Expect(record.GetKey().Val()).To(Equal(int32(8)))
+
+			stats, statsErr := idx.Stats()
+			Expect(statsErr).ToNot(HaveOccurred())
+			Expect(stats.RecordCount).To(Equal(49))
+			Expect(stats.PageCount).To(BeNumerically(">", 1))
+			Expect(stats.FillFactor).To(BeNumerically(">", 0))
+			Expect(stats.FillFactor).To(BeNumerically("<", 1))
+
+			Expect(idx.Close()).To(Succeed())
+			Expect(idx.Put(field.NewValue(pkType, 100), newRecord(100))).To(MatchError(index.ErrClosed))
+			for _, rangeErr := range idx.Range(nil, nil) {
+				Expect(rangeErr).To(MatchError(index.ErrClosed))
+			}
+		}
+	})
+
+	It("should range over the records in key order", func() {
+		hashIndex := newHashIndex(4)
+		for i := 0; i < 200; i++ {
+			key := (i * 37) % 200
+			Expect(hashIndex.Put(field.NewValue(pkType, key), newRecord(key))).To(Succeed())
+		}
+
+		var keys []int32
+		for record, err := range hashIndex.Range(field.NewValue(pkType, 50), nil) {
+			Expect(err).ToNot(HaveOccurred())
+			keys = append(keys, record.GetKey().Val().(int32))
+			if len(keys) == 100 {
+				break
+			}
+		}
+		Expect(keys).To(HaveLen(100))
+		for i, key := range keys {
+			Expect(key).To(Equal(int32(50 + i)))
+		}
+	})
+})
+
+func TestExtendibleHash(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Extendible Hash Suite")
+}
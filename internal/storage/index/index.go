@@ -0,0 +1,72 @@
+// Package index defines the access methods shared by the index implementations,
+// the B+ tree in package bplustree and the extendible hash index in package extendiblehash.
+package index
+
+import (
+	"errors"
+	"io"
+	"iter"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var (
+	// ErrKeyExists is returned when putting a key already in the index.
+	ErrKeyExists = errors.New("key already exists")
+	// ErrRecordTooLarge is returned when a record is larger than table.MaxRecordByteSize.
+	ErrRecordTooLarge = errors.New("record too large")
+	// ErrClosed is returned when using a closed index.
+	ErrClosed = errors.New("index is closed")
+)
+
+// Key is the key records are indexed by.
+type Key = field.Value
+
+// Index maps keys to records.
+type Index interface {
+	// Get returns the record of the key, or nil if the key is absent.
+	Get(key Key) (*table.Record, error)
+	// Put the record under the key, or returns ErrKeyExists if the key is present.
+	Put(key Key, record *table.Record) error
+	// Delete the record of the key, or does nothing if the key is absent.
+	Delete(key Key) error
+	// Range returns a sequence of the records whose key lies in [lo, hi),
+	// in ascending key order.
+	// A nil lo or hi leaves the corresponding side of the range unbounded.
+	Range(lo, hi Key) iter.Seq2[*table.Record, error]
+	// Stats returns the statistics of the index.
+	Stats() (*Stats, error)
+	// Close the index, using it afterwards returns ErrClosed.
+	// The pages of the index stay in the buffer manager, which the index does not own.
+	io.Closer
+}
+
+// KeyedIndex is an index whose records are not keyed by their first column,
+// such as a B+ tree of a composite key.
+type KeyedIndex interface {
+	Index
+	// KeyOf returns the key the index extracts from the record.
+	KeyOf(record *table.Record) Key
+}
+
+// KeyOf returns the key the index extracts from the record,
+// which is the first column of the record unless the index is a KeyedIndex.
+func KeyOf(idx Index, record *table.Record) Key {
+	if keyed, ok := idx.(KeyedIndex); ok {
+		return keyed.KeyOf(record)
+	}
+	return record.GetKey()
+}
+
+// Stats are the statistics of an index.
+type Stats struct {
+	RecordCount int
+	// PageCount is the number of pages the index takes.
+	PageCount int
+	// Height is the number of pages a point lookup reads.
+	Height int
+	// FillFactor is the fraction of the bytes of the leaf pages the records take,
+	// it is zero for the indexes not made of fixed-size pages.
+	FillFactor float64
+}
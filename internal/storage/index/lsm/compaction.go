@@ -0,0 +1,408 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+)
+
+const (
+	manifestFileName = "MANIFEST"
+	tableFileSuffix  = ".sst"
+)
+
+// manifest records the SSTables of each level, it is rewritten after each flush and compaction.
+type manifest struct {
+	NextFileNumber uint64 `json:"next_file_number"`
+	// LogNumber is the number of the oldest write-ahead log whose writes are not in the SSTables yet.
+	LogNumber uint64     `json:"log_number"`
+	Levels    [][]uint64 `json:"levels"`
+	// Statistics are the statistics ANALYZE saved, nil if never analyzed.
+	Statistics *index.Statistics `json:"statistics,omitempty"`
+}
+
+func (tree *Tree) tablePath(number uint64) string {
+	return filepath.Join(tree.dir, fmt.Sprintf("%06d%s", number, tableFileSuffix))
+}
+
+func (tree *Tree) logPath(number uint64) string {
+	return filepath.Join(tree.dir, fmt.Sprintf("%06d%s", number, logFileSuffix))
+}
+
+// newFileNumber returns the number of a new SSTable or log file.
+func (tree *Tree) newFileNumber() uint64 {
+	return tree.nextFileNumber.Add(1) - 1
+}
+
+// recover opens the SSTables the manifest records,
+// and removes the ones a flush or a compaction left behind without recording them.
+// The logs whose writes are not in the SSTables yet are replayed and flushed to level 0,
+// then a new log is started for the memtable.
+func (tree *Tree) recover() error {
+	buf, err := os.ReadFile(filepath.Join(tree.dir, manifestFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	live := make(map[uint64]bool)
+	if err == nil {
+		var m manifest
+		if err = json.Unmarshal(buf, &m); err != nil {
+			return err
+		}
+		tree.nextFileNumber.Store(m.NextFileNumber)
+		tree.logNumber = m.LogNumber
+		tree.statistics = m.Statistics
+		for level, numbers := range m.Levels {
+			for _, number := range numbers {
+				t, openErr := openTable(tree.tablePath(number), number, tree.schema)
+				if openErr != nil {
+					return openErr
+				}
+				tree.levels[level] = append(tree.levels[level], t)
+				live[number] = true
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(tree.dir)
+	if err != nil {
+		return err
+	}
+	var logs []uint64
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), tableFileSuffix); ok {
+			if number, parseErr := strconv.ParseUint(name, 10, 64); parseErr == nil && !live[number] {
+				if err = os.Remove(filepath.Join(tree.dir, e.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		if name, ok := strings.CutSuffix(e.Name(), logFileSuffix); ok {
+			if number, parseErr := strconv.ParseUint(name, 10, 64); parseErr == nil {
+				logs = append(logs, number)
+			}
+		}
+	}
+	slices.Sort(logs)
+	return tree.replayLogs(logs)
+}
+
+// replayLogs replays the logs of the numbers in ascending order and flushes their writes to level 0,
+// then removes them and starts a new log.
+func (tree *Tree) replayLogs(logs []uint64) error {
+	replayed := newMemtable(0)
+	for _, number := range logs {
+		if number >= tree.nextFileNumber.Load() {
+			tree.nextFileNumber.Store(number + 1)
+		}
+		if number < tree.logNumber {
+			continue
+		}
+		if err := replayLog(tree.logPath(number), replayed, tree.schema); err != nil {
+			return err
+		}
+		replayed.logNumber = number
+	}
+	if replayed.len() > 0 {
+		tree.immutable = replayed
+		if err := tree.flushImmutable(); err != nil {
+			return err
+		}
+	}
+	for _, number := range logs {
+		if err := os.Remove(tree.logPath(number)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	number := tree.newFileNumber()
+	log, err := newLogWriter(tree.logPath(number), number, tree.syncWrites)
+	if err != nil {
+		return err
+	}
+	tree.log = log
+	tree.memtable = newMemtable(number)
+	return nil
+}
+
+// writeManifest replaces the manifest atomically by renaming a new one over it.
+func (tree *Tree) writeManifest() error {
+	m := manifest{
+		NextFileNumber: tree.nextFileNumber.Load(),
+		LogNumber:      tree.logNumber,
+		Levels:         make([][]uint64, MaxLevels),
+		Statistics:     tree.statistics,
+	}
+	for level, tables := range tree.levels {
+		m.Levels[level] = make([]uint64, len(tables))
+		for i, t := range tables {
+			m.Levels[level][i] = t.number
+		}
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(tree.dir, manifestFileName)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(buf); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return syncDir(tree.dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
+
+// background flushes the immutable memtable and compacts the levels off the write path,
+// until the tree is closed or one of them fails.
+// A flush goes before the compactions, since the writes may be stalled on it.
+func (tree *Tree) background() {
+	defer close(tree.done)
+
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	for !tree.closed && tree.err == nil {
+		var err error
+		if tree.immutable != nil {
+			err = tree.flushImmutable()
+		} else if level, ok := tree.pickLevel(); ok {
+			err = tree.compactLevel(level)
+		} else {
+			tree.changed.Wait()
+			continue
+		}
+		if err != nil {
+			tree.err = err
+		}
+		tree.changed.Broadcast()
+	}
+}
+
+// flushImmutable writes the immutable memtable to a new SSTable in level 0, and removes its log.
+// The tree must be locked, the lock is released while writing the SSTable.
+func (tree *Tree) flushImmutable() error {
+	it := tree.immutable.snapshot(nil, nil)
+	tree.mu.Unlock()
+	tables, err := tree.writeTables(it, false, 0, tree.immutable)
+	tree.mu.Lock()
+	if err != nil {
+		return err
+	}
+
+	logNumber := tree.immutable.logNumber
+	tree.levels[0] = append(tables, tree.levels[0]...)
+	tree.immutable = nil
+	tree.logNumber = logNumber + 1
+	if err = tree.writeManifest(); err != nil {
+		return err
+	}
+	if err = os.Remove(tree.logPath(logNumber)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// pickLevel returns the first level to compact, level 0 is compacted
+// once it has l0CompactionTrigger SSTables, a deeper level once it is over its byte size.
+func (tree *Tree) pickLevel() (int, bool) {
+	if len(tree.levels[0]) >= tree.l0CompactionTrigger {
+		return 0, true
+	}
+
+	maxByteSize := uint64(tree.memtableSize) * uint64(tree.l0CompactionTrigger)
+	for level := 1; level < MaxLevels-1; level++ {
+		byteSize := uint64(0)
+		for _, t := range tree.levels[level] {
+			byteSize += t.byteSize
+		}
+		if byteSize > maxByteSize {
+			return level, true
+		}
+		maxByteSize *= uint64(tree.levelSizeMultiplier)
+	}
+	return 0, false
+}
+
+// compactLevel merges SSTables of the level with the overlapping SSTables of the next level
+// into new SSTables of the next level.
+// All the SSTables of level 0 are compacted at once since they overlap,
+// otherwise the SSTable after the compact pointer of the level is.
+//
+// The tree must be locked, the lock is released while writing the new SSTables.
+// Only the background changes the levels, one flush or compaction at a time,
+// so they stay as picked meanwhile.
+func (tree *Tree) compactLevel(level int) error {
+	inputs := tree.pickInputs(level)
+	lo, hi := inputs[0].smallest, inputs[0].largest
+	for _, t := range inputs[1:] {
+		if bytes.Compare(t.smallest, lo) < 0 {
+			lo = t.smallest
+		}
+		if bytes.Compare(t.largest, hi) > 0 {
+			hi = t.largest
+		}
+	}
+
+	var overlapping, kept []*sstable
+	for _, t := range tree.levels[level+1] {
+		if t.overlaps(lo, hi) {
+			overlapping = append(overlapping, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+
+	iterators := make([]entryIterator, 0, len(inputs)+1)
+	for _, t := range inputs {
+		iterators = append(iterators, t.iterator(nil))
+	}
+	if len(overlapping) > 0 {
+		iterators = append(iterators, newConcatIterator(overlapping, nil))
+	}
+
+	// Tombstones shadow nothing once no deeper level has SSTables.
+	bottom := true
+	for _, tables := range tree.levels[level+2:] {
+		bottom = bottom && len(tables) == 0
+	}
+	tree.mu.Unlock()
+	outputs, err := tree.writeTables(newMergingIterator(iterators...), bottom, uint64(tree.memtableSize), nil)
+	tree.mu.Lock()
+	if err != nil {
+		return err
+	}
+
+	tree.levels[level] = slices.DeleteFunc(tree.levels[level], func(t *sstable) bool {
+		return slices.Contains(inputs, t)
+	})
+	tree.levels[level+1] = append(kept, outputs...)
+	slices.SortFunc(tree.levels[level+1], func(a, b *sstable) int {
+		return bytes.Compare(a.smallest, b.smallest)
+	})
+	tree.compactPointers[level] = hi
+	if err = tree.writeManifest(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, t := range append(inputs, overlapping...) {
+		t.obsolete.Store(true)
+		errs = append(errs, t.unref())
+	}
+	return errors.Join(errs...)
+}
+
+// pickInputs returns the SSTables of the level to compact.
+func (tree *Tree) pickInputs(level int) []*sstable {
+	tables := tree.levels[level]
+	if level == 0 {
+		return slices.Clone(tables)
+	}
+
+	for _, t := range tables {
+		if bytes.Compare(t.smallest, tree.compactPointers[level]) > 0 {
+			return []*sstable{t}
+		}
+	}
+	return []*sstable{tables[0]}
+}
+
+// writeTables writes the entries of the iterator to new SSTables of about targetSize bytes,
+// a zero targetSize writes a single SSTable. Tombstones are dropped if dropTombstones is true.
+// The SSTable of a flushed memtable takes its tombstone count, otherwise each tombstone is counted.
+func (tree *Tree) writeTables(
+	it entryIterator,
+	dropTombstones bool,
+	targetSize uint64,
+	flushed *memtable,
+) ([]*sstable, error) {
+	var tables []*sstable
+	var writer *tableWriter
+	var number uint64
+	fail := func(err error) ([]*sstable, error) {
+		if writer != nil {
+			writer.abort()
+		}
+		for _, t := range tables {
+			t.obsolete.Store(true)
+			_ = t.unref()
+		}
+		return nil, err
+	}
+	finish := func() error {
+		if flushed != nil {
+			writer.tombstones = uint64(flushed.tombstones)
+		}
+		if err := writer.finish(); err != nil {
+			return err
+		}
+		writer = nil
+		t, err := openTable(tree.tablePath(number), number, tree.schema)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, t)
+		return nil
+	}
+
+	for it.Next() {
+		if dropTombstones && it.Record() == nil {
+			continue
+		}
+		if writer == nil {
+			number = tree.newFileNumber()
+			w, err := newTableWriter(tree.tablePath(number), tree.blockSize, tree.fpRate)
+			if err != nil {
+				return fail(err)
+			}
+			writer = w
+		}
+		if err := writer.add(it.Key(), it.Record()); err != nil {
+			return fail(err)
+		}
+		if targetSize > 0 && writer.byteSize() >= targetSize {
+			if err := finish(); err != nil {
+				return fail(err)
+			}
+		}
+	}
+	if err := errors.Join(it.Err(), it.Close()); err != nil {
+		return fail(err)
+	}
+	if writer != nil {
+		if err := finish(); err != nil {
+			return fail(err)
+		}
+	}
+	return tables, nil
+}
@@ -0,0 +1,40 @@
+package lsm
+
+// LevelSizes exposes the number of SSTables of each level to the tests.
+func (tree *Tree) LevelSizes() []int {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	sizes := make([]int, MaxLevels)
+	for level, tables := range tree.levels {
+		sizes[level] = len(tables)
+	}
+	return sizes
+}
+
+// WaitForBackground waits for the background to flush and compact everything it has to.
+func (tree *Tree) WaitForBackground() error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	for !tree.closed && tree.err == nil {
+		if _, ok := tree.pickLevel(); !ok && tree.immutable == nil {
+			break
+		}
+		tree.changed.Wait()
+	}
+	return tree.err
+}
+
+// Crash stops the tree as if the process stopped, leaving the memtables unflushed.
+func (tree *Tree) Crash() error {
+	tree.mu.Lock()
+	tree.closed = true
+	tree.changed.Broadcast()
+	tree.mu.Unlock()
+	<-tree.done
+
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+	return tree.release()
+}
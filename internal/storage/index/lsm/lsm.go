@@ -0,0 +1,553 @@
+// Package lsm implements a log-structured merge tree, an index for write-heavy tables.
+//
+// Writes are appended to a write-ahead log and go to an in-memory memtable,
+// which is flushed to an immutable SSTable file in level 0 once it is full.
+// Leveled compaction then merges the SSTables down the levels,
+// each level holding more bytes than the one above it.
+// Flushes and compactions run in the background, off the write path.
+// Reads look up the memtable, then the SSTables from the newest to the oldest,
+// and each SSTable has a Bloom filter to skip it for the keys it does not have.
+//
+// See P. O'Neil et al., The Log-Structured Merge-Tree (LSM-Tree),
+// and https://github.com/google/leveldb/blob/main/doc/impl.md.
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var (
+	// ErrKeyExists is returned when putting a key already in the tree.
+	ErrKeyExists = index.ErrKeyExists
+	// ErrClosed is returned when using a closed tree.
+	ErrClosed = index.ErrClosed
+)
+
+const (
+	// MaxLevels is the number of levels of SSTables.
+	MaxLevels = 7
+	// DefaultMemtableSize is the bytes the memtable holds before it is flushed.
+	DefaultMemtableSize = 1 << 20
+	// DefaultL0CompactionTrigger is the number of level 0 SSTables compacting level 0.
+	DefaultL0CompactionTrigger = 4
+	// DefaultLevelSizeMultiplier is how many times a level holds more bytes than the one above it.
+	DefaultLevelSizeMultiplier = 10
+	// DefaultFalsePositiveRate is the false-positive rate of the Bloom filters of the SSTables.
+	DefaultFalsePositiveRate = 0.01
+	// l0StallFactor is how many times the level 0 compaction trigger
+	// the number of level 0 SSTables stalls the writes at.
+	l0StallFactor = 3
+)
+
+var _ index.StatisticsKeeper = (*Tree)(nil)
+
+type Option func(*Tree)
+
+// WithMemtableSize sets the bytes the memtable holds before it is flushed,
+// which is also the target byte size of the SSTables compactions write.
+//
+// A full memtable is flushed in the background while a new one takes the writes,
+// the write filling the new one as well stalls until the flush is done.
+// The writes also stall while level 0 holds l0StallFactor times
+// the level 0 compaction trigger SSTables, until a compaction catches up.
+func WithMemtableSize(size int) Option {
+	return func(tree *Tree) {
+		tree.memtableSize = size
+	}
+}
+
+// WithBlockSize sets the target byte size of the data blocks of the SSTables.
+func WithBlockSize(size int) Option {
+	return func(tree *Tree) {
+		tree.blockSize = size
+	}
+}
+
+// WithL0CompactionTrigger sets the number of level 0 SSTables compacting level 0.
+func WithL0CompactionTrigger(n int) Option {
+	return func(tree *Tree) {
+		tree.l0CompactionTrigger = n
+	}
+}
+
+// WithLevelSizeMultiplier sets how many times a level holds more bytes than the one above it.
+func WithLevelSizeMultiplier(n int) Option {
+	return func(tree *Tree) {
+		tree.levelSizeMultiplier = n
+	}
+}
+
+// WithSyncWrites syncs the write-ahead log on each write, so that a write survives an operating system crash.
+// Otherwise a write only survives the process crashing.
+func WithSyncWrites(sync bool) Option {
+	return func(tree *Tree) {
+		tree.syncWrites = sync
+	}
+}
+
+// WithFalsePositiveRate sets the false-positive rate of the Bloom filters of the SSTables.
+func WithFalsePositiveRate(rate float64) Option {
+	return func(tree *Tree) {
+		tree.fpRate = rate
+	}
+}
+
+// Tree is a log-structured merge tree of the records of a schema, keyed by their first column.
+//
+// Records are serialized by table.Record and keys are compared by their memcomparable encoding.
+// The writes to the memtable are appended to its write-ahead log,
+// which is replayed when the tree is opened after the process stopped without closing it.
+type Tree struct {
+	mu     sync.RWMutex
+	dir    string
+	schema *table.Schema
+	closed bool
+
+	memtable *memtable
+	log      *logWriter
+	// immutable is the full memtable the background is flushing, or nil.
+	immutable *memtable
+	// logNumber is the number of the oldest log whose writes are not in the SSTables yet.
+	logNumber uint64
+	// levels[0] holds overlapping SSTables from the newest to the oldest,
+	// the SSTables of a deeper level are disjoint and sorted by key.
+	levels         [MaxLevels][]*sstable
+	nextFileNumber atomic.Uint64
+	// err is the error a background flush or compaction failed with, the writes fail with it afterwards.
+	err error
+	// changed is broadcast when the background has work to do, and when it has done some.
+	changed *sync.Cond
+	// done is closed once the background returns.
+	done chan struct{}
+	// compactPointers are the largest keys compacted in each level,
+	// the next compaction of the level starts after them.
+	compactPointers [MaxLevels][]byte
+	// statistics are the statistics ANALYZE saved in the manifest, nil if never analyzed.
+	statistics *index.Statistics
+
+	memtableSize        int
+	blockSize           int
+	l0CompactionTrigger int
+	levelSizeMultiplier int
+	fpRate              float64
+	syncWrites          bool
+}
+
+// Open the tree stored in the directory, creating it if absent.
+func Open(dir string, schema *table.Schema, opts ...Option) (*Tree, error) {
+	tree := &Tree{
+		dir:                 dir,
+		schema:              schema,
+		done:                make(chan struct{}),
+		memtableSize:        DefaultMemtableSize,
+		blockSize:           config.PageSize,
+		l0CompactionTrigger: DefaultL0CompactionTrigger,
+		levelSizeMultiplier: DefaultLevelSizeMultiplier,
+		fpRate:              DefaultFalsePositiveRate,
+	}
+	tree.nextFileNumber.Store(1)
+	tree.changed = sync.NewCond(&tree.mu)
+	for _, opt := range opts {
+		opt(tree)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil { //nolint:mnd // rwxr-xr-x
+		return nil, err
+	}
+	tree.mu.Lock()
+	err := tree.recover()
+	tree.mu.Unlock()
+	if err != nil {
+		return nil, errors.Join(err, tree.release())
+	}
+	go tree.background()
+	return tree, nil
+}
+
+// NewFactory returns the factory of the trees in an index catalog,
+// each tree is stored in the subdirectory of its index name under the directory.
+// The trees keep their SSTables in files of their own, not in the buffer manager.
+func NewFactory(dir string, opts ...Option) index.Factory {
+	return func(name string, schema *table.Schema, _ memory.BufferManager) (index.Index, error) {
+		return Open(filepath.Join(dir, name), schema, opts...)
+	}
+}
+
+func (tree *Tree) Get(key index.Key) (*table.Record, error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.closed {
+		return nil, ErrClosed
+	}
+	return tree.get(field.EncodeKey(key))
+}
+
+// Put the record under the key, or returns ErrKeyExists if the key is present.
+// Unlike Upsert, it has to look the key up first.
+func (tree *Tree) Put(key index.Key, record *table.Record) error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if err := tree.makeRoom(); err != nil {
+		return err
+	}
+	k := field.EncodeKey(key)
+	old, err := tree.get(k)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		return ErrKeyExists
+	}
+	return tree.write(k, record)
+}
+
+// Upsert puts the record if the key is absent, otherwise replaces the record of the key,
+// without reading anything.
+func (tree *Tree) Upsert(key index.Key, record *table.Record) error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if err := tree.makeRoom(); err != nil {
+		return err
+	}
+	return tree.write(field.EncodeKey(key), record)
+}
+
+// Delete the record of the key by writing a tombstone,
+// which is dropped once compacted into the deepest level.
+func (tree *Tree) Delete(key index.Key) error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if err := tree.makeRoom(); err != nil {
+		return err
+	}
+	return tree.write(field.EncodeKey(key), nil)
+}
+
+// Range returns a sequence of the records whose key lies in [lo, hi),
+// in ascending key order.
+// A nil lo or hi leaves the corresponding side of the range unbounded.
+//
+// It merges a snapshot of the memtable and the SSTables, so the writes
+// while iterating are not seen.
+func (tree *Tree) Range(lo, hi index.Key) iter.Seq2[*table.Record, error] {
+	return func(yield func(*table.Record, error) bool) {
+		var loKey, hiKey []byte
+		if lo != nil {
+			loKey = field.EncodeKey(lo)
+		}
+		if hi != nil {
+			hiKey = field.EncodeKey(hi)
+		}
+
+		it, tables, err := tree.snapshot(loKey, hiKey)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer func() {
+			_ = it.Close()
+			for _, t := range tables {
+				_ = t.unref()
+			}
+		}()
+
+		for it.Next() {
+			if hiKey != nil && bytes.Compare(it.Key(), hiKey) >= 0 {
+				return
+			}
+			if it.Record() == nil {
+				continue
+			}
+			if !yield(it.Record(), nil) {
+				return
+			}
+		}
+		if err = it.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// Stats returns the statistics of the tree without reading the records.
+// PageCount is the number of data blocks, and Height is the number of SSTables
+// a point lookup may read a block of.
+//
+// RecordCount is estimated from the record and tombstone counts of the memtables and the SSTables,
+// each tombstone taking away a record of an older one: a key written to several of them is counted in each,
+// and a tombstone whose record a compaction has already dropped takes away another record.
+func (tree *Tree) Stats() (*index.Stats, error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.closed {
+		return nil, ErrClosed
+	}
+	stats := &index.Stats{Height: len(tree.levels[0])}
+	for _, m := range []*memtable{tree.memtable, tree.immutable} {
+		if m != nil {
+			stats.RecordCount += m.records - m.tombstones
+		}
+	}
+	for level, tables := range tree.levels {
+		if level > 0 && len(tables) > 0 {
+			stats.Height++
+		}
+		for _, t := range tables {
+			stats.PageCount += len(t.index)
+			stats.RecordCount += int(t.records) - int(t.tombstones)
+		}
+	}
+	stats.RecordCount = max(stats.RecordCount, 0)
+	return stats, nil
+}
+
+// SaveStatistics persists the statistics in the manifest.
+func (tree *Tree) SaveStatistics(statistics *index.Statistics) error {
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	if tree.closed {
+		return ErrClosed
+	}
+	saved := *statistics
+	tree.statistics = &saved
+	return tree.writeManifest()
+}
+
+// SavedStatistics returns the statistics SaveStatistics persisted, or index.ErrNotAnalyzed if there are none.
+func (tree *Tree) SavedStatistics() (*index.Statistics, error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.closed {
+		return nil, ErrClosed
+	}
+	if tree.statistics == nil {
+		return nil, index.ErrNotAnalyzed
+	}
+	saved := *tree.statistics
+	return &saved, nil
+}
+
+// Close stops the background, flushes the memtables and closes the SSTables,
+// using the tree afterwards returns ErrClosed.
+// It returns the error a background flush or compaction failed with,
+// the writes of the memtables are then left in their logs to replay.
+func (tree *Tree) Close() error {
+	tree.mu.Lock()
+	if tree.closed {
+		tree.mu.Unlock()
+		return nil
+	}
+	tree.closed = true
+	tree.changed.Broadcast()
+	tree.mu.Unlock()
+	<-tree.done
+
+	tree.mu.Lock()
+	defer tree.mu.Unlock()
+
+	err := errors.Join(tree.err, tree.log.close())
+	tree.log = nil
+	if err == nil && tree.immutable != nil {
+		err = tree.flushImmutable()
+	}
+	if err == nil && tree.memtable.len() > 0 {
+		tree.immutable, tree.memtable = tree.memtable, newMemtable(0)
+		err = tree.flushImmutable()
+	}
+	return errors.Join(err, tree.release())
+}
+
+// release closes the log and the SSTables.
+func (tree *Tree) release() error {
+	var errs []error
+	if tree.log != nil {
+		errs = append(errs, tree.log.close())
+	}
+	for _, tables := range tree.levels {
+		for _, t := range tables {
+			errs = append(errs, t.unref())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// get returns the record of the key from the newest of the memtable and the SSTables.
+func (tree *Tree) get(key []byte) (*table.Record, error) {
+	if record, ok := tree.memtable.get(key); ok {
+		return record, nil
+	}
+	if tree.immutable != nil {
+		if record, ok := tree.immutable.get(key); ok {
+			return record, nil
+		}
+	}
+
+	for _, t := range tree.levels[0] {
+		record, found, err := t.get(key)
+		if err != nil || found {
+			return record, err
+		}
+	}
+	for _, tables := range tree.levels[1:] {
+		i := sort.Search(len(tables), func(i int) bool {
+			return bytes.Compare(tables[i].largest, key) >= 0
+		})
+		if i == len(tables) {
+			continue
+		}
+		record, found, err := tables[i].get(key)
+		if err != nil || found {
+			return record, err
+		}
+	}
+	return nil, nil //nolint:nilnil // nil is returned to indicate the key is absent.
+}
+
+// write the record under the key in the log, then in the memtable.
+func (tree *Tree) write(key []byte, record *table.Record) error {
+	if err := tree.log.add(key, record); err != nil {
+		return err
+	}
+	tree.memtable.put(key, record)
+	return nil
+}
+
+// makeRoom makes room for a write in the memtable, the tree must be locked.
+// A full memtable becomes the immutable memtable for the background to flush,
+// and a new memtable with a new log takes the writes.
+// The write stalls while the immutable memtable is still being flushed,
+// or while level 0 holds too many SSTables.
+func (tree *Tree) makeRoom() error {
+	for {
+		switch {
+		case tree.closed:
+			return ErrClosed
+		case tree.err != nil:
+			return tree.err
+		case tree.memtable.byteSize < tree.memtableSize:
+			return nil
+		case tree.immutable != nil || len(tree.levels[0]) >= l0StallFactor*tree.l0CompactionTrigger:
+			tree.changed.Wait()
+		default:
+			return tree.rotate()
+		}
+	}
+}
+
+// rotate hands the memtable to the background to flush, and starts a new memtable and log.
+func (tree *Tree) rotate() error {
+	number := tree.newFileNumber()
+	log, err := newLogWriter(tree.logPath(number), number, tree.syncWrites)
+	if err != nil {
+		return err
+	}
+	if err = tree.log.close(); err != nil {
+		return errors.Join(err, log.close())
+	}
+
+	tree.log = log
+	tree.immutable, tree.memtable = tree.memtable, newMemtable(number)
+	tree.changed.Broadcast()
+	return nil
+}
+
+// snapshot returns an iterator merging the memtable and the SSTables over [lo, hi),
+// and the SSTables it references, which must be released after use.
+func (tree *Tree) snapshot(lo, hi []byte) (entryIterator, []*sstable, error) {
+	tree.mu.RLock()
+	defer tree.mu.RUnlock()
+
+	if tree.closed {
+		return nil, nil, ErrClosed
+	}
+
+	iterators := []entryIterator{tree.memtable.snapshot(lo, hi)}
+	if tree.immutable != nil {
+		iterators = append(iterators, tree.immutable.snapshot(lo, hi))
+	}
+	var tables []*sstable
+	for level, levelTables := range tree.levels {
+		var overlapping []*sstable
+		for _, t := range levelTables {
+			if t.overlaps(lo, hi) {
+				t.ref()
+				overlapping = append(overlapping, t)
+			}
+		}
+		tables = append(tables, overlapping...)
+
+		if level == 0 {
+			for _, t := range overlapping {
+				iterators = append(iterators, t.iterator(lo))
+			}
+		} else if len(overlapping) > 0 {
+			iterators = append(iterators, newConcatIterator(overlapping, lo))
+		}
+	}
+	return newMergingIterator(iterators...), tables, nil
+}
+
+// concatIterator iterates the entries of disjoint SSTables sorted by key one after another.
+type concatIterator struct {
+	tables  []*sstable
+	lo      []byte
+	current *tableIterator
+	err     error
+}
+
+func newConcatIterator(tables []*sstable, lo []byte) *concatIterator {
+	return &concatIterator{tables: tables, lo: lo}
+}
+
+func (it *concatIterator) Next() bool {
+	for {
+		if it.current != nil && it.current.Next() {
+			return true
+		}
+		if it.current != nil {
+			if it.err = it.current.Err(); it.err != nil {
+				return false
+			}
+		}
+		if len(it.tables) == 0 {
+			return false
+		}
+		it.current = it.tables[0].iterator(it.lo)
+		it.tables = it.tables[1:]
+	}
+}
+
+func (it *concatIterator) Key() []byte {
+	return it.current.Key()
+}
+
+func (it *concatIterator) Record() *table.Record {
+	return it.current.Record()
+}
+
+func (it *concatIterator) Err() error {
+	return it.err
+}
+
+func (it *concatIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,325 @@
+package lsm_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/index/lsm"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("LSM tree", func() {
+	const recordCount = 2000
+
+	var schema *table.Schema
+	var pkType field.Type
+	var dir string
+
+	newRecord := func(key int, name string) *table.Record {
+		return table.NewRecordFromLiteral(key, name, key%2 == 0)
+	}
+
+	open := func() *lsm.Tree {
+		tree, err := lsm.Open(dir, schema,
+			lsm.WithMemtableSize(8*1024),
+			lsm.WithBlockSize(512),
+			lsm.WithL0CompactionTrigger(2),
+			lsm.WithLevelSizeMultiplier(2),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		return tree
+	}
+
+	expectRecord := func(tree *lsm.Tree, key int, name string) {
+		record, err := tree.Get(field.NewValue(pkType, key))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record).ToNot(BeNil(), "key %d", key)
+		Expect(record.Get(1).Val()).To(Equal(name))
+	}
+
+	expectAbsent := func(tree *lsm.Tree, key int) {
+		record, err := tree.Get(field.NewValue(pkType, key))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record).To(BeNil(), "key %d", key)
+	}
+
+	keysOf := func(seq func(func(*table.Record, error) bool)) []int {
+		var keys []int
+		for record, err := range seq {
+			Expect(err).ToNot(HaveOccurred())
+			keys = append(keys, int(record.GetKey().Val().(int32)))
+		}
+		return keys
+	}
+
+	BeforeEach(func() {
+		schema = table.NewSchema().
+			WithField("id", field.NewInteger()).
+			WithField("name", field.NewVarchar()).
+			WithField("is_even", field.NewBoolean())
+		pkType = field.NewInteger()
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should get the records put across flushes and compactions", func() {
+		tree := open()
+		DeferCleanup(tree.Close)
+
+		for _, key := range rand.Perm(recordCount) {
+			Expect(tree.Put(field.NewValue(pkType, key), newRecord(key, fmt.Sprintf("name-%d", key)))).To(Succeed())
+		}
+
+		Expect(tree.WaitForBackground()).To(Succeed())
+		levels := tree.LevelSizes()
+		Expect(levels[0]).To(BeNumerically("<", 2))
+		Expect(levels[2]).To(BeNumerically(">", 0), "levels %v", levels)
+
+		for key := 0; key < recordCount; key++ {
+			expectRecord(tree, key, fmt.Sprintf("name-%d", key))
+		}
+		expectAbsent(tree, recordCount)
+		expectAbsent(tree, -1)
+	})
+
+	It("should not put a key twice", func() {
+		tree := open()
+		DeferCleanup(tree.Close)
+
+		for key := 0; key < recordCount; key++ {
+			Expect(tree.Put(field.NewValue(pkType, key), newRecord(key, "first"))).To(Succeed())
+		}
+		Expect(tree.Put(field.NewValue(pkType, 0), newRecord(0, "second"))).To(MatchError(lsm.ErrKeyExists))
+		Expect(tree.Put(field.NewValue(pkType, recordCount-1), newRecord(0, "second"))).To(MatchError(index.ErrKeyExists))
+	})
+
+	It("should let the newest write of a key win", func() {
+		tree := open()
+		DeferCleanup(tree.Close)
+
+		for round := 0; round < 3; round++ {
+			for key := 0; key < recordCount; key++ {
+				Expect(tree.Upsert(field.NewValue(pkType, key), newRecord(key, fmt.Sprintf("v%d", round)))).To(Succeed())
+			}
+		}
+		for key := 0; key < recordCount; key += 3 {
+			Expect(tree.Delete(field.NewValue(pkType, key))).To(Succeed())
+		}
+
+		for key := 0; key < recordCount; key++ {
+			if key%3 == 0 {
+				expectAbsent(tree, key)
+			} else {
+				expectRecord(tree, key, "v2")
+			}
+		}
+		Expect(tree.Put(field.NewValue(pkType, 0), newRecord(0, "v3"))).To(Succeed())
+		expectRecord(tree, 0, "v3")
+	})
+
+	It("should range over the records in key order", func() {
+		tree := open()
+		DeferCleanup(tree.Close)
+
+		for _, key := range rand.Perm(recordCount) {
+			Expect(tree.Upsert(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+		for key := 0; key < recordCount; key += 2 {
+			Expect(tree.Delete(field.NewValue(pkType, key))).To(Succeed())
+		}
+
+		keys := keysOf(tree.Range(field.NewValue(pkType, 100), field.NewValue(pkType, 200)))
+		Expect(keys).To(HaveLen(50))
+		for i, key := range keys {
+			Expect(key).To(Equal(101 + 2*i))
+		}
+
+		Expect(keysOf(tree.Range(nil, nil))).To(HaveLen(recordCount / 2))
+
+		count := 0
+		for range tree.Range(nil, field.NewValue(pkType, 50)) {
+			count++
+			if count == 10 {
+				break
+			}
+		}
+		Expect(count).To(Equal(10))
+
+		stats, err := tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		// The tombstones meeting their records in a compaction make the count an estimate.
+		Expect(stats.RecordCount).To(BeNumerically("~", recordCount/2, recordCount/10))
+		Expect(stats.PageCount).To(BeNumerically(">", 0))
+		Expect(stats.Height).To(BeNumerically(">", 0))
+	})
+
+	It("should keep a range scan valid while compacting", func() {
+		tree := open()
+		DeferCleanup(tree.Close)
+
+		for key := 0; key < recordCount; key++ {
+			Expect(tree.Upsert(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+
+		count := 0
+		for record, err := range tree.Range(nil, nil) {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(record.GetKey().Val()).To(Equal(int32(count)))
+			// Keep flushing and compacting the SSTables being scanned.
+			key := recordCount + count
+			Expect(tree.Upsert(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+			count++
+		}
+		Expect(count).To(Equal(recordCount))
+	})
+
+	It("should recover the records after reopening", func() {
+		tree := open()
+		for key := 0; key < recordCount; key++ {
+			Expect(tree.Put(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+		Expect(tree.Delete(field.NewValue(pkType, 7))).To(Succeed())
+		Expect(tree.Close()).To(Succeed())
+		Expect(tree.Close()).To(Succeed())
+		_, err := tree.Get(field.NewValue(pkType, 1))
+		Expect(err).To(MatchError(lsm.ErrClosed))
+
+		orphan := filepath.Join(dir, "999999.sst")
+		Expect(os.WriteFile(orphan, []byte("orphan"), 0600)).To(Succeed())
+
+		tree = open()
+		DeferCleanup(tree.Close)
+		Expect(orphan).ToNot(BeAnExistingFile())
+		for key := 0; key < recordCount; key++ {
+			if key == 7 {
+				expectAbsent(tree, key)
+			} else {
+				expectRecord(tree, key, "name")
+			}
+		}
+		Expect(tree.Put(field.NewValue(pkType, 7), newRecord(7, "name"))).To(Succeed())
+	})
+
+	It("should replay the log of the writes not flushed before a crash", func() {
+		tree := open()
+		for key := 0; key < recordCount; key++ {
+			Expect(tree.Put(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+		Expect(tree.Upsert(field.NewValue(pkType, 3), newRecord(3, "renamed"))).To(Succeed())
+		Expect(tree.Delete(field.NewValue(pkType, 7))).To(Succeed())
+		Expect(tree.Crash()).To(Succeed())
+
+		logs, err := filepath.Glob(filepath.Join(dir, "*.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(logs).ToNot(BeEmpty())
+		// A record torn by the crash ends the log.
+		file, err := os.OpenFile(logs[len(logs)-1], os.O_APPEND|os.O_WRONLY, 0)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = file.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+
+		tree = open()
+		for key := 0; key < recordCount; key++ {
+			switch key {
+			case 3:
+				expectRecord(tree, key, "renamed")
+			case 7:
+				expectAbsent(tree, key)
+			default:
+				expectRecord(tree, key, "name")
+			}
+		}
+		Expect(tree.Put(field.NewValue(pkType, 7), newRecord(7, "name"))).To(Succeed())
+		Expect(tree.Crash()).To(Succeed())
+
+		tree = open()
+		DeferCleanup(tree.Close)
+		expectRecord(tree, 7, "name")
+		Expect(keysOf(tree.Range(nil, nil))).To(HaveLen(recordCount))
+	})
+
+	It("should estimate the record count from the record and tombstone counts", func() {
+		tree := open()
+		DeferCleanup(tree.Close)
+
+		keys := rand.Perm(recordCount)
+		for _, key := range keys {
+			Expect(tree.Put(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+		stats, err := tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.RecordCount).To(Equal(recordCount))
+
+		// The last key put is in the memtable, its tombstone replaces its record.
+		last := keys[recordCount-1]
+		Expect(tree.Delete(field.NewValue(pkType, last))).To(Succeed())
+		Expect(tree.Delete(field.NewValue(pkType, last))).To(Succeed())
+		stats, err = tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.RecordCount).To(Equal(recordCount - 1))
+
+		// The first key put is flushed, its tombstone takes its record away.
+		Expect(tree.Delete(field.NewValue(pkType, keys[0]))).To(Succeed())
+		Expect(tree.Delete(field.NewValue(pkType, keys[0]))).To(Succeed())
+		stats, err = tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.RecordCount).To(Equal(recordCount - 2))
+
+		// A key put again after its tombstone counts once more.
+		Expect(tree.Put(field.NewValue(pkType, last), newRecord(last, "name"))).To(Succeed())
+		stats, err = tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.RecordCount).To(Equal(recordCount - 1))
+	})
+
+	It("should keep the record count of a memtable once flushed", func() {
+		tree := open()
+		for key := 0; key < 10; key++ {
+			Expect(tree.Put(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+		Expect(tree.Delete(field.NewValue(pkType, 3))).To(Succeed())
+		Expect(tree.Upsert(field.NewValue(pkType, 5), newRecord(5, "renamed"))).To(Succeed())
+		Expect(tree.Close()).To(Succeed())
+
+		tree = open()
+		DeferCleanup(tree.Close)
+		Expect(tree.LevelSizes()[0]).To(Equal(1))
+		stats, err := tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.RecordCount).To(Equal(9))
+	})
+
+	It("should not resurrect deleted records through compactions", func() {
+		tree := open()
+		DeferCleanup(tree.Close)
+
+		for key := 0; key < recordCount; key++ {
+			Expect(tree.Upsert(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+		for key := 0; key < recordCount; key++ {
+			Expect(tree.Delete(field.NewValue(pkType, key))).To(Succeed())
+		}
+		// Push the tombstones down with unrelated writes.
+		for key := recordCount; key < 3*recordCount; key++ {
+			Expect(tree.Upsert(field.NewValue(pkType, key), newRecord(key, "name"))).To(Succeed())
+		}
+
+		Expect(keysOf(tree.Range(nil, field.NewValue(pkType, recordCount)))).To(BeEmpty())
+		stats, err := tree.Stats()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stats.RecordCount).To(BeNumerically("~", 2*recordCount, recordCount))
+	})
+})
+
+func TestLSM(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LSM Tree Suite")
+}
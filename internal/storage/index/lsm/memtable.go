@@ -0,0 +1,106 @@
+package lsm
+
+import (
+	"bytes"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+// memtable buffers the latest writes in memory, sorted by encoded key.
+// A nil record is a tombstone, which shadows the record of the key in the SSTables.
+type memtable struct {
+	entries *ds.SkipList[[]byte, *table.Record]
+	// byteSize approximates the bytes the entries take in an SSTable.
+	byteSize int
+	// records is the number of the entries that are records.
+	records int
+	// tombstones is the number of the tombstones taking away a record of an older memtable or SSTable,
+	// the ones of the keys first written as records here take away the record they replaced.
+	tombstones int
+	// logNumber is the number of the write-ahead log the entries are written to.
+	logNumber uint64
+}
+
+func newMemtable(logNumber uint64) *memtable {
+	return &memtable{
+		entries:   ds.NewSkipList[[]byte, *table.Record](bytes.Compare),
+		logNumber: logNumber,
+	}
+}
+
+func (m *memtable) get(key []byte) (*table.Record, bool) {
+	return m.entries.Get(key)
+}
+
+// put the record under the key, a nil record deletes the key.
+func (m *memtable) put(key []byte, record *table.Record) {
+	old, ok := m.entries.Get(key)
+	switch {
+	case !ok && record == nil:
+		m.tombstones++
+	case !ok || old == nil && record != nil:
+		m.records++
+	case old != nil && record == nil:
+		m.records--
+	}
+	m.entries.Put(key, record)
+	m.byteSize += len(key) + 1
+	if record != nil {
+		m.byteSize += record.ByteSize()
+	}
+}
+
+func (m *memtable) len() int {
+	return m.entries.Len()
+}
+
+// snapshot returns an iterator of the entries whose key lies in [lo, hi),
+// copied so that it stays valid while the memtable changes.
+func (m *memtable) snapshot(lo, hi []byte) *sliceIterator {
+	it := &sliceIterator{pos: -1}
+	seq := m.entries.All()
+	if lo != nil {
+		seq = m.entries.Seek(lo)
+	}
+	for key, record := range seq {
+		if hi != nil && bytes.Compare(key, hi) >= 0 {
+			break
+		}
+		it.entries = append(it.entries, entry{key: key, record: record})
+	}
+	return it
+}
+
+// entry is a key and its record, or a tombstone if the record is nil.
+type entry struct {
+	key    []byte
+	record *table.Record
+}
+
+// sliceIterator iterates the entries of a slice.
+type sliceIterator struct {
+	entries []entry
+	pos     int
+}
+
+func (it *sliceIterator) Next() bool {
+	it.pos++
+	return it.pos < len(it.entries)
+}
+
+func (it *sliceIterator) Key() []byte {
+	return it.entries[it.pos].key
+}
+
+func (it *sliceIterator) Record() *table.Record {
+	return it.entries[it.pos].record
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package lsm
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// entryIterator iterates entries in ascending key order, a nil record is a tombstone.
+type entryIterator interface {
+	// Next moves to the next entry, and returns false at the end or on an error.
+	Next() bool
+	Key() []byte
+	Record() *table.Record
+	Err() error
+	Close() error
+}
+
+// mergingIterator merges the entries of several iterators in ascending key order.
+//
+// The iterators are ordered from the newest to the oldest,
+// so that when several of them have an entry of the same key,
+// only the one of the newest iterator is kept.
+type mergingIterator struct {
+	iterators []entryIterator
+	heap      iteratorHeap
+	current   *heapItem
+	started   bool
+	err       error
+}
+
+func newMergingIterator(iterators ...entryIterator) *mergingIterator {
+	return &mergingIterator{iterators: iterators}
+}
+
+func (m *mergingIterator) Next() bool {
+	if !m.started {
+		m.started = true
+		for i, it := range m.iterators {
+			m.advance(i, it)
+		}
+	} else if m.current != nil {
+		// Skip the older entries of the key just yielded.
+		key := m.current.iterator.Key()
+		m.advance(m.current.priority, m.current.iterator)
+		for m.err == nil && len(m.heap) > 0 && bytes.Equal(m.heap[0].iterator.Key(), key) {
+			top := heap.Pop(&m.heap).(heapItem) //nolint:errcheck,forcetypeassert // The heap only holds heapItem.
+			m.advance(top.priority, top.iterator)
+		}
+	}
+
+	if m.err != nil || len(m.heap) == 0 {
+		m.current = nil
+		return false
+	}
+
+	top := heap.Pop(&m.heap).(heapItem) //nolint:errcheck,forcetypeassert // The heap only holds heapItem.
+	m.current = &top
+	return true
+}
+
+func (m *mergingIterator) Key() []byte {
+	return m.current.iterator.Key()
+}
+
+func (m *mergingIterator) Record() *table.Record {
+	return m.current.iterator.Record()
+}
+
+func (m *mergingIterator) Err() error {
+	return m.err
+}
+
+func (m *mergingIterator) Close() error {
+	errs := make([]error, 0, len(m.iterators))
+	for _, it := range m.iterators {
+		errs = append(errs, it.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// advance moves the iterator of the priority to its next entry and pushes it back into the heap.
+func (m *mergingIterator) advance(priority int, it entryIterator) {
+	if it.Next() {
+		heap.Push(&m.heap, heapItem{priority: priority, iterator: it})
+		return
+	}
+	if err := it.Err(); err != nil {
+		m.err = errors.Join(m.err, err)
+	}
+}
+
+type heapItem struct {
+	// priority is the position of the iterator, the lower the newer.
+	priority int
+	iterator entryIterator
+}
+
+// iteratorHeap orders the iterators by their current key, then by their priority.
+type iteratorHeap []heapItem
+
+func (h iteratorHeap) Len() int {
+	return len(h)
+}
+
+func (h iteratorHeap) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].iterator.Key(), h[j].iterator.Key()); c != 0 {
+		return c < 0
+	}
+	return h[i].priority < h[j].priority
+}
+
+func (h iteratorHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *iteratorHeap) Push(x any) {
+	*h = append(*h, x.(heapItem)) //nolint:errcheck,forcetypeassert // The heap only holds heapItem.
+}
+
+func (h *iteratorHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
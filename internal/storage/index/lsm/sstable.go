@@ -0,0 +1,512 @@
+package lsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+// ErrCorruptedTable is returned when an SSTable file is malformed.
+var ErrCorruptedTable = errors.New("corrupted sstable")
+
+const (
+	// footerByteSize is the byte size of the filter and index block handles, the record and tombstone counts
+	// and the magic number.
+	footerByteSize = 7 * 8
+	tableMagic     = uint64(0x6c696272614c534d)
+)
+
+const (
+	kindDelete byte = iota
+	kindPut
+)
+
+// blockHandle locates a data block in an SSTable file.
+type blockHandle struct {
+	// lastKey is the largest key of the block.
+	lastKey []byte
+	offset  uint64
+	length  uint64
+}
+
+// tableWriter writes the entries added in ascending key order to an SSTable file.
+//
+// An SSTable file is laid out as follows:
+//
+// +-------------------+
+// | Data Block 1      |
+// | ...               |
+// | Data Block n      |
+// +-------------------+
+// | Filter Block      |  Bloom filter of the keys.
+// +-------------------+
+// | Index Block       |  block handles and the smallest key.
+// +-------------------+
+// | Footer            |  filter and index block handles, record and tombstone counts and magic number.
+// +-------------------+
+//
+// A data block is a sequence of entries, each entry is
+// | key length (uvarint) | encoded key | kind | record length (uvarint) | record |,
+// where a tombstone of kindDelete has no record length nor record.
+// The records are serialized by table.Record.ToBytes.
+type tableWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	offset uint64
+
+	blockSize int
+	block     []byte
+	lastKey   []byte
+	index     []blockHandle
+	// keys are kept to size the Bloom filter when finishing.
+	keys    [][]byte
+	records uint64
+	// tombstones is the number of the tombstones taking away a record of an older SSTable.
+	tombstones uint64
+	fpRate     float64
+}
+
+func newTableWriter(path string, blockSize int, fpRate float64) (*tableWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644) //nolint:mnd // rw-r--r--
+	if err != nil {
+		return nil, err
+	}
+	return &tableWriter{
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		blockSize: blockSize,
+		fpRate:    fpRate,
+	}, nil
+}
+
+// add an entry, a nil record is a tombstone.
+func (w *tableWriter) add(key []byte, record *table.Record) error {
+	w.block = appendEntry(w.block, key, record)
+	if record == nil {
+		w.tombstones++
+	} else {
+		w.records++
+	}
+	w.lastKey = key
+	w.keys = append(w.keys, key)
+
+	if len(w.block) >= w.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+// byteSize returns the bytes of the data blocks written so far.
+func (w *tableWriter) byteSize() uint64 {
+	return w.offset + uint64(len(w.block))
+}
+
+func (w *tableWriter) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+
+	handle, err := w.write(w.block)
+	if err != nil {
+		return err
+	}
+	handle.lastKey = w.lastKey
+	w.index = append(w.index, handle)
+	w.block = w.block[:0]
+	return nil
+}
+
+func (w *tableWriter) write(buf []byte) (blockHandle, error) {
+	handle := blockHandle{offset: w.offset, length: uint64(len(buf))}
+	if _, err := w.writer.Write(buf); err != nil {
+		return handle, err
+	}
+	w.offset += uint64(len(buf))
+	return handle, nil
+}
+
+// finish writes the filter block, the index block and the footer, and syncs the file.
+func (w *tableWriter) finish() error {
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+
+	filter := ds.NewBloomFilter(len(w.keys), w.fpRate)
+	for _, key := range w.keys {
+		filter.Add(key)
+	}
+	filterBytes, err := filter.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	filterHandle, err := w.write(filterBytes)
+	if err != nil {
+		return err
+	}
+
+	var indexBytes []byte
+	indexBytes = binary.AppendUvarint(indexBytes, uint64(len(w.index)))
+	for _, handle := range w.index {
+		indexBytes = binary.AppendUvarint(indexBytes, uint64(len(handle.lastKey)))
+		indexBytes = append(indexBytes, handle.lastKey...)
+		indexBytes = binary.AppendUvarint(indexBytes, handle.offset)
+		indexBytes = binary.AppendUvarint(indexBytes, handle.length)
+	}
+	var smallest []byte
+	if len(w.keys) > 0 {
+		smallest = w.keys[0]
+	}
+	indexBytes = binary.AppendUvarint(indexBytes, uint64(len(smallest)))
+	indexBytes = append(indexBytes, smallest...)
+	indexHandle, err := w.write(indexBytes)
+	if err != nil {
+		return err
+	}
+
+	footer := make([]byte, 0, footerByteSize)
+	footer = binary.LittleEndian.AppendUint64(footer, filterHandle.offset)
+	footer = binary.LittleEndian.AppendUint64(footer, filterHandle.length)
+	footer = binary.LittleEndian.AppendUint64(footer, indexHandle.offset)
+	footer = binary.LittleEndian.AppendUint64(footer, indexHandle.length)
+	footer = binary.LittleEndian.AppendUint64(footer, w.records)
+	footer = binary.LittleEndian.AppendUint64(footer, w.tombstones)
+	footer = binary.LittleEndian.AppendUint64(footer, tableMagic)
+	if _, err = w.write(footer); err != nil {
+		return err
+	}
+
+	if err = w.writer.Flush(); err != nil {
+		return err
+	}
+	if err = w.file.Sync(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+// abort closes and removes the unfinished file.
+func (w *tableWriter) abort() {
+	_ = w.file.Close()
+	_ = os.Remove(w.file.Name())
+}
+
+// sstable is an immutable sorted file of entries.
+//
+// It is reference counted, the tree holds a reference as long as the table is live,
+// and a range scan holds one while iterating it.
+// The file is closed when the last reference is released,
+// and removed as well if a compaction has made the table obsolete.
+type sstable struct {
+	number uint64
+	file   *os.File
+	schema *table.Schema
+
+	index    []blockHandle
+	filter   *ds.BloomFilter
+	smallest []byte
+	largest  []byte
+	// records is the number of the entries that are records.
+	records uint64
+	// tombstones is the number of the tombstones taking away a record of an older SSTable.
+	tombstones uint64
+	// byteSize is the byte size of the file.
+	byteSize uint64
+
+	refs     atomic.Int32
+	obsolete atomic.Bool
+}
+
+func openTable(path string, number uint64, schema *table.Schema) (*sstable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &sstable{number: number, file: file, schema: schema}
+	if err = t.load(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("%w: %s: %w", ErrCorruptedTable, path, err)
+	}
+	t.refs.Store(1)
+	return t, nil
+}
+
+// load reads the footer, the filter block and the index block.
+func (t *sstable) load() error {
+	info, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	t.byteSize = uint64(info.Size())
+	if t.byteSize < footerByteSize {
+		return errors.New("file too small")
+	}
+
+	footer, err := t.read(blockHandle{offset: t.byteSize - footerByteSize, length: footerByteSize})
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint64(footer[48:]) != tableMagic {
+		return errors.New("bad magic number")
+	}
+	filterHandle := blockHandle{
+		offset: binary.LittleEndian.Uint64(footer[0:]),
+		length: binary.LittleEndian.Uint64(footer[8:]),
+	}
+	indexHandle := blockHandle{
+		offset: binary.LittleEndian.Uint64(footer[16:]),
+		length: binary.LittleEndian.Uint64(footer[24:]),
+	}
+	t.records = binary.LittleEndian.Uint64(footer[32:])
+	t.tombstones = binary.LittleEndian.Uint64(footer[40:])
+
+	filterBytes, err := t.read(filterHandle)
+	if err != nil {
+		return err
+	}
+	t.filter = &ds.BloomFilter{}
+	if err = t.filter.UnmarshalBinary(filterBytes); err != nil {
+		return err
+	}
+
+	indexBytes, err := t.read(indexHandle)
+	if err != nil {
+		return err
+	}
+	return t.loadIndex(indexBytes)
+}
+
+func (t *sstable) loadIndex(buf []byte) error {
+	r := bytes.NewReader(buf)
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return nil, errors.New("bad index block")
+		}
+		b := make([]byte, n)
+		_, _ = r.Read(b)
+		return b, nil
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	t.index = make([]blockHandle, 0, min(count, uint64(len(buf))))
+	for i := uint64(0); i < count; i++ {
+		var handle blockHandle
+		if handle.lastKey, err = readBytes(); err != nil {
+			return err
+		}
+		if handle.offset, err = binary.ReadUvarint(r); err != nil {
+			return err
+		}
+		if handle.length, err = binary.ReadUvarint(r); err != nil {
+			return err
+		}
+		t.index = append(t.index, handle)
+	}
+	if t.smallest, err = readBytes(); err != nil {
+		return err
+	}
+	if len(t.index) > 0 {
+		t.largest = t.index[len(t.index)-1].lastKey
+	}
+	return nil
+}
+
+func (t *sstable) read(handle blockHandle) ([]byte, error) {
+	if handle.offset+handle.length > t.byteSize {
+		return nil, ErrCorruptedTable
+	}
+	buf := make([]byte, handle.length)
+	if _, err := t.file.ReadAt(buf, int64(handle.offset)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// get returns the record of the key, and whether the table has an entry of the key,
+// the record is nil if the entry is a tombstone.
+func (t *sstable) get(key []byte) (*table.Record, bool, error) {
+	if bytes.Compare(key, t.smallest) < 0 || bytes.Compare(key, t.largest) > 0 || !t.filter.MayContain(key) {
+		return nil, false, nil
+	}
+
+	i := t.blockOf(key)
+	if i == len(t.index) {
+		return nil, false, nil
+	}
+	block, err := t.read(t.index[i])
+	if err != nil {
+		return nil, false, err
+	}
+
+	for offset := 0; offset < len(block); {
+		entryKey, recordBytes, n, decodeErr := decodeEntry(block[offset:])
+		if decodeErr != nil {
+			return nil, false, decodeErr
+		}
+		offset += n
+
+		switch c := bytes.Compare(entryKey, key); {
+		case c < 0:
+			continue
+		case c > 0:
+			return nil, false, nil
+		}
+		if recordBytes == nil {
+			return nil, true, nil
+		}
+		record, _ := table.RecordFromBytes(recordBytes, t.schema)
+		return record, true, nil
+	}
+	return nil, false, nil
+}
+
+// blockOf returns the first block whose last key is not less than the key.
+func (t *sstable) blockOf(key []byte) int {
+	return sort.Search(len(t.index), func(i int) bool {
+		return bytes.Compare(t.index[i].lastKey, key) >= 0
+	})
+}
+
+// overlaps returns true if the keys of the table may lie in [lo, hi], a nil bound is unbounded.
+func (t *sstable) overlaps(lo, hi []byte) bool {
+	return (lo == nil || bytes.Compare(t.largest, lo) >= 0) && (hi == nil || bytes.Compare(t.smallest, hi) <= 0)
+}
+
+// iterator returns an iterator of the entries from the first key not less than lo.
+// The table must be referenced as long as the iterator is used.
+func (t *sstable) iterator(lo []byte) *tableIterator {
+	it := &tableIterator{table: t, lo: lo, blockIndex: -1}
+	if lo != nil {
+		it.blockIndex = t.blockOf(lo) - 1
+	}
+	return it
+}
+
+func (t *sstable) ref() {
+	t.refs.Add(1)
+}
+
+// unref releases a reference, closing the file on the last one,
+// and removing it if the table is obsolete.
+func (t *sstable) unref() error {
+	if t.refs.Add(-1) > 0 {
+		return nil
+	}
+
+	err := t.file.Close()
+	if t.obsolete.Load() {
+		err = errors.Join(err, os.Remove(t.file.Name()))
+	}
+	return err
+}
+
+// tableIterator iterates the entries of an SSTable block by block.
+type tableIterator struct {
+	table      *sstable
+	lo         []byte
+	blockIndex int
+	block      []byte
+	offset     int
+
+	key    []byte
+	record *table.Record
+	err    error
+}
+
+func (it *tableIterator) Next() bool {
+	for it.err == nil {
+		if it.offset >= len(it.block) {
+			it.blockIndex++
+			if it.blockIndex >= len(it.table.index) {
+				return false
+			}
+			it.block, it.err = it.table.read(it.table.index[it.blockIndex])
+			it.offset = 0
+			continue
+		}
+
+		key, recordBytes, n, err := decodeEntry(it.block[it.offset:])
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.offset += n
+		if it.lo != nil && bytes.Compare(key, it.lo) < 0 {
+			continue
+		}
+
+		it.key = key
+		it.record = nil
+		if recordBytes != nil {
+			it.record, _ = table.RecordFromBytes(recordBytes, it.table.schema)
+		}
+		return true
+	}
+	return false
+}
+
+func (it *tableIterator) Key() []byte {
+	return it.key
+}
+
+func (it *tableIterator) Record() *table.Record {
+	return it.record
+}
+
+func (it *tableIterator) Err() error {
+	return it.err
+}
+
+func (it *tableIterator) Close() error {
+	return nil
+}
+
+// appendEntry appends the encoding of the entry to the buffer, a nil record is a tombstone.
+func appendEntry(buf []byte, key []byte, record *table.Record) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	if record == nil {
+		return append(buf, kindDelete)
+	}
+	recordBytes := record.ToBytes()
+	buf = append(buf, kindPut)
+	buf = binary.AppendUvarint(buf, uint64(len(recordBytes)))
+	return append(buf, recordBytes...)
+}
+
+// decodeEntry decodes the entry the block starts with,
+// and returns its key, its record bytes or nil for a tombstone, and its byte size.
+func decodeEntry(block []byte) ([]byte, []byte, int, error) {
+	keyLength, n := binary.Uvarint(block)
+	if n <= 0 || uint64(len(block)-n) <= keyLength {
+		return nil, nil, 0, ErrCorruptedTable
+	}
+	offset := n
+	key := block[offset : offset+int(keyLength)]
+	offset += int(keyLength)
+
+	kind := block[offset]
+	offset++
+	if kind == kindDelete {
+		return key, nil, offset, nil
+	}
+
+	recordLength, n := binary.Uvarint(block[offset:])
+	if n <= 0 || uint64(len(block)-offset-n) < recordLength {
+		return nil, nil, 0, ErrCorruptedTable
+	}
+	offset += n
+	return key, block[offset : offset+int(recordLength)], offset + int(recordLength), nil
+}
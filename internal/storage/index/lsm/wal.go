@@ -0,0 +1,96 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+const (
+	logFileSuffix = ".log"
+	// logHeaderByteSize is the byte size of the checksum and the length heading each log record.
+	logHeaderByteSize = 4 + 4
+)
+
+// logWriter appends the writes to the memtable to a write-ahead log file,
+// so that the memtable is recovered from it after a crash.
+//
+// Each write is a log record laid out as
+// | checksum (4) | length (4) | entry |,
+// where the entry is encoded as in the data blocks of the SSTables,
+// and the checksum is the CRC-32 of the entry.
+// A record torn by a crash is detected by its checksum, and ends the replay of the log.
+type logWriter struct {
+	file   *os.File
+	number uint64
+	sync   bool
+	buf    []byte
+}
+
+func newLogWriter(path string, number uint64, sync bool) (*logWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644) //nolint:mnd // rw-r--r--
+	if err != nil {
+		return nil, err
+	}
+	return &logWriter{file: file, number: number, sync: sync}, nil
+}
+
+// add appends the entry to the log, a nil record is a tombstone.
+// The record reaches the operating system before add returns,
+// and the disk as well if the log syncs its writes.
+func (w *logWriter) add(key []byte, record *table.Record) error {
+	w.buf = append(w.buf[:0], make([]byte, logHeaderByteSize)...)
+	w.buf = appendEntry(w.buf, key, record)
+	entry := w.buf[logHeaderByteSize:]
+	binary.LittleEndian.PutUint32(w.buf[0:], crc32.ChecksumIEEE(entry))
+	binary.LittleEndian.PutUint32(w.buf[4:], uint32(len(entry)))
+
+	if _, err := w.file.Write(w.buf); err != nil {
+		return err
+	}
+	if w.sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+// close syncs and closes the log file.
+func (w *logWriter) close() error {
+	return errors.Join(w.file.Sync(), w.file.Close())
+}
+
+// replayLog puts the entries of the log file in the memtable in the order they were written,
+// up to the first torn record.
+func replayLog(path string, m *memtable, schema *table.Schema) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for len(buf) >= logHeaderByteSize {
+		checksum := binary.LittleEndian.Uint32(buf[0:])
+		length := binary.LittleEndian.Uint32(buf[4:])
+		if uint64(len(buf)-logHeaderByteSize) < uint64(length) {
+			return nil
+		}
+		entry := buf[logHeaderByteSize : logHeaderByteSize+int(length)]
+		if crc32.ChecksumIEEE(entry) != checksum {
+			return nil
+		}
+
+		key, recordBytes, _, decodeErr := decodeEntry(entry)
+		if decodeErr != nil {
+			return decodeErr
+		}
+		var record *table.Record
+		if recordBytes != nil {
+			record, _ = table.RecordFromBytes(recordBytes, schema)
+		}
+		m.put(key, record)
+		buf = buf[logHeaderByteSize+int(length):]
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package index
+
+import (
+	"math/rand/v2"
+	"slices"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+const (
+	// hyperLogLogPrecision is the precision of the sketches estimating the distinct keys,
+	// 4 KiB of registers for a standard error of about 1.6%.
+	hyperLogLogPrecision = 12
+	// DefaultHistogramBuckets is the number of buckets of a key histogram.
+	DefaultHistogramBuckets = 32
+	// DefaultSampleSize is the number of keys a key histogram is built from.
+	DefaultSampleSize = 1024
+)
+
+// Statistics are the statistics of an index ANALYZE collects for the query optimizer.
+type Statistics struct {
+	Stats
+	// DistinctKeys is the estimated number of distinct leading key values, the first elements
+	// of tuple keys, such as the secondary keys of the entries of a non-unique secondary index,
+	// or the keys themselves.
+	DistinctKeys int
+}
+
+// StatisticsKeeper is an index persisting the statistics ANALYZE collects in its own metadata,
+// so that they are found again once the index is reopened.
+type StatisticsKeeper interface {
+	Index
+	// SaveStatistics persists the statistics in the metadata of the index, replacing the ones saved before.
+	SaveStatistics(statistics *Statistics) error
+	// SavedStatistics returns the statistics SaveStatistics persisted, or ErrNotAnalyzed if there are none.
+	SavedStatistics() (*Statistics, error)
+}
+
+// Analyze scans the index and returns its statistics,
+// counting the records it scans rather than trusting the estimate of Stats.
+//
+// The distinct keys are estimated by a HyperLogLog sketch of the keys built on demand by the scan,
+// the indexes do not maintain one as they are written.
+func Analyze(idx Index) (*Statistics, error) {
+	stats, err := idx.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	sketch := ds.NewHyperLogLog(hyperLogLogPrecision)
+	stats.RecordCount = 0
+	for record, rangeErr := range idx.Range(nil, nil) {
+		if rangeErr != nil {
+			return nil, rangeErr
+		}
+		sketch.Add(field.EncodeKey(leadingValue(KeyOf(idx, record))))
+		stats.RecordCount++
+	}
+	return &Statistics{
+		Stats: *stats,
+		// The estimate is off by a few percent, but the records are counted exactly.
+		DistinctKeys: min(sketch.Estimate(), stats.RecordCount),
+	}, nil
+}
+
+// leadingValue returns the first element of a tuple key, or the key itself.
+func leadingValue(key Key) field.Value {
+	if values, ok := key.Val().([]field.Value); ok && len(values) > 0 {
+		return values[0]
+	}
+	return key
+}
+
+// Histogram is an equi-depth histogram of the keys of an index,
+// whose buckets hold about as many records.
+type Histogram struct {
+	// Bounds are the inclusive upper bounds of the buckets in ascending order,
+	// a bucket holds the keys greater than the bound of the previous bucket up to its own.
+	Bounds []Key
+	// Counts are the estimated numbers of records of the buckets.
+	Counts []int
+}
+
+// SampleHistogram returns a histogram of at most buckets buckets of the keys of the index,
+// built from a uniform sample of sampleSize keys.
+//
+// The keys are the ones the index extracts from its records, see KeyOf.
+// The sample is drawn by reservoir sampling in a single scan of the index,
+// so no key of the index is more likely to be sampled than another one.
+func SampleHistogram(idx Index, buckets, sampleSize int) (*Histogram, error) {
+	buckets, sampleSize = max(buckets, 1), max(sampleSize, 1)
+	sample := make([]Key, 0, sampleSize)
+	seen := 0
+	for record, err := range idx.Range(nil, nil) {
+		if err != nil {
+			return nil, err
+		}
+		seen++
+		if len(sample) < sampleSize {
+			sample = append(sample, KeyOf(idx, record))
+		} else if i := rand.IntN(seen); i < sampleSize { //nolint:gosec // sampling needs no secure randomness.
+			sample[i] = KeyOf(idx, record)
+		}
+	}
+	slices.SortFunc(sample, func(a, b Key) int {
+		return a.Compare(b)
+	})
+
+	histogram := &Histogram{}
+	depth := (len(sample) + buckets - 1) / buckets
+	for start := 0; start < len(sample); {
+		end := min(start+depth, len(sample))
+		// The keys equal to the bound fall in the bucket of the bound.
+		for end < len(sample) && sample[end].Compare(sample[end-1]) == 0 {
+			end++
+		}
+		histogram.Bounds = append(histogram.Bounds, sample[end-1])
+		histogram.Counts = append(histogram.Counts, (end-start)*seen/len(sample))
+		start = end
+	}
+	return histogram, nil
+}
+
+// Selectivity returns the estimated fraction of the records whose key lies in [lo, hi).
+// A nil lo or hi leaves the corresponding side of the range unbounded.
+//
+// The buckets entirely in the range count in full, and the ones the range cuts count for half.
+func (h *Histogram) Selectivity(lo, hi Key) float64 {
+	total, selected := 0.0, 0.0
+	for i, bound := range h.Bounds {
+		count := float64(h.Counts[i])
+		total += count
+
+		// The keys of the bucket lie in (previous bound, bound].
+		if lo != nil && bound.Compare(lo) < 0 {
+			continue
+		}
+		if hi != nil && i > 0 && h.Bounds[i-1].Compare(hi) >= 0 {
+			continue
+		}
+
+		lowerCut := lo != nil && (i == 0 || h.Bounds[i-1].Compare(lo) < 0)
+		upperCut := hi != nil && bound.Compare(hi) >= 0
+		if lowerCut || upperCut {
+			count /= 2
+		}
+		selected += count
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return selected / total
+}
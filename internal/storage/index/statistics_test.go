@@ -0,0 +1,161 @@
+package index_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/index"
+	"github.com/Huangkai1008/libradb/internal/storage/index/art"
+	"github.com/Huangkai1008/libradb/internal/storage/index/bplustree"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+func newIndex(t *testing.T, recordCount int) index.Index {
+	t.Helper()
+
+	pkType := field.NewInteger()
+	idx := art.NewIndex(newSchema())
+	for _, key := range rand.Perm(recordCount) {
+		require.NoError(t, idx.Put(field.NewValue(pkType, key), table.NewRecordFromLiteral(key, "name")))
+	}
+	return idx
+}
+
+// newCompositeTree returns a B+ tree keyed by the city then the id of its records,
+// whose first column is the id.
+func newCompositeTree(t *testing.T, recordCount, cityCount int) *bplustree.BPlusTree {
+	t.Helper()
+
+	bufferManager := memory.NewBufferPool(1024, disk.NewMemoryDiskManager(), memory.NewLRUKReplacer(2))
+	t.Cleanup(func() {
+		_ = bufferManager.Close()
+	})
+	schema := table.NewSchema().
+		WithField("id", field.NewInteger()).
+		WithField("city", field.NewVarchar())
+	tree, err := bplustree.NewBPlusTree(&bplustree.Metadata{
+		Order:      4,
+		Schema:     schema,
+		KeyColumns: []bplustree.KeyColumn{{Index: 1}, {Index: 0}},
+	}, bufferManager)
+	require.NoError(t, err)
+
+	for _, id := range rand.Perm(recordCount) {
+		record := table.NewRecordFromLiteral(id, fmt.Sprintf("city-%02d", id%cityCount))
+		require.NoError(t, tree.Put(tree.KeyOf(record), record))
+	}
+	return tree
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Run("scalar keys", func(t *testing.T) {
+		statistics, err := index.Analyze(newIndex(t, 5000))
+		require.NoError(t, err)
+		assert.Equal(t, 5000, statistics.RecordCount)
+		assert.InDelta(t, 5000, statistics.DistinctKeys, 250)
+	})
+
+	t.Run("leading values of tuple keys", func(t *testing.T) {
+		varchar, integer := field.NewVarchar(), field.NewInteger()
+		tupleType := field.NewTuple([]field.Type{varchar, integer})
+		idx := art.NewIndex(table.NewSchema().WithField("city_id", tupleType))
+		for id := 0; id < 3000; id++ {
+			key := field.NewValue(tupleType, []field.Value{
+				field.NewValue(varchar, fmt.Sprintf("city-%d", id%60)), field.NewValue(integer, id),
+			})
+			require.NoError(t, idx.Put(key, table.NewRecord(key)))
+		}
+
+		statistics, err := index.Analyze(idx)
+		require.NoError(t, err)
+		assert.Equal(t, 3000, statistics.RecordCount)
+		assert.InDelta(t, 60, statistics.DistinctKeys, 3)
+	})
+
+	t.Run("composite keys", func(t *testing.T) {
+		statistics, err := index.Analyze(newCompositeTree(t, 3000, 60))
+		require.NoError(t, err)
+		assert.Equal(t, 3000, statistics.RecordCount)
+		// The leading key column is the city, not the id in the first column.
+		assert.InDelta(t, 60, statistics.DistinctKeys, 3)
+	})
+
+	t.Run("closed index", func(t *testing.T) {
+		idx := newIndex(t, 10)
+		require.NoError(t, idx.Close())
+		_, err := index.Analyze(idx)
+		require.ErrorIs(t, err, index.ErrClosed)
+	})
+}
+
+func TestSampleHistogram(t *testing.T) {
+	pkType := field.NewInteger()
+	key := func(k int) index.Key {
+		return field.NewValue(pkType, k)
+	}
+
+	t.Run("every key sampled", func(t *testing.T) {
+		histogram, err := index.SampleHistogram(newIndex(t, 1000), 10, 1000)
+		require.NoError(t, err)
+		require.Len(t, histogram.Bounds, 10)
+		for i, bound := range histogram.Bounds {
+			assert.Equal(t, int32(100*i+99), bound.Val())
+			assert.Equal(t, 100, histogram.Counts[i])
+		}
+
+		assert.InDelta(t, 1, histogram.Selectivity(nil, nil), 1e-9)
+		assert.InDelta(t, 0.5, histogram.Selectivity(key(0), key(500)), 1e-9)
+		assert.InDelta(t, 0.05, histogram.Selectivity(key(950), nil), 1e-9)
+		assert.Zero(t, histogram.Selectivity(key(2000), nil))
+	})
+
+	t.Run("sampled keys", func(t *testing.T) {
+		histogram, err := index.SampleHistogram(newIndex(t, 10000), 8, 400)
+		require.NoError(t, err)
+		require.Len(t, histogram.Bounds, 8)
+
+		total := 0
+		for i, count := range histogram.Counts {
+			total += count
+			if i > 0 {
+				assert.Positive(t, histogram.Bounds[i].Compare(histogram.Bounds[i-1]))
+			}
+		}
+		assert.InDelta(t, 10000, total, 8)
+		assert.InDelta(t, 0.25, histogram.Selectivity(nil, key(2500)), 0.1)
+	})
+
+	t.Run("composite keys", func(t *testing.T) {
+		tree := newCompositeTree(t, 1000, 10)
+		histogram, err := index.SampleHistogram(tree, 10, 1000)
+		require.NoError(t, err)
+		require.Len(t, histogram.Bounds, 10)
+		for i, bound := range histogram.Bounds {
+			// Each bucket ends with the largest id of a city.
+			values, ok := bound.Val().([]field.Value)
+			require.True(t, ok)
+			assert.Equal(t, fmt.Sprintf("city-%02d", i), values[0].Val())
+			assert.Equal(t, int32(990+i), values[1].Val())
+			assert.Equal(t, 100, histogram.Counts[i])
+		}
+
+		// The key prefix of city-05 cuts the bucket of city-05, which counts for half.
+		varchar := field.NewVarchar()
+		assert.InDelta(t, 0.45, histogram.Selectivity(
+			tree.NewKey(field.NewValue(varchar, "city-05")), nil), 1e-9)
+	})
+
+	t.Run("empty index", func(t *testing.T) {
+		histogram, err := index.SampleHistogram(newIndex(t, 0), 8, 400)
+		require.NoError(t, err)
+		assert.Empty(t, histogram.Bounds)
+		assert.Zero(t, histogram.Selectivity(nil, nil))
+	})
+}
@@ -0,0 +1,205 @@
+package memory
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+type arcQueue int
+
+const (
+	// recentQueue holds the buffer pages accessed once since they were read in, T1 of the paper.
+	recentQueue arcQueue = iota
+	// frequentQueue holds the buffer pages accessed more than once since they were read in, T2 of the paper.
+	frequentQueue
+	// recentGhostQueue holds the page numbers recently evicted from recentQueue, B1 of the paper.
+	recentGhostQueue
+	// frequentGhostQueue holds the page numbers recently evicted from frequentQueue, B2 of the paper.
+	frequentGhostQueue
+	arcQueueCount
+)
+
+// ARCReplacer implements the ARC (Adaptive Replacement Cache) replacement policy.
+//
+// The buffer pages accessed once are kept in a recency LRU list,
+// and the buffer pages accessed again are moved to a frequency LRU list.
+// The page numbers evicted from each list are remembered in a ghost list,
+// and accessing a ghost page grows the target size of the list it was evicted from.
+// The replacer thereby adapts between recency and frequency to the workload,
+// a scan only goes through the recency list without flushing the frequently accessed pages.
+//
+// See also: https://www.usenix.org/conference/fast-03/arc-self-tuning-low-overhead-replacement-cache
+type ARCReplacer struct {
+	mu sync.Mutex
+	// capacity is the number of buffer pages, the ghost lists remember as many page numbers.
+	capacity int
+	// target is the adaptive target size of recentQueue.
+	target int
+	// size is the number of buffer pages can be evicted.
+	size    int
+	queues  [arcQueueCount]*list.List
+	entries map[table.PageNumber]*list.Element
+}
+
+type arcEntry struct {
+	pageNumber table.PageNumber
+	queue      arcQueue
+	evictable  bool
+}
+
+func NewARCReplacer(capacity int) *ARCReplacer {
+	r := &ARCReplacer{
+		capacity: max(capacity, 1),
+		entries:  make(map[table.PageNumber]*list.Element),
+	}
+	for i := range r.queues {
+		r.queues[i] = list.New()
+	}
+	return r
+}
+
+func (r *ARCReplacer) Evict() (table.PageNumber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size == 0 {
+		return table.InvalidPageNumber, ErrNoPageToEvict
+	}
+
+	// Evict from recentQueue while it exceeds its target, and from frequentQueue otherwise.
+	preferred, other := frequentQueue, recentQueue
+	if r.queues[recentQueue].Len() > r.target {
+		preferred, other = recentQueue, frequentQueue
+	}
+	for _, queue := range []arcQueue{preferred, other} {
+		for e := r.queues[queue].Back(); e != nil; e = e.Prev() {
+			if entry := r.entryOf(e); entry.evictable {
+				return entry.pageNumber, nil
+			}
+		}
+	}
+
+	return table.InvalidPageNumber, ErrNoPageToEvict
+}
+
+func (r *ARCReplacer) Access(pageNumber table.PageNumber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok {
+		r.makeRoom()
+		r.entries[pageNumber] = r.queues[recentQueue].PushFront(&arcEntry{pageNumber: pageNumber})
+		return
+	}
+
+	entry := r.entryOf(e)
+	// A ghost hit means the list the page was evicted from was too small.
+	if entry.queue == recentGhostQueue {
+		r.target = min(r.target+max(r.lenOf(frequentGhostQueue)/r.lenOf(recentGhostQueue), 1), r.capacity)
+	} else if entry.queue == frequentGhostQueue {
+		r.target = max(r.target-max(r.lenOf(recentGhostQueue)/r.lenOf(frequentGhostQueue), 1), 0)
+	}
+	r.moveTo(e, frequentQueue)
+}
+
+func (r *ARCReplacer) SetEvictable(pageNumber table.PageNumber, setEvictable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok || r.isGhost(r.entryOf(e)) {
+		return
+	}
+
+	entry := r.entryOf(e)
+	if !entry.evictable && setEvictable {
+		r.size++
+	}
+	if entry.evictable && !setEvictable {
+		r.size--
+	}
+	entry.evictable = setEvictable
+}
+
+// Remove the buffer page, its page number is remembered in the ghost list of its list.
+func (r *ARCReplacer) Remove(pageNumber table.PageNumber) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok || r.isGhost(r.entryOf(e)) {
+		return nil
+	}
+	entry := r.entryOf(e)
+	if !entry.evictable {
+		return errors.New("page is not evictable")
+	}
+
+	entry.evictable = false
+	r.size--
+	if entry.queue == recentQueue {
+		r.moveTo(e, recentGhostQueue)
+	} else {
+		r.moveTo(e, frequentGhostQueue)
+	}
+	return nil
+}
+
+// Resize sets the number of buffer pages, the target size and the ghost lists are trimmed to fit.
+func (r *ARCReplacer) Resize(capacity int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.capacity = max(capacity, 1)
+	r.target = min(r.target, r.capacity)
+	for r.lenOf(recentQueue)+r.lenOf(recentGhostQueue) > r.capacity && r.lenOf(recentGhostQueue) > 0 {
+		r.forget(recentGhostQueue)
+	}
+	for r.lenOf(recentQueue)+r.lenOf(recentGhostQueue)+r.lenOf(frequentQueue)+r.lenOf(frequentGhostQueue) >
+		2*r.capacity && r.lenOf(frequentGhostQueue) > 0 {
+		r.forget(frequentGhostQueue)
+	}
+}
+
+// makeRoom forgets the least recent ghost page numbers so that a new page fits in the lists.
+func (r *ARCReplacer) makeRoom() {
+	recent := r.lenOf(recentQueue) + r.lenOf(recentGhostQueue)
+	total := recent + r.lenOf(frequentQueue) + r.lenOf(frequentGhostQueue)
+	switch {
+	case recent >= r.capacity && r.lenOf(recentGhostQueue) > 0:
+		r.forget(recentGhostQueue)
+	case total >= 2*r.capacity && r.lenOf(frequentGhostQueue) > 0:
+		r.forget(frequentGhostQueue)
+	}
+}
+
+// forget drops the least recent page number of the ghost list.
+func (r *ARCReplacer) forget(queue arcQueue) {
+	e := r.queues[queue].Back()
+	r.queues[queue].Remove(e)
+	delete(r.entries, r.entryOf(e).pageNumber)
+}
+
+// moveTo moves the page to the most recent end of the list.
+func (r *ARCReplacer) moveTo(e *list.Element, queue arcQueue) {
+	entry := r.entryOf(e)
+	r.queues[entry.queue].Remove(e)
+	entry.queue = queue
+	r.entries[entry.pageNumber] = r.queues[queue].PushFront(entry)
+}
+
+func (r *ARCReplacer) lenOf(queue arcQueue) int {
+	return r.queues[queue].Len()
+}
+
+func (r *ARCReplacer) isGhost(entry *arcEntry) bool {
+	return entry.queue == recentGhostQueue || entry.queue == frequentGhostQueue
+}
+
+func (r *ARCReplacer) entryOf(e *list.Element) *arcEntry {
+	return e.Value.(*arcEntry) //nolint:errcheck,forcetypeassert // The lists only hold ARC entries.
+}
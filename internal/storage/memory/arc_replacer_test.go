@@ -0,0 +1,83 @@
+package memory_test
+
+import (
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("ARCReplacer", func() {
+	var replacer *memory.ARCReplacer
+
+	// access accesses the pages and makes them evictable.
+	access := func(pageNumbers ...table.PageNumber) {
+		for _, pageNumber := range pageNumbers {
+			replacer.Access(pageNumber)
+			replacer.SetEvictable(pageNumber, true)
+		}
+	}
+
+	evict := func() table.PageNumber {
+		pageNumber, err := replacer.Evict()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replacer.Remove(pageNumber)).To(Succeed())
+		return pageNumber
+	}
+
+	BeforeEach(func() {
+		replacer = memory.NewARCReplacer(2)
+	})
+
+	It("should keep the pages accessed again over the pages accessed once", func() {
+		access(1, 1)
+		for pageNumber := table.PageNumber(10); pageNumber < 20; pageNumber++ {
+			access(pageNumber)
+			Expect(evict()).To(Equal(pageNumber))
+		}
+	})
+
+	It("should grow the recency list on a ghost hit", func() {
+		replacer = memory.NewARCReplacer(3)
+		access(1, 1, 2, 3)
+		Expect(evict()).To(Equal(table.PageNumber(2)))
+		access(4)
+
+		// The page 2 was evicted too early, so the recency list is given room for a page,
+		// and the frequency list gives up the page 1 instead of the recency list the page 4.
+		access(2)
+		Expect(evict()).To(Equal(table.PageNumber(3)))
+		Expect(evict()).To(Equal(table.PageNumber(1)))
+	})
+
+	It("should forget the ghosts not fitting once resized", func() {
+		replacer = memory.NewARCReplacer(3)
+		access(1, 1, 2, 3)
+		Expect(evict()).To(Equal(table.PageNumber(2)))
+
+		// The page 2 is forgotten while the replacer is shrunk, so it is no ghost hit once grown back.
+		replacer.Resize(1)
+		replacer.Resize(3)
+		access(4, 2)
+		Expect(evict()).To(Equal(table.PageNumber(3)))
+		Expect(evict()).To(Equal(table.PageNumber(4)))
+	})
+
+	It("should skip the page which not evictable", func() {
+		access(1, 2)
+		replacer.SetEvictable(1, false)
+
+		Expect(evict()).To(Equal(table.PageNumber(2)))
+		Expect(replacer.Remove(1)).To(HaveOccurred())
+	})
+
+	It("should raise error if no pages to evict", func() {
+		access(1)
+		replacer.SetEvictable(1, false)
+
+		pageNumber, err := replacer.Evict()
+		Expect(err).To(MatchError(memory.ErrNoPageToEvict))
+		Expect(pageNumber).To(Equal(table.InvalidPageNumber))
+	})
+})
@@ -0,0 +1,78 @@
+package memory_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// slowDiskManager waits for the latency of a disk before each read,
+// and is not closed with the buffer pool so that its pages are shared by the runs.
+type slowDiskManager struct {
+	disk.Manager
+	latency time.Duration
+}
+
+func (m *slowDiskManager) ReadPage(pageNumber table.PageNumber, buf []byte) error {
+	time.Sleep(m.latency)
+	return m.Manager.ReadPage(pageNumber, buf)
+}
+
+func (m *slowDiskManager) Close() error {
+	return nil
+}
+
+// BenchmarkFetchPage fetches random pages in parallel from a buffer pool holding a quarter of them,
+// with one or several instances, and reads taking no time or the latency of an SSD.
+//
+// Run it with -cpu 1,2,4,8 to see the fetches scale with GOMAXPROCS.
+func BenchmarkFetchPage(b *testing.B) {
+	const pages = 4096
+	const poolSize = pages / 4
+
+	schema := table.NewSchema().WithField("id", field.NewInteger())
+	for _, latency := range []time.Duration{0, 20 * time.Microsecond} {
+		diskManager := &slowDiskManager{Manager: disk.NewMemoryDiskManager(), latency: latency}
+		pageNumbers := make([]table.PageNumber, pages)
+		for i := range pageNumbers {
+			p := table.NewDataPage(true)
+			p.Append(table.NewRecordFromLiteral(i))
+			if err := diskManager.WritePage(p.PageNumber(), p.Buffer()); err != nil {
+				b.Fatal(err)
+			}
+			pageNumbers[i] = p.PageNumber()
+		}
+
+		for _, instances := range []int{1, 8} {
+			b.Run(fmt.Sprintf("latency=%v/instances=%d", latency, instances), func(b *testing.B) {
+				bufferPool, err := memory.NewShardedBufferPool(instances, poolSize, diskManager, memory.LRUKPolicy)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						pageNumber := pageNumbers[rand.IntN(pages)]
+						if _, err := bufferPool.FetchPage(pageNumber, schema); err != nil {
+							b.Error(err)
+							return
+						}
+						bufferPool.Unpin(pageNumber, false)
+					}
+				})
+				b.StopTimer()
+
+				if err = bufferPool.Close(); err != nil {
+					b.Fatal(err)
+				}
+			})
+		}
+	}
+}
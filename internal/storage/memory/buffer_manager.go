@@ -18,8 +18,34 @@ type BufferManager interface {
 	// ApplyNewPage reads a page from disk and applies it to memory.
 	ApplyNewPage(spaceID table.SpaceID, p table.Page) error
 	// FetchPage fetches the specified page.
-	FetchPage(pageNumber table.PageNumber, schema *table.Schema) (table.Page, error)
+	FetchPage(pageNumber table.PageNumber, schema *table.Schema, opts ...FetchOption) (table.Page, error)
+	// FetchPageRead fetches the specified page and latches it to be read until the guard is dropped.
+	FetchPageRead(pageNumber table.PageNumber, schema *table.Schema, opts ...FetchOption) (*ReadPageGuard, error)
+	// FetchPageWrite fetches the specified page and latches it to be written until the guard is dropped.
+	FetchPageWrite(pageNumber table.PageNumber, schema *table.Schema, opts ...FetchOption) (*WritePageGuard, error)
 	// Unpin the specified page.
 	Unpin(pageNumber table.PageNumber, markDirty bool)
+	// DeletePage removes the specified page from memory and frees it on disk,
+	// it fails if the page is pinned.
+	DeletePage(pageNumber table.PageNumber) error
+	// FlushPage writes the specified page to disk if it is dirty.
+	FlushPage(pageNumber table.PageNumber) error
+	// FlushAll writes every dirty page to disk and syncs it.
+	FlushAll() error
 	io.Closer
 }
+
+// FetchOption is a hint about how a fetched page is going to be used.
+type FetchOption func(*fetchOptions)
+
+type fetchOptions struct {
+	useOnce bool
+}
+
+// WithUseOnce hints that the page is not going to be fetched again soon, such as by a scan,
+// so the replacer evicts it early instead of pushing out the pages fetched often.
+func WithUseOnce() FetchOption {
+	return func(o *fetchOptions) {
+		o.useOnce = true
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 var _ = Describe("Buffer manager", Ordered, func() {
-	poolSize := uint16(5)
+	poolSize := 5
 	tableSpaceID := table.SpaceID(1)
 	var diskManager disk.Manager
 	var replacer memory.Replacer
@@ -45,7 +45,7 @@ var _ = Describe("Buffer manager", Ordered, func() {
 
 			When("pool is not full", func() {
 				It("should apply pages successfully", func() {
-					for i := uint16(0); i < poolSize; i++ {
+					for i := 0; i < poolSize; i++ {
 						p := table.NewDataPage(true)
 						err := bufferManager.ApplyNewPage(tableSpaceID, p)
 						Expect(err).To(BeNil())
@@ -55,7 +55,7 @@ var _ = Describe("Buffer manager", Ordered, func() {
 
 			When("pool is full", func() {
 				It("should raise an error", func() {
-					for i := uint16(0); i < poolSize; i++ {
+					for i := 0; i < poolSize; i++ {
 						p := table.NewDataPage(true)
 						_ = bufferManager.ApplyNewPage(tableSpaceID, p)
 					}
@@ -71,7 +71,7 @@ var _ = Describe("Buffer manager", Ordered, func() {
 				It("should can apply new page", func() {
 					By("creating pages to fill the pool")
 					pageNumbers := make([]table.PageNumber, poolSize)
-					for i := uint16(0); i < poolSize; i++ {
+					for i := 0; i < poolSize; i++ {
 						p := table.NewDataPage(true)
 						err := bufferManager.ApplyNewPage(tableSpaceID, p)
 						Expect(err).To(BeNil())
@@ -107,7 +107,7 @@ var _ = Describe("Buffer manager", Ordered, func() {
 				It("should get page from disk", func() {
 					By("creating pages to fill the pool")
 					pageNumbers := make([]table.PageNumber, poolSize)
-					for i := uint16(0); i < poolSize; i++ {
+					for i := 0; i < poolSize; i++ {
 						p := table.NewDataPage(true)
 						err := bufferManager.ApplyNewPage(tableSpaceID, p)
 						Expect(err).To(BeNil())
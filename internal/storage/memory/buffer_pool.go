@@ -2,6 +2,7 @@ package memory
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/Huangkai1008/libradb/internal/config"
@@ -12,56 +13,236 @@ import (
 
 var (
 	ErrBufferPoolIsFull = errors.New("buffer pool is full")
+	// ErrInvalidPoolSize is returned when sizing the buffer pool with less than a frame.
+	ErrInvalidPoolSize = errors.New("invalid buffer pool size")
+	// ErrBufferPoolClosed is returned when using a closed buffer pool.
+	ErrBufferPoolClosed = errors.New("buffer pool is closed")
+	// ErrPageIsPinned is returned when deleting a page still in use.
+	ErrPageIsPinned = errors.New("page is pinned")
+)
+
+// frameState tells whether the buffer page of a frame can be used or is being read or written.
+type frameState int
+
+const (
+	// frameReady is a frame whose buffer page can be used.
+	frameReady frameState = iota
+	// frameReading is a frame whose buffer page is being read from disk.
+	frameReading
+	// frameEvicting is a frame whose buffer page is being written to disk to be evicted.
+	frameEvicting
 )
 
 type controlBlock struct {
 	// bufferPage holds the pointer to the buffer page.
 	bufferPage table.Page
+	// state tells whether the buffer page is being read or evicted,
+	// the fetches of the page wait until it is ready.
+	state frameState
+	// writing is true while the buffer page is being written to disk, the other writes wait for it.
+	writing bool
+	// dirty is true if the buffer page was modified since it was last written to disk.
+	dirty bool
+	// latch is held by the page guards, shared to read the buffer page and exclusively to write it.
+	latch sync.RWMutex
+	// prefetched is true if the buffer page was read ahead and not fetched since.
+	prefetched bool
+}
+
+// readAheadThreshold is the number of fetches in a row following the next page links
+// before the pages further along the links are read ahead.
+const readAheadThreshold = 2
+
+// linkedPage is a page linked to the next one, such as a leaf of a B+ tree.
+type linkedPage interface {
+	NextPageNumber() table.PageNumber
+}
+
+// ReadAheadStats tells whether reading pages ahead of a sequential access helps.
+type ReadAheadStats struct {
+	// Prefetched is the number of pages read ahead.
+	Prefetched int
+	// Hits is the number of fetches finding a page read ahead in the buffer pool.
+	Hits int
+	// Misses is the number of fetches following a next page link which read the page from disk,
+	// because the read-ahead is disabled, fell behind or had no free frame.
+	Misses int
+}
+
+// maxSequentialRuns is the number of sequential runs a sequentialTracker follows at once.
+const maxSequentialRuns = 64
+
+// sequentialRun is a run of fetches in a row following the next page links.
+type sequentialRun struct {
+	// length is the number of fetches in the run following a link.
+	length int
+	// tick orders the runs by their last fetch, the least recent one is dropped first.
+	tick uint64
+}
+
+// sequentialTracker counts the fetches in a row following the next page links, for each chain of links apart,
+// so that a fetch of other pages does not break a scan going on.
+//
+// The instances of a sharded buffer pool share it,
+// so that a scan going on in the pages of another instance is still sequential.
+type sequentialTracker struct {
+	mu sync.Mutex
+	// runs maps the next page number of the last fetched page of each run to the run.
+	runs map[table.PageNumber]sequentialRun
+	tick uint64
+}
+
+func newSequentialTracker() *sequentialTracker {
+	return &sequentialTracker{runs: make(map[table.PageNumber]sequentialRun)}
+}
+
+// fetch counts a fetch of the page and returns the number of fetches in a row following the links up to it.
+func (t *sequentialTracker) fetch(pageNumber table.PageNumber) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	run, ok := t.runs[pageNumber]
+	if !ok {
+		return 0
+	}
+	delete(t.runs, pageNumber)
+	return run.length + 1
+}
+
+// follow remembers the next page link of the fetched page, the end of a run of sequential fetches up to it.
+// The least recently fetched run is dropped beyond maxSequentialRuns.
+func (t *sequentialTracker) follow(next table.PageNumber, sequential int) {
+	if next == table.InvalidPageNumber {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A fetch of a page in the middle of a run does not break it.
+	if run, ok := t.runs[next]; ok && run.length > sequential {
+		sequential = run.length
+	}
+	t.tick++
+	t.runs[next] = sequentialRun{length: sequential, tick: t.tick}
+	if len(t.runs) <= maxSequentialRuns {
+		return
+	}
+	var oldest table.PageNumber
+	for pageNumber, run := range t.runs {
+		if oldest == table.InvalidPageNumber || run.tick < t.runs[oldest].tick {
+			oldest = pageNumber
+		}
+	}
+	delete(t.runs, oldest)
+}
+
+type readAheadRequest struct {
+	pageNumber table.PageNumber
+	schema     *table.Schema
+}
+
+type BufferPoolOption func(*BufferPool)
+
+// WithDumpAtShutdown dumps the pages resident in the buffer pool to the file when it is closed,
+// so that a warmup can load them back after a restart.
+func WithDumpAtShutdown(path string) BufferPoolOption {
+	return func(m *BufferPool) {
+		m.dumpPath = path
+	}
 }
 
+// WithReadAhead sets the number of pages read ahead along the next page links of a sequential access,
+// the read-ahead is disabled by default.
+func WithReadAhead(depth int) BufferPoolOption {
+	return func(m *BufferPool) {
+		m.readAheadDepth = max(depth, 0)
+	}
+}
+
+// BufferPool is a buffer pool whose disk I/O is done outside its lock.
+//
+// A frame being read or written is marked with its I/O state, the operations needing the page wait for the I/O
+// on ioDone, and the operations on the other pages go on meanwhile.
 type BufferPool struct {
-	mu          sync.RWMutex
+	mu sync.RWMutex
+	// ioDone is signaled on mu when an I/O on a frame is done.
+	ioDone *sync.Cond
+	// unpinned is signaled on mu when a page becomes evictable or a frame is freed,
+	// a shrinking waits on it for the pinned pages.
+	unpinned *sync.Cond
+	// resizeMu serializes the resizes.
+	resizeMu sync.Mutex
+	// inFlight is the number of disk I/O in progress.
+	inFlight    int
 	diskManager disk.Manager
-	// poolSize is the size of the buffer pool.
-	poolSize uint16
+	// poolSize is the number of frames of the buffer pool.
+	poolSize int
 
 	// freeLinkedList is a linked list of free control blocks.
 	freeLinkedList ds.LinkedList[*controlBlock]
-	// flushLinkedList is a chan of control blocks that need to be flushed.
-	flushCh chan *controlBlock
+	// flushCh is a chan of the dirty pages to be written in the background.
+	flushCh chan table.PageNumber
+	// flushDone is closed once the background writes are drained after flushCh is closed.
+	flushDone chan struct{}
+	closed    bool
 	// pageTable is a map of page number to control block.
 	pageTable map[table.PageNumber]*controlBlock
 	// pinCounter hold the pin/reference count of every page.
 	pinCounter map[table.PageNumber]int
-	// spaceTable is the map to hold pageNumber to table space ID.
-	spaceTable map[table.PageNumber]table.SpaceID
+	// diskReads is the number of pages read from disk by the fetches, which a warmup backs off from.
+	diskReads int
+	// dumpPath is the file the resident pages are dumped to when the buffer pool is closed.
+	dumpPath string
 	// replacer is the page eviction policy.
 	replacer Replacer
+
+	// readAheadDepth is the number of pages read ahead along the next page links, 0 disables the read-ahead.
+	readAheadDepth int
+	tracker        *sequentialTracker
+	// ownerOf returns the instance of a sharded buffer pool holding the page, the pages are read ahead into it.
+	// It is nil if the buffer pool is not sharded.
+	ownerOf func(table.PageNumber) *BufferPool
+	// readAheadCh is a chan of the pages to be read ahead in the background.
+	readAheadCh chan readAheadRequest
+	// readAheadDone is closed once the background read-ahead is drained after readAheadCh is closed.
+	readAheadDone  chan struct{}
+	readAheadStats ReadAheadStats
 }
 
 func NewBufferPool(
-	poolSize uint16,
+	poolSize int,
 	diskManager disk.Manager,
 	replacer Replacer,
+	opts ...BufferPoolOption,
 ) *BufferPool {
 	m := &BufferPool{
 		diskManager:    diskManager,
 		poolSize:       poolSize,
 		freeLinkedList: ds.NewDLL[*controlBlock](),
-		flushCh:        make(chan *controlBlock, poolSize),
+		flushCh:        make(chan table.PageNumber, poolSize),
+		flushDone:      make(chan struct{}),
 		replacer:       replacer,
 		pageTable:      make(map[table.PageNumber]*controlBlock),
-		spaceTable:     make(map[table.PageNumber]table.SpaceID),
 		pinCounter:     make(map[table.PageNumber]int),
+		tracker:        newSequentialTracker(),
+		readAheadCh:    make(chan readAheadRequest, 1),
+		readAheadDone:  make(chan struct{}),
+	}
+	m.ioDone = sync.NewCond(&m.mu)
+	m.unpinned = sync.NewCond(&m.mu)
+	for _, opt := range opts {
+		opt(m)
 	}
 
-	for i := uint16(0); i < poolSize; i++ {
+	for i := 0; i < poolSize; i++ {
 		m.freeLinkedList.Append(&controlBlock{
 			bufferPage: nil,
 		})
 	}
 
 	go m.flushPages()
+	go m.readAheadPages()
 	return m
 }
 
@@ -70,86 +251,384 @@ func (m *BufferPool) ApplyNewPage(spaceID table.SpaceID, p table.Page) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	var cb *controlBlock
+	if m.closed {
+		return ErrBufferPoolClosed
+	}
 	pageNumber := p.PageNumber()
-	m.spaceTable[pageNumber] = spaceID
-
-	// Always find page space from the free linked list first.
-	if m.isFree() {
-		cb = m.freeLinkedList.Remove(0)
-		cb.bufferPage = p
-	} else {
-		if err := m.evictPage(); err != nil {
-			return err
-		}
-		cb = &controlBlock{bufferPage: p}
+	cb, err := m.allocateFrame()
+	if err != nil {
+		return err
 	}
+	p.SetSpaceID(spaceID)
+	cb.bufferPage = p
+	// The page is new, so it is not on disk yet.
+	cb.dirty = true
 	m.pageTable[pageNumber] = cb
 	m.pin(pageNumber)
 	return nil
 }
 
-func (m *BufferPool) FetchPage(pageNumber table.PageNumber, s *table.Schema) (table.Page, error) {
+func (m *BufferPool) FetchPage(pageNumber table.PageNumber, s *table.Schema, opts ...FetchOption) (table.Page, error) {
+	cb, err := m.fetchPage(pageNumber, s, opts)
+	if err != nil {
+		return nil, err
+	}
+	return cb.bufferPage, nil
+}
+
+// FetchPageRead fetches the specified page and latches it shared,
+// the returned guard must be dropped once the page is read.
+func (m *BufferPool) FetchPageRead(
+	pageNumber table.PageNumber,
+	s *table.Schema,
+	opts ...FetchOption,
+) (*ReadPageGuard, error) {
+	cb, err := m.fetchPage(pageNumber, s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pinned page is not evicted while waiting for the latch.
+	cb.latch.RLock()
+	return &ReadPageGuard{pool: m, cb: cb, page: cb.bufferPage}, nil
+}
+
+// FetchPageWrite fetches the specified page and latches it exclusively,
+// the returned guard must be dropped once the page is written.
+func (m *BufferPool) FetchPageWrite(
+	pageNumber table.PageNumber,
+	s *table.Schema,
+	opts ...FetchOption,
+) (*WritePageGuard, error) {
+	cb, err := m.fetchPage(pageNumber, s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cb.latch.Lock()
+	return &WritePageGuard{pool: m, cb: cb, page: cb.bufferPage}, nil
+}
+
+// fetchPage pins the page, reading it from disk if it is not in the buffer pool, and returns its control block.
+//
+// The page is read without holding the lock,
+// the other fetches of the page meanwhile wait for it to be read instead of reading it again.
+func (m *BufferPool) fetchPage(
+	pageNumber table.PageNumber,
+	s *table.Schema,
+	opts []FetchOption,
+) (*controlBlock, error) {
+	options := &fetchOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// If the page is already in the buffer pool, return it.
-	if cb, ok := m.pageTable[pageNumber]; ok {
-		bufferPage := cb.bufferPage
-		m.pin(pageNumber)
-		return bufferPage, nil
+	if m.closed {
+		return nil, ErrBufferPoolClosed
 	}
+	sequential := m.tracker.fetch(pageNumber)
 
 	var cb *controlBlock
-	// Always find page space from the free linked list first.
-	if m.isFree() {
-		cb = m.freeLinkedList.Remove(0)
-	} else {
-		if err := m.evictPage(); err != nil {
+	for cb == nil {
+		// The lock is released while waiting for an I/O or evicting a page, meanwhile the buffer pool may be closed.
+		if m.closed {
+			return nil, ErrBufferPoolClosed
+		}
+		// If the page is already in the buffer pool, return it once it is ready.
+		if resident, ok := m.pageTable[pageNumber]; ok {
+			if resident.state != frameReady {
+				m.ioDone.Wait()
+				continue
+			}
+			if resident.prefetched {
+				resident.prefetched = false
+				m.readAheadStats.Hits++
+			}
+			m.pinWith(pageNumber, options)
+			m.trackSequential(resident, s, sequential)
+			return resident, nil
+		}
+
+		free, err := m.allocateFrame()
+		if err != nil {
 			return nil, err
 		}
-		cb = &controlBlock{}
+		// The page may have been read, or the buffer pool closed, while a page was evicted to make room.
+		if _, ok := m.pageTable[pageNumber]; ok || m.closed {
+			m.freeFrame(free)
+			continue
+		}
+		cb = free
+	}
+	if sequential > 0 {
+		m.readAheadStats.Misses++
 	}
+	m.diskReads++
 
 	// If the page does not exist in the buffer pool, fetch it from the disk.
+	cb.state = frameReading
+	m.pageTable[pageNumber] = cb
+	m.pinWith(pageNumber, options)
+	p, err := m.readPage(pageNumber, s)
+	cb.state = frameReady
+	m.ioDone.Broadcast()
+	if err == nil && m.closed {
+		// The buffer pool was closed while reading, so the page is not cached in it.
+		err = ErrBufferPoolClosed
+	}
+	if err != nil {
+		m.pinCounter[pageNumber]--
+		m.discard(pageNumber, cb)
+		return nil, err
+	}
+
+	// Cache the page so that the next fetches do not read it again.
+	cb.bufferPage = p
+	cb.dirty = false
+	m.trackSequential(cb, s, sequential)
+	return cb, nil
+}
+
+// readPage reads the page from disk without holding the lock, which is held again once it returns.
+func (m *BufferPool) readPage(pageNumber table.PageNumber, s *table.Schema) (table.Page, error) {
+	m.inFlight++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+	}()
+
 	pageContent := make([]byte, config.PageSize)
 	if err := m.diskManager.ReadPage(pageNumber, pageContent); err != nil {
 		return nil, err
 	}
+	return table.FromBytes(pageContent, s), nil
+}
 
-	p := table.FromBytes(pageContent, s)
-	cb.bufferPage = p
-	m.pin(pageNumber)
-	return p, nil
+// writePage writes the buffer page of the frame to disk without holding the lock, which is held again once it returns.
+//
+// The page is serialized holding its latch shared, so that a page guard does not modify it meanwhile.
+// The latch is taken without holding the lock, since a page guard may fetch other pages while latching the page.
+func (m *BufferPool) writePage(pageNumber table.PageNumber, cb *controlBlock) error {
+	p := cb.bufferPage
+	m.inFlight++
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+	}()
+
+	cb.latch.RLock()
+	pageContent := p.Buffer()
+	cb.latch.RUnlock()
+	return m.diskManager.WritePage(pageNumber, pageContent)
+}
+
+// discard drops the unpinned page from the buffer pool without writing it, and frees its frame.
+func (m *BufferPool) discard(pageNumber table.PageNumber, cb *controlBlock) {
+	m.replacer.SetEvictable(pageNumber, true)
+	// The page is evictable, so it can be removed.
+	_ = m.replacer.Remove(pageNumber)
+	delete(m.pageTable, pageNumber)
+	delete(m.pinCounter, pageNumber)
+	cb.bufferPage = nil
+	cb.dirty = false
+	cb.prefetched = false
+	m.freeFrame(cb)
+}
+
+// freeFrame puts the frame back in the free list, and wakes up a shrinking waiting for a frame.
+func (m *BufferPool) freeFrame(cb *controlBlock) {
+	m.freeLinkedList.Append(cb)
+	m.unpinned.Broadcast()
 }
 
 func (m *BufferPool) pin(pageNumber table.PageNumber) {
+	m.pinWith(pageNumber, &fetchOptions{})
+}
+
+// pinWith pins the page, telling the replacer about the hints it knows.
+func (m *BufferPool) pinWith(pageNumber table.PageNumber, options *fetchOptions) {
 	m.pinCounter[pageNumber]++
-	m.replacer.Access(pageNumber)
+	if accessor, ok := m.replacer.(OnceAccessor); ok && options.useOnce {
+		accessor.AccessOnce(pageNumber)
+	} else {
+		m.replacer.Access(pageNumber)
+	}
 	m.replacer.SetEvictable(pageNumber, false)
 }
 
+// Unpin the page, it does nothing once the buffer pool is closed.
 func (m *BufferPool) Unpin(pageNumber table.PageNumber, markDirty bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if !m.isPinned(pageNumber) {
+	if m.closed || !m.isPinned(pageNumber) {
 		return
 	}
 
 	m.pinCounter[pageNumber]--
 	if m.pinCounter[pageNumber] == 0 {
 		m.replacer.SetEvictable(pageNumber, true)
+		m.unpinned.Broadcast()
 	}
 
 	if markDirty {
-		m.flushCh <- m.pageTable[pageNumber]
+		m.pageTable[pageNumber].dirty = true
+		// The page is written on eviction anyway if the background writes fall behind.
+		select {
+		case m.flushCh <- pageNumber:
+		default:
+		}
+	}
+}
+
+func (m *BufferPool) DeletePage(pageNumber table.PageNumber) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrBufferPoolClosed
+	}
+
+	cb, ok := m.waitForIO(pageNumber)
+	if m.isPinned(pageNumber) {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrPageIsPinned, pageNumber)
+	}
+	if ok {
+		// The page is gone, so it is not written even if it is dirty.
+		m.discard(pageNumber, cb)
+	}
+	m.mu.Unlock()
+
+	return m.diskManager.DeallocatePage(pageNumber)
+}
+
+func (m *BufferPool) FlushPage(pageNumber table.PageNumber) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrBufferPoolClosed
+	}
+	return m.flushPage(pageNumber)
+}
+
+func (m *BufferPool) FlushAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrBufferPoolClosed
+	}
+	return m.flushAll()
+}
+
+// ReadAheadStats returns the counters of the read-ahead.
+func (m *BufferPool) ReadAheadStats() ReadAheadStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.readAheadStats
+}
+
+// PoolSize returns the number of frames of the buffer pool.
+func (m *BufferPool) PoolSize() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.poolSize
+}
+
+// Resize grows or shrinks the buffer pool to poolSize frames while it is in use.
+//
+// Growing adds free frames. Shrinking drops the free frames first, then evicts the unpinned pages,
+// and waits for the pinned pages to be unpinned to evict them.
+// The lock is released while a page is written or a pinned page is waited for,
+// so the fetches go on meanwhile.
+func (m *BufferPool) Resize(poolSize int) error {
+	if poolSize < 1 {
+		return fmt.Errorf("%w: %d", ErrInvalidPoolSize, poolSize)
+	}
+
+	m.resizeMu.Lock()
+	defer m.resizeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for m.poolSize < poolSize {
+		if m.closed {
+			return ErrBufferPoolClosed
+		}
+		m.freeLinkedList.Append(&controlBlock{
+			bufferPage: nil,
+		})
+		m.poolSize++
+	}
+	for m.poolSize > poolSize {
+		if m.closed {
+			return ErrBufferPoolClosed
+		}
+		if m.isFree() {
+			m.freeLinkedList.Remove(0)
+			m.poolSize--
+			continue
+		}
+
+		// The frame of the evicted page is dropped instead of being freed.
+		_, err := m.evictPage()
+		if errors.Is(err, ErrBufferPoolIsFull) {
+			m.unpinned.Wait()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		m.poolSize--
+	}
+
+	if resizable, ok := m.replacer.(ResizableReplacer); ok {
+		resizable.Resize(poolSize)
 	}
+	return nil
 }
 
+// Close drains the background writes, writes every dirty page, syncs and closes the disk manager,
+// the resident pages are dumped first if WithDumpAtShutdown is set.
+// Using the buffer pool afterwards returns ErrBufferPoolClosed.
 func (m *BufferPool) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	// The resident pages are listed before the fetches are refused, and dumped without holding the lock.
+	resident := m.residentPages()
+	m.closed = true
 	close(m.flushCh)
-	return nil
+	close(m.readAheadCh)
+	// A shrinking waiting for the pinned pages gives up.
+	m.unpinned.Broadcast()
+	m.mu.Unlock()
+
+	var dumpErr error
+	if m.dumpPath != "" {
+		dumpErr = dumpFile(m.dumpPath, resident)
+	}
+
+	// The background writes and read-ahead take the lock page by page.
+	<-m.flushDone
+	<-m.readAheadDone
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The fetches already reading a page still complete.
+	for m.inFlight > 0 {
+		m.ioDone.Wait()
+	}
+	return errors.Join(dumpErr, m.flushAll(), m.diskManager.Close())
 }
 
 func (m *BufferPool) isPinned(pageNumber table.PageNumber) bool {
@@ -160,39 +639,233 @@ func (m *BufferPool) isFree() bool {
 	return m.freeLinkedList.Size() > 0
 }
 
-func (m *BufferPool) evictPage() error {
+// allocateFrame returns a free control block, evicting a page if there is none.
+// The lock is released while the evicted page is written.
+func (m *BufferPool) allocateFrame() (*controlBlock, error) {
+	// Always find page space from the free linked list first.
+	if m.isFree() {
+		return m.freeLinkedList.Remove(0), nil
+	}
+	return m.evictPage()
+}
+
+// evictPage evicts a page chosen by the replacer, writing it to disk first if it is dirty,
+// and returns its control block.
+//
+// The page is written without holding the lock, the fetches of the page meanwhile wait for it to be evicted.
+func (m *BufferPool) evictPage() (*controlBlock, error) {
 	// Choose page to evict.
 	evictedNumber, err := m.replacer.Evict()
 	if errors.Is(err, ErrNoPageToEvict) {
-		return ErrBufferPoolIsFull
+		return nil, ErrBufferPoolIsFull
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// remove page from replacer and buffer pool
+	// Remove the page from the replacer, so that it is not chosen again while it is written.
 	if err = m.replacer.Remove(evictedNumber); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err = m.flushPage(evictedNumber); err != nil {
-		return err
+	cb := m.pageTable[evictedNumber]
+	cb.state = frameEvicting
+	for cb.writing {
+		m.ioDone.Wait()
+	}
+	if cb.dirty {
+		err = m.writePage(evictedNumber, cb)
+	}
+	cb.state = frameReady
+	m.ioDone.Broadcast()
+	if err != nil {
+		// The page stays in the pool if it cannot be written.
+		m.replacer.Access(evictedNumber)
+		m.replacer.SetEvictable(evictedNumber, true)
+		m.unpinned.Broadcast()
+		return nil, err
 	}
+
 	delete(m.pageTable, evictedNumber)
-	return nil
+	delete(m.pinCounter, evictedNumber)
+	cb.bufferPage = nil
+	cb.dirty = false
+	cb.prefetched = false
+	return cb, nil
+}
+
+// waitForIO waits until the page is neither read, written nor evicted, and returns its control block.
+// It returns false if the page is not in the buffer pool.
+func (m *BufferPool) waitForIO(pageNumber table.PageNumber) (*controlBlock, bool) {
+	for {
+		cb, ok := m.pageTable[pageNumber]
+		if !ok || (cb.state == frameReady && !cb.writing) {
+			return cb, ok
+		}
+		m.ioDone.Wait()
+	}
 }
 
+// flushPage writes the page to disk if it is dirty.
+//
+// The page is written without holding the lock, it can still be fetched meanwhile,
+// and modified once it is serialized.
 func (m *BufferPool) flushPage(pageNumber table.PageNumber) error {
-	cb, ok := m.pageTable[pageNumber]
-	if ok {
-		return m.diskManager.WritePage(pageNumber, cb.bufferPage.Buffer())
+	cb, ok := m.waitForIO(pageNumber)
+	if !ok || !cb.dirty {
+		return nil
+	}
+
+	// The page is dirty again if it is modified while being written.
+	cb.dirty = false
+	cb.writing = true
+	err := m.writePage(pageNumber, cb)
+	cb.writing = false
+	m.ioDone.Broadcast()
+	if err != nil {
+		cb.dirty = true
+		return err
 	}
 	return nil
 }
 
+// flushAll writes every dirty page to disk and syncs it.
+func (m *BufferPool) flushAll() error {
+	// The lock is released while writing, so the pages are collected first.
+	pageNumbers := make([]table.PageNumber, 0, len(m.pageTable))
+	for pageNumber := range m.pageTable {
+		pageNumbers = append(pageNumbers, pageNumber)
+	}
+	for _, pageNumber := range pageNumbers {
+		if err := m.flushPage(pageNumber); err != nil {
+			return err
+		}
+	}
+	return m.diskManager.Sync()
+}
+
+// flushPages writes the dirty pages scheduled by Unpin in the background.
 func (m *BufferPool) flushPages() {
-	for cb := range m.flushCh {
-		p := cb.bufferPage
-		contents := p.Buffer()
-		_ = m.diskManager.WritePage(p.PageNumber(), contents)
+	defer close(m.flushDone)
+	for pageNumber := range m.flushCh {
+		m.mu.Lock()
+		// A page failing to be written stays dirty.
+		_ = m.flushPage(pageNumber)
+		m.mu.Unlock()
+	}
+}
+
+// trackSequential remembers the next page link of the fetched page,
+// and schedules reading the pages along it once sequential fetches in a row followed the links.
+func (m *BufferPool) trackSequential(cb *controlBlock, s *table.Schema, sequential int) {
+	linked, ok := cb.bufferPage.(linkedPage)
+	if !ok {
+		return
+	}
+
+	next := linked.NextPageNumber()
+	m.tracker.follow(next, sequential)
+	if m.readAheadDepth == 0 || sequential < readAheadThreshold || next == table.InvalidPageNumber {
+		return
+	}
+	// readAheadCh is closed along with the buffer pool.
+	if m.closed {
+		return
+	}
+	// A read-ahead already scheduled goes along the same links.
+	select {
+	case m.readAheadCh <- readAheadRequest{pageNumber: next, schema: s}:
+	default:
+	}
+}
+
+// readAheadPages reads the pages scheduled by the sequential fetches in the background.
+func (m *BufferPool) readAheadPages() {
+	defer close(m.readAheadDone)
+	for request := range m.readAheadCh {
+		m.readAhead(request)
+	}
+}
+
+// readAhead reads up to readAheadDepth pages along the next page links from the requested one into the free frames,
+// the pages in the buffer pool are only followed, and no page is evicted to make room.
+// The pages of a sharded buffer pool are read into the free frames of the instances holding them.
+func (m *BufferPool) readAhead(request readAheadRequest) {
+	pageNumber := request.pageNumber
+	for i := 0; i < m.readAheadDepth && pageNumber != table.InvalidPageNumber; i++ {
+		owner := m
+		if m.ownerOf != nil {
+			owner = m.ownerOf(pageNumber)
+		}
+		// The lock is taken page by page so that the fetches are not held up for the whole read-ahead.
+		owner.mu.Lock()
+		next, ok := owner.prefetchPage(pageNumber, request.schema)
+		owner.mu.Unlock()
+		if !ok {
+			return
+		}
+		pageNumber = next
+	}
+}
+
+// prefetchPage reads the page into a free frame if it is not in the buffer pool, and returns its next page number.
+// It returns false if the page cannot be read, or the buffer pool is closed or has no free frame.
+func (m *BufferPool) prefetchPage(pageNumber table.PageNumber, s *table.Schema) (table.PageNumber, bool) {
+	cb, loaded, err := m.loadFree(pageNumber, s)
+	if err != nil {
+		return table.InvalidPageNumber, false
+	}
+	if loaded {
+		cb.prefetched = true
+		m.readAheadStats.Prefetched++
+	}
+
+	linked, ok := cb.bufferPage.(linkedPage)
+	if !ok {
+		return table.InvalidPageNumber, false
+	}
+	return linked.NextPageNumber(), true
+}
+
+// loadFree reads the page into a free frame if it is not in the buffer pool, and returns its control block
+// and whether it was read. It returns ErrBufferPoolIsFull if the page needs a frame and there is no free one.
+//
+// The page is not pinned, it is evicted like any other page if it is not fetched in time.
+func (m *BufferPool) loadFree(pageNumber table.PageNumber, s *table.Schema) (*controlBlock, bool, error) {
+	if m.closed {
+		return nil, false, ErrBufferPoolClosed
+	}
+
+	cb, ok := m.waitForIO(pageNumber)
+	if ok {
+		return cb, false, nil
+	}
+	if !m.isFree() {
+		return nil, false, ErrBufferPoolIsFull
+	}
+
+	cb = m.freeLinkedList.Remove(0)
+	cb.state = frameReading
+	m.pageTable[pageNumber] = cb
+	p, err := m.readPage(pageNumber, s)
+	cb.state = frameReady
+	m.ioDone.Broadcast()
+	if err == nil && m.closed {
+		err = ErrBufferPoolClosed
+	}
+	if err != nil {
+		delete(m.pageTable, pageNumber)
+		m.freeFrame(cb)
+		return nil, false, err
+	}
+
+	cb.bufferPage = p
+	cb.dirty = false
+	if accessor, isOnceAccessor := m.replacer.(OnceAccessor); isOnceAccessor {
+		accessor.AccessOnce(pageNumber)
+	} else {
+		m.replacer.Access(pageNumber)
 	}
+	m.replacer.SetEvictable(pageNumber, true)
+	m.unpinned.Broadcast()
+	return cb, true, nil
 }
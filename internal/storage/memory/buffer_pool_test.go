@@ -0,0 +1,577 @@
+package memory_test
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// countingDiskManager counts the pages read from and written to the disk manager it wraps.
+type countingDiskManager struct {
+	disk.Manager
+	mu     sync.Mutex
+	reads  map[table.PageNumber]int
+	writes map[table.PageNumber]int
+	syncs  int
+}
+
+func newCountingDiskManager() *countingDiskManager {
+	return newCountingDiskManagerOf(disk.NewMemoryDiskManager())
+}
+
+func newCountingDiskManagerOf(manager disk.Manager) *countingDiskManager {
+	return &countingDiskManager{
+		Manager: manager,
+		reads:   make(map[table.PageNumber]int),
+		writes:  make(map[table.PageNumber]int),
+	}
+}
+
+func (m *countingDiskManager) ReadPage(pageNumber table.PageNumber, buf []byte) error {
+	m.mu.Lock()
+	m.reads[pageNumber]++
+	m.mu.Unlock()
+	return m.Manager.ReadPage(pageNumber, buf)
+}
+
+func (m *countingDiskManager) WritePage(pageNumber table.PageNumber, buf []byte) error {
+	m.mu.Lock()
+	m.writes[pageNumber]++
+	m.mu.Unlock()
+	return m.Manager.WritePage(pageNumber, buf)
+}
+
+func (m *countingDiskManager) Sync() error {
+	m.mu.Lock()
+	m.syncs++
+	m.mu.Unlock()
+	return m.Manager.Sync()
+}
+
+func (m *countingDiskManager) syncCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.syncs
+}
+
+func (m *countingDiskManager) readsOf(pageNumber table.PageNumber) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reads[pageNumber]
+}
+
+func (m *countingDiskManager) writesOf(pageNumber table.PageNumber) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writes[pageNumber]
+}
+
+// blockingDiskManager blocks the reads of a page until they are released.
+type blockingDiskManager struct {
+	*countingDiskManager
+	blocked table.PageNumber
+	// reading is signaled when a read of the blocked page starts.
+	reading chan struct{}
+	release chan struct{}
+}
+
+func newBlockingDiskManager(blocked table.PageNumber) *blockingDiskManager {
+	return &blockingDiskManager{
+		countingDiskManager: newCountingDiskManager(),
+		blocked:             blocked,
+		reading:             make(chan struct{}, 1),
+		release:             make(chan struct{}),
+	}
+}
+
+func (m *blockingDiskManager) ReadPage(pageNumber table.PageNumber, buf []byte) error {
+	if pageNumber == m.blocked {
+		select {
+		case m.reading <- struct{}{}:
+		default:
+		}
+		<-m.release
+	}
+	return m.countingDiskManager.ReadPage(pageNumber, buf)
+}
+
+var _ = Describe("Buffer pool", func() {
+	const poolSize = 4
+
+	var diskManager *countingDiskManager
+	var bufferPool *memory.BufferPool
+	var schema *table.Schema
+
+	// newPage applies a new page holding the key and unpins it.
+	newPage := func(key int) table.PageNumber {
+		p := table.NewDataPage(true)
+		p.Append(table.NewRecordFromLiteral(key))
+		Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+		bufferPool.Unpin(p.PageNumber(), true)
+		return p.PageNumber()
+	}
+
+	keyOf := func(pageNumber table.PageNumber) any {
+		p, err := bufferPool.FetchPage(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		defer bufferPool.Unpin(pageNumber, false)
+		return p.(*table.DataPage).Get(0).GetKey().Val()
+	}
+
+	BeforeEach(func() {
+		diskManager = newCountingDiskManager()
+		bufferPool = memory.NewBufferPool(poolSize, diskManager, memory.NewLRUKReplacer(2))
+		DeferCleanup(bufferPool.Close)
+		schema = table.NewSchema().WithField("id", field.NewInteger())
+	})
+
+	It("should cache the pages it reads", func() {
+		pageNumbers := make([]table.PageNumber, 2*poolSize)
+		for i := range pageNumbers {
+			pageNumbers[i] = newPage(i)
+		}
+
+		// The first page was evicted, fetching it twice reads it once.
+		Expect(keyOf(pageNumbers[0])).To(Equal(int32(0)))
+		Expect(keyOf(pageNumbers[0])).To(Equal(int32(0)))
+		Expect(diskManager.readsOf(pageNumbers[0])).To(Equal(1))
+	})
+
+	It("should only write dirty pages on eviction", func() {
+		pageNumbers := make([]table.PageNumber, poolSize)
+		for i := range pageNumbers {
+			pageNumbers[i] = newPage(i)
+		}
+		Eventually(func() int {
+			return diskManager.writesOf(pageNumbers[0])
+		}).Should(Equal(1))
+
+		// Reading the pages back and forth evicts them clean, so nothing is written again.
+		for round := 0; round < 3; round++ {
+			for i := range pageNumbers {
+				newPage(poolSize + round*poolSize + i)
+			}
+			for i, pageNumber := range pageNumbers {
+				Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+			}
+		}
+		for _, pageNumber := range pageNumbers {
+			Expect(diskManager.writesOf(pageNumber)).To(Equal(1))
+		}
+	})
+
+	It("should write a dirty page before evicting it", func() {
+		pageNumber := newPage(0)
+		p, err := bufferPool.FetchPage(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		p.(*table.DataPage).Replace(0, table.NewRecordFromLiteral(42))
+		bufferPool.Unpin(pageNumber, true)
+
+		for i := 1; i <= 2*poolSize; i++ {
+			newPage(i)
+		}
+		Expect(keyOf(pageNumber)).To(Equal(int32(42)))
+	})
+
+	It("should not block unpinning many dirty pages", func() {
+		pageNumber := newPage(0)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100*poolSize; i++ {
+				_, err := bufferPool.FetchPage(pageNumber, schema)
+				Expect(err).ToNot(HaveOccurred())
+				bufferPool.Unpin(pageNumber, true)
+			}
+		}()
+		Eventually(done).Should(BeClosed())
+	})
+	DescribeTable("should serve the pages with every replacement policy",
+		func(policy memory.Policy) {
+			replacer, err := memory.NewReplacer(policy, poolSize)
+			Expect(err).ToNot(HaveOccurred())
+			bufferPool = memory.NewBufferPool(poolSize, diskManager, replacer)
+			DeferCleanup(bufferPool.Close)
+
+			pageNumbers := make([]table.PageNumber, 3*poolSize)
+			for i := range pageNumbers {
+				pageNumbers[i] = newPage(i)
+			}
+			for round := 0; round < 2; round++ {
+				for i, pageNumber := range pageNumbers {
+					Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+				}
+			}
+		},
+		Entry("LRU-k", memory.LRUKPolicy),
+		Entry("CLOCK", memory.ClockPolicy),
+		Entry("ARC", memory.ARCPolicy),
+		Entry("midpoint", memory.MidpointPolicy),
+	)
+
+	Describe("deleting", func() {
+		It("should refuse to delete a pinned page", func() {
+			p := table.NewDataPage(true)
+			Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+			Expect(bufferPool.DeletePage(p.PageNumber())).To(MatchError(memory.ErrPageIsPinned))
+
+			bufferPool.Unpin(p.PageNumber(), true)
+			Expect(bufferPool.DeletePage(p.PageNumber())).To(Succeed())
+		})
+
+		It("should free the page in memory and on disk", func() {
+			pageNumbers := make([]table.PageNumber, poolSize)
+			for i := range pageNumbers {
+				pageNumbers[i] = newPage(i)
+			}
+			Expect(bufferPool.FlushAll()).To(Succeed())
+			Expect(bufferPool.DeletePage(pageNumbers[0])).To(Succeed())
+
+			_, err := bufferPool.FetchPage(pageNumbers[0], schema)
+			Expect(err).To(MatchError(disk.ErrPageNotAllocated))
+
+			// The frame of the deleted page is reused without evicting another page.
+			newPage(poolSize)
+			for i, pageNumber := range pageNumbers[1:] {
+				Expect(keyOf(pageNumber)).To(Equal(int32(i + 1)))
+				Expect(diskManager.readsOf(pageNumber)).To(BeZero())
+			}
+		})
+
+		It("should not write a deleted dirty page", func() {
+			p := table.NewDataPage(true)
+			Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+			bufferPool.Unpin(p.PageNumber(), false)
+			Expect(bufferPool.DeletePage(p.PageNumber())).To(Succeed())
+
+			Expect(bufferPool.FlushAll()).To(Succeed())
+			Expect(diskManager.writesOf(p.PageNumber())).To(BeZero())
+		})
+	})
+
+	Describe("flushing", func() {
+		// dirtyPage fetches the page, replaces its key and unpins it dirty.
+		dirtyPage := func(pageNumber table.PageNumber, key int) {
+			p, err := bufferPool.FetchPage(pageNumber, schema)
+			Expect(err).ToNot(HaveOccurred())
+			p.(*table.DataPage).Replace(0, table.NewRecordFromLiteral(key))
+			bufferPool.Unpin(pageNumber, true)
+		}
+
+		It("should only write a dirty page", func() {
+			pageNumber := newPage(0)
+			Eventually(func() int {
+				return diskManager.writesOf(pageNumber)
+			}).Should(Equal(1))
+
+			Expect(bufferPool.FlushPage(pageNumber)).To(Succeed())
+			Expect(diskManager.writesOf(pageNumber)).To(Equal(1))
+		})
+
+		It("should ignore a page not in the buffer pool", func() {
+			Expect(bufferPool.FlushPage(table.PageNumber(1 << 30))).To(Succeed())
+		})
+
+		It("should write every dirty page and sync them", func() {
+			pageNumbers := make([]table.PageNumber, poolSize)
+			for i := range pageNumbers {
+				pageNumbers[i] = newPage(i)
+			}
+			Expect(bufferPool.FlushAll()).To(Succeed())
+			Expect(diskManager.syncCount()).To(Equal(1))
+
+			buf := make([]byte, config.PageSize)
+			for i, pageNumber := range pageNumbers {
+				Expect(diskManager.ReadPage(pageNumber, buf)).To(Succeed())
+				p := table.FromBytes(buf, schema).(*table.DataPage)
+				Expect(p.Get(0).GetKey().Val()).To(Equal(int32(i)))
+			}
+		})
+
+		It("should write the dirty pages when closed", func() {
+			pageNumber := newPage(0)
+			Eventually(func() int {
+				return diskManager.writesOf(pageNumber)
+			}).Should(Equal(1))
+			dirtyPage(pageNumber, 42)
+
+			Expect(bufferPool.Close()).To(Succeed())
+			Expect(diskManager.writesOf(pageNumber)).To(Equal(2))
+			Expect(diskManager.syncCount()).To(Equal(1))
+			Expect(bufferPool.Close()).To(Succeed())
+		})
+
+		It("should refuse to be used when closed", func() {
+			pageNumber := newPage(0)
+			Expect(bufferPool.Close()).To(Succeed())
+
+			_, err := bufferPool.FetchPage(pageNumber, schema)
+			Expect(err).To(MatchError(memory.ErrBufferPoolClosed))
+			Expect(bufferPool.ApplyNewPage(0, table.NewDataPage(true))).To(MatchError(memory.ErrBufferPoolClosed))
+			Expect(bufferPool.FlushPage(pageNumber)).To(MatchError(memory.ErrBufferPoolClosed))
+			Expect(bufferPool.FlushAll()).To(MatchError(memory.ErrBufferPoolClosed))
+			Expect(func() {
+				bufferPool.Unpin(pageNumber, true)
+			}).ToNot(Panic())
+		})
+	})
+
+	Describe("resizing", func() {
+		// pinPage applies a new page holding the key and keeps it pinned.
+		pinPage := func(key int) table.PageNumber {
+			p := table.NewDataPage(true)
+			p.Append(table.NewRecordFromLiteral(key))
+			Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+			return p.PageNumber()
+		}
+
+		It("should refuse a size without frames", func() {
+			Expect(bufferPool.Resize(0)).To(MatchError(memory.ErrInvalidPoolSize))
+			Expect(bufferPool.PoolSize()).To(Equal(poolSize))
+		})
+
+		It("should add free frames when growing", func() {
+			for i := 0; i < poolSize; i++ {
+				pinPage(i)
+			}
+			Expect(bufferPool.ApplyNewPage(0, table.NewDataPage(true))).To(MatchError(memory.ErrBufferPoolIsFull))
+
+			Expect(bufferPool.Resize(2 * poolSize)).To(Succeed())
+			Expect(bufferPool.PoolSize()).To(Equal(2 * poolSize))
+			for i := 0; i < poolSize; i++ {
+				pinPage(poolSize + i)
+			}
+		})
+
+		It("should write the dirty pages it evicts when shrinking", func() {
+			pageNumbers := make([]table.PageNumber, poolSize)
+			for i := range pageNumbers {
+				pageNumbers[i] = newPage(i)
+			}
+
+			Expect(bufferPool.Resize(1)).To(Succeed())
+			Expect(bufferPool.PoolSize()).To(Equal(1))
+			for i, pageNumber := range pageNumbers {
+				Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+			}
+		})
+
+		It("should wait for the pinned pages when shrinking without stopping the fetches", func() {
+			pinned := []table.PageNumber{pinPage(0), pinPage(1)}
+			newPage(2)
+
+			resized := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(resized)
+				Expect(bufferPool.Resize(1)).To(Succeed())
+			}()
+			Eventually(bufferPool.PoolSize).Should(Equal(len(pinned)))
+			Consistently(resized).ShouldNot(BeClosed())
+			Expect(keyOf(pinned[0])).To(Equal(int32(0)))
+
+			bufferPool.Unpin(pinned[1], true)
+			Eventually(resized).Should(BeClosed())
+			Expect(bufferPool.PoolSize()).To(Equal(1))
+			Expect(keyOf(pinned[0])).To(Equal(int32(0)))
+			bufferPool.Unpin(pinned[0], true)
+			Expect(keyOf(pinned[1])).To(Equal(int32(1)))
+		})
+
+		It("should give up waiting for the pinned pages when closed", func() {
+			pinPage(0)
+			pinPage(1)
+
+			resized := make(chan error)
+			go func() {
+				resized <- bufferPool.Resize(1)
+			}()
+			Consistently(resized).ShouldNot(Receive())
+
+			Expect(bufferPool.Close()).To(Succeed())
+			Eventually(resized).Should(Receive(MatchError(memory.ErrBufferPoolClosed)))
+		})
+
+		It("should shrink while the pages are deleted", func() {
+			pinned := make([]table.PageNumber, poolSize)
+			for i := range pinned {
+				pinned[i] = pinPage(i)
+			}
+
+			resized := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(resized)
+				Expect(bufferPool.Resize(1)).To(Succeed())
+			}()
+			Consistently(resized).ShouldNot(BeClosed())
+
+			var wg sync.WaitGroup
+			for _, pageNumber := range pinned[1:] {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					bufferPool.Unpin(pageNumber, true)
+					Expect(bufferPool.DeletePage(pageNumber)).To(Succeed())
+				}()
+			}
+			wg.Wait()
+			Eventually(resized).Should(BeClosed())
+			Expect(bufferPool.PoolSize()).To(Equal(1))
+			bufferPool.Unpin(pinned[0], true)
+			Expect(keyOf(pinned[0])).To(Equal(int32(0)))
+			for _, pageNumber := range pinned[1:] {
+				_, err := bufferPool.FetchPage(pageNumber, schema)
+				Expect(err).To(MatchError(disk.ErrPageNotAllocated))
+			}
+		})
+
+		DescribeTable("should serve the pages with every replacement policy while resized",
+			func(policy memory.Policy) {
+				replacer, err := memory.NewReplacer(policy, poolSize)
+				Expect(err).ToNot(HaveOccurred())
+				bufferPool = memory.NewBufferPool(poolSize, diskManager, replacer)
+				DeferCleanup(bufferPool.Close)
+
+				pageNumbers := make([]table.PageNumber, 3*poolSize)
+				for i := range pageNumbers {
+					pageNumbers[i] = newPage(i)
+				}
+				for _, size := range []int{2 * poolSize, 1, poolSize, 3 * poolSize} {
+					Expect(bufferPool.Resize(size)).To(Succeed())
+					for i, pageNumber := range pageNumbers {
+						Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+					}
+				}
+			},
+			Entry("LRU-k", memory.LRUKPolicy),
+			Entry("CLOCK", memory.ClockPolicy),
+			Entry("ARC", memory.ARCPolicy),
+			Entry("midpoint", memory.MidpointPolicy),
+		)
+	})
+
+	Describe("disk I/O", func() {
+		var blockingManager *blockingDiskManager
+		var blocked table.PageNumber
+
+		// fetchBlocked fetches the blocked page in the background, the returned chan is closed once it is fetched.
+		fetchBlocked := func() chan struct{} {
+			fetched := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(fetched)
+				_, err := bufferPool.FetchPage(blocked, schema)
+				Expect(err).ToNot(HaveOccurred())
+				bufferPool.Unpin(blocked, false)
+			}()
+			return fetched
+		}
+
+		BeforeEach(func() {
+			p := table.NewDataPage(true)
+			p.Append(table.NewRecordFromLiteral(42))
+			blocked = p.PageNumber()
+
+			blockingManager = newBlockingDiskManager(blocked)
+			Expect(blockingManager.WritePage(blocked, p.Buffer())).To(Succeed())
+			bufferPool = memory.NewBufferPool(poolSize, blockingManager, memory.NewLRUKReplacer(2))
+			DeferCleanup(bufferPool.Close)
+			diskManager = blockingManager.countingDiskManager
+		})
+
+		It("should serve the other pages while reading a page", func() {
+			pageNumber := newPage(0)
+			fetched := fetchBlocked()
+			Eventually(blockingManager.reading).Should(Receive())
+
+			Expect(keyOf(pageNumber)).To(Equal(int32(0)))
+			newPage(1)
+			Consistently(fetched).ShouldNot(BeClosed())
+
+			close(blockingManager.release)
+			Eventually(fetched).Should(BeClosed())
+			Expect(keyOf(blocked)).To(Equal(int32(42)))
+		})
+
+		It("should read a page once for the fetches waiting for it", func() {
+			fetches := []chan struct{}{fetchBlocked()}
+			Eventually(blockingManager.reading).Should(Receive())
+			fetches = append(fetches, fetchBlocked(), fetchBlocked())
+			Consistently(fetches[1]).ShouldNot(BeClosed())
+
+			close(blockingManager.release)
+			for _, fetched := range fetches {
+				Eventually(fetched).Should(BeClosed())
+			}
+			Expect(blockingManager.readsOf(blocked)).To(Equal(1))
+		})
+
+		It("should shrink into the frame of a page failing to be read", func() {
+			pinned := make([]table.PageNumber, poolSize-1)
+			for i := range pinned {
+				p := table.NewDataPage(true)
+				p.Append(table.NewRecordFromLiteral(i))
+				Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+				pinned[i] = p.PageNumber()
+			}
+			fetched := make(chan error, 1)
+			go func() {
+				_, err := bufferPool.FetchPage(blocked, schema)
+				fetched <- err
+			}()
+			Eventually(blockingManager.reading).Should(Receive())
+
+			resized := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(resized)
+				Expect(bufferPool.Resize(1)).To(Succeed())
+			}()
+			for _, pageNumber := range pinned[1:] {
+				bufferPool.Unpin(pageNumber, true)
+			}
+			Eventually(bufferPool.PoolSize).Should(Equal(2))
+			Consistently(resized).ShouldNot(BeClosed())
+
+			// The page is deleted while it is read, so its frame is freed once the read fails.
+			Expect(blockingManager.DeallocatePage(blocked)).To(Succeed())
+			close(blockingManager.release)
+			Eventually(fetched).Should(Receive(MatchError(disk.ErrPageNotAllocated)))
+			Eventually(resized).Should(BeClosed())
+			Expect(bufferPool.PoolSize()).To(Equal(1))
+			bufferPool.Unpin(pinned[0], true)
+		})
+
+		It("should wait for the reads in progress when closed", func() {
+			fetched := make(chan error, 1)
+			go func() {
+				_, err := bufferPool.FetchPage(blocked, schema)
+				fetched <- err
+			}()
+			Eventually(blockingManager.reading).Should(Receive())
+
+			closed := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(closed)
+				Expect(bufferPool.Close()).To(Succeed())
+			}()
+			Consistently(closed).ShouldNot(BeClosed())
+
+			close(blockingManager.release)
+			// The page read after closing is not returned from a closed buffer pool.
+			Eventually(fetched).Should(Receive(MatchError(memory.ErrBufferPoolClosed)))
+			Eventually(closed).Should(BeClosed())
+			Expect(bufferPool.PinnedPages()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,138 @@
+package memory
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// ClockReplacer implements the CLOCK (second chance) replacement policy.
+//
+// The buffer pages are kept in a ring swept by a clock hand.
+// An access sets the reference bit of the page, and the hand clears the bits it passes over,
+// evicting the first evictable page whose bit is already clear.
+// A page accessed since the last sweep is therefore given a second chance.
+//
+// CLOCK approximates LRU, an access only sets a bit so it is cheaper than moving the page in a list.
+//
+// See also: https://en.wikipedia.org/wiki/Page_replacement_algorithm#Clock
+type ClockReplacer struct {
+	mu sync.Mutex
+	// size is the number of buffer pages can be evicted.
+	size int
+	ring *list.List
+	// hand points to the next buffer page to be examined, nil if the ring is empty.
+	hand    *list.Element
+	entries map[table.PageNumber]*list.Element
+}
+
+type clockEntry struct {
+	pageNumber table.PageNumber
+	referenced bool
+	evictable  bool
+}
+
+func NewClockReplacer() *ClockReplacer {
+	return &ClockReplacer{
+		ring:    list.New(),
+		entries: make(map[table.PageNumber]*list.Element),
+	}
+}
+
+func (r *ClockReplacer) Evict() (table.PageNumber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size == 0 {
+		return table.InvalidPageNumber, ErrNoPageToEvict
+	}
+
+	// The first sweep clears the reference bits at worst, so the second one finds a page.
+	for i := 0; i < 2*r.ring.Len(); i++ {
+		entry := r.entryOf(r.hand)
+		if entry.evictable {
+			if !entry.referenced {
+				return entry.pageNumber, nil
+			}
+			entry.referenced = false
+		}
+		r.advance()
+	}
+
+	return table.InvalidPageNumber, ErrNoPageToEvict
+}
+
+func (r *ClockReplacer) Access(pageNumber table.PageNumber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.entries[pageNumber]; ok {
+		r.entryOf(e).referenced = true
+		return
+	}
+
+	// A new page is put right behind the hand, so it is examined last.
+	entry := &clockEntry{pageNumber: pageNumber, referenced: true}
+	if r.hand == nil {
+		r.hand = r.ring.PushBack(entry)
+		r.entries[pageNumber] = r.hand
+		return
+	}
+	r.entries[pageNumber] = r.ring.InsertBefore(entry, r.hand)
+}
+
+func (r *ClockReplacer) SetEvictable(pageNumber table.PageNumber, setEvictable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok {
+		return
+	}
+
+	entry := r.entryOf(e)
+	if !entry.evictable && setEvictable {
+		r.size++
+	}
+	if entry.evictable && !setEvictable {
+		r.size--
+	}
+	entry.evictable = setEvictable
+}
+
+func (r *ClockReplacer) Remove(pageNumber table.PageNumber) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok {
+		return nil
+	}
+	if !r.entryOf(e).evictable {
+		return errors.New("page is not evictable")
+	}
+
+	if r.hand == e {
+		r.advance()
+	}
+	r.ring.Remove(e)
+	delete(r.entries, pageNumber)
+	if r.ring.Len() == 0 {
+		r.hand = nil
+	}
+	r.size--
+	return nil
+}
+
+// advance moves the hand to the next buffer page of the ring.
+func (r *ClockReplacer) advance() {
+	if r.hand = r.hand.Next(); r.hand == nil {
+		r.hand = r.ring.Front()
+	}
+}
+
+func (r *ClockReplacer) entryOf(e *list.Element) *clockEntry {
+	return e.Value.(*clockEntry) //nolint:errcheck,forcetypeassert // The ring only holds clock entries.
+}
@@ -0,0 +1,72 @@
+package memory_test
+
+import (
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("ClockReplacer", func() {
+	var replacer *memory.ClockReplacer
+
+	// access accesses the pages and makes them evictable.
+	access := func(pageNumbers ...table.PageNumber) {
+		for _, pageNumber := range pageNumbers {
+			replacer.Access(pageNumber)
+			replacer.SetEvictable(pageNumber, true)
+		}
+	}
+
+	evict := func() table.PageNumber {
+		pageNumber, err := replacer.Evict()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replacer.Remove(pageNumber)).To(Succeed())
+		return pageNumber
+	}
+
+	BeforeEach(func() {
+		replacer = memory.NewClockReplacer()
+	})
+
+	It("should give the referenced pages a second chance", func() {
+		access(1, 2, 3)
+		// Every page is referenced, so the hand goes round once clearing them.
+		Expect(evict()).To(Equal(table.PageNumber(1)))
+
+		// The new page 4 is put behind the hand, and is referenced like the page 2.
+		access(4, 2)
+		Expect(evict()).To(Equal(table.PageNumber(3)))
+		Expect(evict()).To(Equal(table.PageNumber(2)))
+		Expect(evict()).To(Equal(table.PageNumber(4)))
+	})
+
+	It("should skip the page which not evictable", func() {
+		access(1, 2, 3)
+		replacer.SetEvictable(1, false)
+
+		Expect(evict()).To(Equal(table.PageNumber(2)))
+		Expect(replacer.Remove(1)).To(HaveOccurred())
+	})
+
+	It("should raise error if no pages to evict", func() {
+		access(1, 2)
+		replacer.SetEvictable(1, false)
+		replacer.SetEvictable(2, false)
+
+		pageNumber, err := replacer.Evict()
+		Expect(err).To(MatchError(memory.ErrNoPageToEvict))
+		Expect(pageNumber).To(Equal(table.InvalidPageNumber))
+	})
+
+	It("should keep working once emptied", func() {
+		access(1)
+		Expect(evict()).To(Equal(table.PageNumber(1)))
+		_, err := replacer.Evict()
+		Expect(err).To(MatchError(memory.ErrNoPageToEvict))
+
+		access(2)
+		Expect(evict()).To(Equal(table.PageNumber(2)))
+	})
+})
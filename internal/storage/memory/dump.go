@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var ErrInvalidDump = errors.New("invalid buffer pool dump")
+
+// dumpHeader is the first line of a buffer pool dump.
+const dumpHeader = "# libradb buffer pool dump: space_id page_number"
+
+// DumpEntry is a page resident in the buffer pool when it was dumped.
+type DumpEntry struct {
+	SpaceID    table.SpaceID
+	PageNumber table.PageNumber
+}
+
+// Dump writes the pages resident in the buffer pool, a space ID and a page number per line,
+// sorted by space ID and page number so that they are loaded back in the order of the data file.
+// The space ID of a page is the one in its header, so it is kept across restarts.
+func (m *BufferPool) Dump(w io.Writer) error {
+	m.mu.RLock()
+	entries := m.residentPages()
+	m.mu.RUnlock()
+
+	return writeDump(w, entries)
+}
+
+// DumpFile dumps the pages resident in the buffer pool to the file, replacing it at once.
+func (m *BufferPool) DumpFile(path string) error {
+	m.mu.RLock()
+	entries := m.residentPages()
+	m.mu.RUnlock()
+
+	return dumpFile(path, entries)
+}
+
+// residentPages returns the pages in the buffer pool, sorted by space ID and page number.
+func (m *BufferPool) residentPages() []DumpEntry {
+	entries := make([]DumpEntry, 0, len(m.pageTable))
+	for pageNumber, cb := range m.pageTable {
+		// The page being read may not exist on disk.
+		if cb.state == frameReading {
+			continue
+		}
+		entries = append(entries, DumpEntry{SpaceID: cb.bufferPage.SpaceID(), PageNumber: pageNumber})
+	}
+	sortDump(entries)
+	return entries
+}
+
+func sortDump(entries []DumpEntry) {
+	slices.SortFunc(entries, func(a, b DumpEntry) int {
+		return cmp.Or(cmp.Compare(a.SpaceID, b.SpaceID), cmp.Compare(a.PageNumber, b.PageNumber))
+	})
+}
+
+func writeDump(w io.Writer, entries []DumpEntry) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, dumpHeader)
+	for _, entry := range entries {
+		fmt.Fprintf(bw, "%d %d\n", entry.SpaceID, entry.PageNumber)
+	}
+	return bw.Flush()
+}
+
+// dumpFile writes the dump to a temporary file renamed to path,
+// so that a crash while dumping leaves the previous dump whole.
+func dumpFile(path string, entries []DumpEntry) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err = writeDump(f, entries); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ReadDump reads a buffer pool dump written by Dump,
+// the blank lines and the lines starting with # are skipped.
+func ReadDump(r io.Reader) ([]DumpEntry, error) {
+	var entries []DumpEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 { //nolint:mnd // A space ID and a page number.
+			return nil, fmt.Errorf("%w: line %d: %q", ErrInvalidDump, line, text)
+		}
+		spaceID, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidDump, line, err)
+		}
+		pageNumber, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidDump, line, err)
+		}
+		entries = append(entries, DumpEntry{SpaceID: table.SpaceID(spaceID), PageNumber: table.PageNumber(pageNumber)})
+	}
+	return entries, scanner.Err()
+}
+
+// ReadDumpFile reads a buffer pool dump from the file.
+func ReadDumpFile(path string) ([]DumpEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadDump(f)
+}
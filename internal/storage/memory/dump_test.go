@@ -0,0 +1,171 @@
+package memory_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Dump", func() {
+	const poolSize = 8
+
+	var diskManager *countingDiskManager
+	var bufferPool *memory.BufferPool
+	var schema *table.Schema
+	var path string
+
+	// newPage applies a new page of the space and unpins it.
+	newPage := func(spaceID table.SpaceID) table.PageNumber {
+		p := table.NewDataPage(true)
+		p.Append(table.NewRecordFromLiteral(1))
+		Expect(bufferPool.ApplyNewPage(spaceID, p)).To(Succeed())
+		bufferPool.Unpin(p.PageNumber(), true)
+		return p.PageNumber()
+	}
+
+	BeforeEach(func() {
+		diskManager = newCountingDiskManager()
+		bufferPool = memory.NewBufferPool(poolSize, diskManager, memory.NewLRUKReplacer(2))
+		DeferCleanup(bufferPool.Close)
+		schema = table.NewSchema().WithField("id", field.NewInteger())
+		path = filepath.Join(GinkgoT().TempDir(), "buffer_pool.dump")
+	})
+
+	It("should dump the resident pages sorted by space ID and page number", func() {
+		// The page written to disk outside of a space has space ID 0.
+		onDisk := table.NewDataPage(true)
+		Expect(diskManager.WritePage(onDisk.PageNumber(), onDisk.Buffer())).To(Succeed())
+		second, first := newPage(2), newPage(1)
+		_, err := bufferPool.FetchPage(onDisk.PageNumber(), schema)
+		Expect(err).ToNot(HaveOccurred())
+		bufferPool.Unpin(onDisk.PageNumber(), false)
+
+		var buf bytes.Buffer
+		Expect(bufferPool.Dump(&buf)).To(Succeed())
+		Expect(memory.ReadDump(&buf)).To(Equal([]memory.DumpEntry{
+			{SpaceID: 0, PageNumber: onDisk.PageNumber()},
+			{SpaceID: 1, PageNumber: first},
+			{SpaceID: 2, PageNumber: second},
+		}))
+	})
+
+	It("should not dump the deleted pages", func() {
+		kept, deleted := newPage(1), newPage(1)
+		Expect(bufferPool.DeletePage(deleted)).To(Succeed())
+
+		var buf bytes.Buffer
+		Expect(bufferPool.Dump(&buf)).To(Succeed())
+		Expect(memory.ReadDump(&buf)).To(Equal([]memory.DumpEntry{{SpaceID: 1, PageNumber: kept}}))
+	})
+
+	It("should replace the dump file on demand", func() {
+		first := newPage(1)
+		Expect(bufferPool.DumpFile(path)).To(Succeed())
+		second := newPage(1)
+		Expect(bufferPool.DumpFile(path)).To(Succeed())
+
+		Expect(memory.ReadDumpFile(path)).To(Equal([]memory.DumpEntry{
+			{SpaceID: 1, PageNumber: first},
+			{SpaceID: 1, PageNumber: second},
+		}))
+		Expect(filepath.Glob(path + ".*")).To(BeEmpty())
+	})
+
+	It("should dump the resident pages to the file when closed", func() {
+		bufferPool = memory.NewBufferPool(poolSize, diskManager, memory.NewLRUKReplacer(2),
+			memory.WithDumpAtShutdown(path))
+		pageNumber := newPage(1)
+		Expect(bufferPool.Close()).To(Succeed())
+
+		Expect(memory.ReadDumpFile(path)).To(Equal([]memory.DumpEntry{{SpaceID: 1, PageNumber: pageNumber}}))
+	})
+
+	It("should dump the pages of every instance of a sharded buffer pool when closed", func() {
+		const instances = 4
+		sharded, err := memory.NewShardedBufferPool(instances, poolSize, diskManager, memory.LRUKPolicy,
+			memory.WithDumpAtShutdown(path))
+		Expect(err).ToNot(HaveOccurred())
+
+		var entries []memory.DumpEntry
+		for i := 0; i < instances; i++ {
+			// The pages are an extent apart to fall in several instances.
+			p := table.NewDataPage(true)
+			for range 64 {
+				table.NewDataPage(true)
+			}
+			Expect(sharded.ApplyNewPage(1, p)).To(Succeed())
+			sharded.Unpin(p.PageNumber(), true)
+			entries = append(entries, memory.DumpEntry{SpaceID: 1, PageNumber: p.PageNumber()})
+		}
+		Expect(sharded.Close()).To(Succeed())
+
+		Expect(memory.ReadDumpFile(path)).To(Equal(entries))
+	})
+
+	It("should keep the space IDs of the pages read from disk across restarts", func() {
+		dir := GinkgoT().TempDir()
+		schemaOf := func(table.SpaceID) *table.Schema {
+			return schema
+		}
+		restart := func() {
+			spaceManager, err := disk.NewSpaceManager(dir)
+			Expect(err).ToNot(HaveOccurred())
+			bufferPool = memory.NewBufferPool(poolSize, spaceManager, memory.NewLRUKReplacer(2),
+				memory.WithDumpAtShutdown(path))
+			DeferCleanup(bufferPool.Close)
+		}
+
+		restart()
+		var entries []memory.DumpEntry
+		for _, spaceID := range []table.SpaceID{1, 2, 1, 2} {
+			entries = append(entries, memory.DumpEntry{SpaceID: spaceID, PageNumber: newPage(spaceID)})
+		}
+		sorted := []memory.DumpEntry{entries[0], entries[2], entries[1], entries[3]}
+		Expect(bufferPool.Close()).To(Succeed())
+		Expect(memory.ReadDumpFile(path)).To(Equal(sorted))
+
+		// The pages are only read from disk after the restart.
+		restart()
+		for _, entry := range entries {
+			_, err := bufferPool.FetchPage(entry.PageNumber, schema)
+			Expect(err).ToNot(HaveOccurred())
+			bufferPool.Unpin(entry.PageNumber, false)
+		}
+		Expect(bufferPool.Close()).To(Succeed())
+		dumped, err := memory.ReadDumpFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dumped).To(Equal(sorted))
+
+		restart()
+		Expect(bufferPool.Warm(dumped, schemaOf, memory.WithWarmRate(0)).Wait()).
+			To(Equal(memory.WarmStats{Loaded: len(entries)}))
+		Expect(bufferPool.Close()).To(Succeed())
+		Expect(memory.ReadDumpFile(path)).To(Equal(dumped))
+	})
+
+	It("should skip the comments and the blank lines", func() {
+		Expect(memory.ReadDump(strings.NewReader("# dump\n\n1 2\n  \n3 4\n"))).To(Equal([]memory.DumpEntry{
+			{SpaceID: 1, PageNumber: 2},
+			{SpaceID: 3, PageNumber: 4},
+		}))
+	})
+
+	DescribeTable("should refuse an invalid dump",
+		func(dump string) {
+			_, err := memory.ReadDump(strings.NewReader(dump))
+			Expect(err).To(MatchError(memory.ErrInvalidDump))
+		},
+		Entry("missing page number", "1\n"),
+		Entry("extra field", "1 2 3\n"),
+		Entry("invalid space ID", "x 2\n"),
+		Entry("negative page number", "1 -2\n"),
+	)
+})
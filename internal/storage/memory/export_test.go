@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// PinnedPages exposes the pages still pinned in the buffer pool to the tests.
+func (m *BufferPool) PinnedPages() []table.PageNumber {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var pageNumbers []table.PageNumber
+	for pageNumber, count := range m.pinCounter {
+		if count > 0 {
+			pageNumbers = append(pageNumbers, pageNumber)
+		}
+	}
+	return pageNumbers
+}
+
+// InstanceIndex exposes the index of the instance holding the page to the tests.
+func (m *ShardedBufferPool) InstanceIndex(pageNumber table.PageNumber) int {
+	instance := m.instanceOf(pageNumber)
+	for i := range m.instances {
+		if m.instances[i] == instance {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,210 @@
+package memory
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+const (
+	// DefaultOldBlocksPct is the default least percentage of the buffer pages kept in the old sublist.
+	DefaultOldBlocksPct = 37
+	// DefaultOldBlocksTime is the default time since the first access to a page before an access promotes it.
+	DefaultOldBlocksTime = time.Second
+)
+
+// MidpointReplacer implements the LRU replacement policy with midpoint insertion of InnoDB.
+//
+// The LRU list is split into a young sublist of the pages accessed again
+// and an old sublist of the pages recently read in, and the pages are evicted from the old end.
+// A page read in enters the list at the midpoint, the head of the old sublist,
+// and an access promotes it to the head of the young sublist only
+// once the old blocks time has passed since its first access.
+// The pages a scan touches several times in a row are thus evicted without pushing out the young pages.
+//
+// A page accessed with AccessOnce, such as by a scan, enters the list at the old end instead,
+// and the access does not promote the page.
+//
+// See also: https://dev.mysql.com/doc/refman/8.0/en/innodb-performance-midpoint_insertion.html
+type MidpointReplacer struct {
+	mu sync.Mutex
+	// oldBlocksPct is the least percentage of the buffer pages kept in the old sublist.
+	oldBlocksPct int
+	// oldBlocksTime is the time since the first access to a page before an access promotes it.
+	oldBlocksTime time.Duration
+	now           func() time.Time
+	// size is the number of buffer pages can be evicted.
+	size    int
+	young   *list.List
+	old     *list.List
+	entries map[table.PageNumber]*list.Element
+}
+
+type MidpointOption func(*MidpointReplacer)
+
+// WithOldBlocksPct sets the least percentage of the buffer pages kept in the old sublist, from 5 to 95.
+func WithOldBlocksPct(pct int) MidpointOption {
+	return func(r *MidpointReplacer) {
+		r.oldBlocksPct = min(max(pct, 5), 95) //nolint:mnd // The bounds of InnoDB.
+	}
+}
+
+// WithOldBlocksTime sets the time since the first access to a page before an access promotes it.
+func WithOldBlocksTime(d time.Duration) MidpointOption {
+	return func(r *MidpointReplacer) {
+		r.oldBlocksTime = d
+	}
+}
+
+// WithClock sets the clock telling the time of the accesses.
+func WithClock(now func() time.Time) MidpointOption {
+	return func(r *MidpointReplacer) {
+		r.now = now
+	}
+}
+
+type midpointEntry struct {
+	pageNumber table.PageNumber
+	young      bool
+	evictable  bool
+	// firstAccess is the time the page was first accessed since it was read in.
+	firstAccess time.Time
+}
+
+func NewMidpointReplacer(opts ...MidpointOption) *MidpointReplacer {
+	r := &MidpointReplacer{
+		oldBlocksPct:  DefaultOldBlocksPct,
+		oldBlocksTime: DefaultOldBlocksTime,
+		now:           time.Now,
+		young:         list.New(),
+		old:           list.New(),
+		entries:       make(map[table.PageNumber]*list.Element),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *MidpointReplacer) Evict() (table.PageNumber, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size == 0 {
+		return table.InvalidPageNumber, ErrNoPageToEvict
+	}
+
+	for _, l := range []*list.List{r.old, r.young} {
+		for e := l.Back(); e != nil; e = e.Prev() {
+			if entry := r.entryOf(e); entry.evictable {
+				return entry.pageNumber, nil
+			}
+		}
+	}
+
+	return table.InvalidPageNumber, ErrNoPageToEvict
+}
+
+func (r *MidpointReplacer) Access(pageNumber table.PageNumber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok {
+		entry := &midpointEntry{pageNumber: pageNumber, firstAccess: r.now()}
+		r.entries[pageNumber] = r.old.PushFront(entry)
+		r.balance()
+		return
+	}
+
+	entry := r.entryOf(e)
+	if entry.young {
+		r.young.MoveToFront(e)
+		return
+	}
+	if r.now().Sub(entry.firstAccess) >= r.oldBlocksTime {
+		r.old.Remove(e)
+		entry.young = true
+		r.entries[pageNumber] = r.young.PushFront(entry)
+		r.balance()
+	}
+}
+
+// AccessOnce records an access to a page which is not going to be accessed again soon.
+// A page read in is put at the old end of the list, and a page already in the list is left in place.
+func (r *MidpointReplacer) AccessOnce(pageNumber table.PageNumber) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.entries[pageNumber]; ok {
+		return
+	}
+	entry := &midpointEntry{pageNumber: pageNumber, firstAccess: r.now()}
+	r.entries[pageNumber] = r.old.PushBack(entry)
+	r.balance()
+}
+
+func (r *MidpointReplacer) SetEvictable(pageNumber table.PageNumber, setEvictable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok {
+		return
+	}
+
+	entry := r.entryOf(e)
+	if !entry.evictable && setEvictable {
+		r.size++
+	}
+	if entry.evictable && !setEvictable {
+		r.size--
+	}
+	entry.evictable = setEvictable
+}
+
+func (r *MidpointReplacer) Remove(pageNumber table.PageNumber) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[pageNumber]
+	if !ok {
+		return nil
+	}
+	entry := r.entryOf(e)
+	if !entry.evictable {
+		return errors.New("page is not evictable")
+	}
+
+	if entry.young {
+		r.young.Remove(e)
+	} else {
+		r.old.Remove(e)
+	}
+	delete(r.entries, pageNumber)
+	r.size--
+	r.balance()
+	return nil
+}
+
+// balance moves the midpoint so that the old sublist holds at least oldBlocksPct percent of the pages,
+// the least recently used young pages are moved to the old sublist.
+//
+// The old sublist is not shrunk on the other hand, a page only becomes young when it is promoted.
+func (r *MidpointReplacer) balance() {
+	target := (r.young.Len() + r.old.Len()) * r.oldBlocksPct / 100 //nolint:mnd // Percentage.
+	for r.old.Len() < target && r.young.Len() > 0 {
+		e := r.young.Back()
+		entry := r.entryOf(e)
+		r.young.Remove(e)
+		entry.young = false
+		r.entries[entry.pageNumber] = r.old.PushFront(entry)
+	}
+}
+
+func (r *MidpointReplacer) entryOf(e *list.Element) *midpointEntry {
+	return e.Value.(*midpointEntry) //nolint:errcheck,forcetypeassert // The lists only hold midpoint entries.
+}
@@ -0,0 +1,171 @@
+package memory_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("MidpointReplacer", func() {
+	const oldBlocksTime = time.Second
+
+	var now time.Time
+	clock := func() time.Time {
+		return now
+	}
+
+	Describe("replacing pages", func() {
+		var replacer *memory.MidpointReplacer
+
+		// access accesses the pages and makes them evictable.
+		access := func(pageNumbers ...table.PageNumber) {
+			for _, pageNumber := range pageNumbers {
+				replacer.Access(pageNumber)
+				replacer.SetEvictable(pageNumber, true)
+			}
+		}
+
+		evict := func() table.PageNumber {
+			pageNumber, err := replacer.Evict()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replacer.Remove(pageNumber)).To(Succeed())
+			return pageNumber
+		}
+
+		BeforeEach(func() {
+			now = time.Unix(0, 0)
+			replacer = memory.NewMidpointReplacer(
+				memory.WithOldBlocksPct(50), memory.WithOldBlocksTime(oldBlocksTime), memory.WithClock(clock),
+			)
+		})
+
+		It("should only promote the pages accessed again after the old blocks time", func() {
+			access(1, 2, 3, 4)
+			// The page 1 is accessed again right away, and the page 2 once the old blocks time has passed.
+			access(1)
+			now = now.Add(oldBlocksTime)
+			access(2)
+
+			Expect(evict()).To(Equal(table.PageNumber(1)))
+			Expect(evict()).To(Equal(table.PageNumber(3)))
+			Expect(evict()).To(Equal(table.PageNumber(4)))
+			Expect(evict()).To(Equal(table.PageNumber(2)))
+		})
+
+		It("should evict the pages accessed once first", func() {
+			access(1, 2)
+			replacer.AccessOnce(3)
+			replacer.SetEvictable(3, true)
+			// Accessing once does not move the page 1.
+			replacer.AccessOnce(1)
+
+			Expect(evict()).To(Equal(table.PageNumber(3)))
+			Expect(evict()).To(Equal(table.PageNumber(1)))
+			Expect(evict()).To(Equal(table.PageNumber(2)))
+		})
+
+		It("should skip the page which not evictable", func() {
+			access(1, 2)
+			replacer.SetEvictable(1, false)
+
+			Expect(evict()).To(Equal(table.PageNumber(2)))
+			Expect(replacer.Remove(1)).To(HaveOccurred())
+			_, err := replacer.Evict()
+			Expect(err).To(MatchError(memory.ErrNoPageToEvict))
+		})
+	})
+
+	Describe("buffer pool", func() {
+		const poolSize = 16
+		const hotSetSize = 4
+		const scanSize = 8 * poolSize
+
+		var diskManager *countingDiskManager
+		var bufferPool *memory.BufferPool
+		var schema *table.Schema
+		var hotSet, scanned []table.PageNumber
+
+		fetch := func(pageNumber table.PageNumber, opts ...memory.FetchOption) {
+			_, err := bufferPool.FetchPage(pageNumber, schema, opts...)
+			Expect(err).NotTo(HaveOccurred())
+			bufferPool.Unpin(pageNumber, false)
+		}
+
+		// newBufferPool fills the buffer pool with the first pages of the scan, then looks up the hot set for a while.
+		newBufferPool := func(replacer memory.Replacer) {
+			bufferPool = memory.NewBufferPool(poolSize, diskManager, replacer)
+			DeferCleanup(bufferPool.Close)
+
+			for _, pageNumber := range scanned[:poolSize] {
+				fetch(pageNumber)
+			}
+			for _, pageNumber := range hotSet {
+				fetch(pageNumber)
+			}
+			// The point lookups go on for a while.
+			now = now.Add(oldBlocksTime)
+			for _, pageNumber := range hotSet {
+				fetch(pageNumber)
+			}
+		}
+
+		expectHotSetKept := func() {
+			for _, pageNumber := range hotSet {
+				fetch(pageNumber)
+				Expect(diskManager.readsOf(pageNumber)).To(Equal(1))
+			}
+		}
+
+		BeforeEach(func() {
+			now = time.Unix(0, 0)
+			diskManager = newCountingDiskManager()
+			schema = table.NewSchema().WithField("id", field.NewInteger())
+
+			hotSet, scanned = make([]table.PageNumber, hotSetSize), make([]table.PageNumber, scanSize)
+			for _, pageNumbers := range [][]table.PageNumber{hotSet, scanned} {
+				for i := range pageNumbers {
+					p := table.NewDataPage(true)
+					p.Append(table.NewRecordFromLiteral(i))
+					Expect(diskManager.WritePage(p.PageNumber(), p.Buffer())).To(Succeed())
+					pageNumbers[i] = p.PageNumber()
+				}
+			}
+		})
+
+		It("should keep the hot set through a full scan touching each page several times", func() {
+			newBufferPool(memory.NewMidpointReplacer(memory.WithOldBlocksTime(oldBlocksTime), memory.WithClock(clock)))
+			for _, pageNumber := range scanned {
+				// A page is fetched once per record it holds.
+				fetch(pageNumber)
+				fetch(pageNumber)
+			}
+			expectHotSetKept()
+		})
+
+		It("should keep the hot set through a full scan fetching pages as used once", func() {
+			newBufferPool(memory.NewMidpointReplacer(memory.WithOldBlocksTime(oldBlocksTime), memory.WithClock(clock)))
+			for _, pageNumber := range scanned {
+				fetch(pageNumber, memory.WithUseOnce())
+			}
+			expectHotSetKept()
+		})
+
+		It("should lose the hot set through a full scan without midpoint insertion", func() {
+			newBufferPool(memory.NewLRUKReplacer(2))
+			for _, pageNumber := range scanned {
+				fetch(pageNumber)
+				fetch(pageNumber)
+			}
+
+			for _, pageNumber := range hotSet {
+				fetch(pageNumber)
+				Expect(diskManager.readsOf(pageNumber)).To(Equal(2))
+			}
+		})
+	})
+})
@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+// ReadPageGuard keeps a page pinned and holds its latch shared until it is dropped,
+// so the page can be read while no one else writes it.
+type ReadPageGuard struct {
+	pool    *BufferPool
+	cb      *controlBlock
+	page    table.Page
+	dropped bool
+}
+
+// Page returns the guarded page, it must not be modified.
+func (g *ReadPageGuard) Page() table.Page {
+	return g.page
+}
+
+func (g *ReadPageGuard) PageNumber() table.PageNumber {
+	return g.page.PageNumber()
+}
+
+// Drop releases the latch and the pin of the page, dropping the guard more than once does nothing.
+func (g *ReadPageGuard) Drop() {
+	if g.dropped {
+		return
+	}
+	g.dropped = true
+	g.cb.latch.RUnlock()
+	g.pool.Unpin(g.page.PageNumber(), false)
+}
+
+// WritePageGuard keeps a page pinned and holds its latch exclusively until it is dropped,
+// so the page can be modified while no one else reads or writes it.
+type WritePageGuard struct {
+	pool    *BufferPool
+	cb      *controlBlock
+	page    table.Page
+	dirty   bool
+	dropped bool
+}
+
+// Page returns the guarded page to be modified, the page is written to disk after the guard is dropped.
+func (g *WritePageGuard) Page() table.Page {
+	g.dirty = true
+	return g.page
+}
+
+func (g *WritePageGuard) PageNumber() table.PageNumber {
+	return g.page.PageNumber()
+}
+
+// Drop releases the latch and the pin of the page, marking it dirty if it was accessed,
+// dropping the guard more than once does nothing.
+func (g *WritePageGuard) Drop() {
+	if g.dropped {
+		return
+	}
+	g.dropped = true
+	g.cb.latch.Unlock()
+	g.pool.Unpin(g.page.PageNumber(), g.dirty)
+}
@@ -0,0 +1,138 @@
+package memory_test
+
+import (
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/config"
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Page guard", func() {
+	const poolSize = 4
+
+	var diskManager *countingDiskManager
+	var bufferPool *memory.BufferPool
+	var schema *table.Schema
+	var pageNumber table.PageNumber
+
+	BeforeEach(func() {
+		diskManager = newCountingDiskManager()
+		bufferPool = memory.NewBufferPool(poolSize, diskManager, memory.NewLRUKReplacer(2))
+		schema = table.NewSchema().WithField("id", field.NewInteger())
+
+		p := table.NewDataPage(true)
+		p.Append(table.NewRecordFromLiteral(0))
+		Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+		bufferPool.Unpin(p.PageNumber(), true)
+		Expect(bufferPool.FlushAll()).To(Succeed())
+		pageNumber = p.PageNumber()
+
+		DeferCleanup(func() {
+			// Every guard must be dropped, otherwise its page stays pinned.
+			Expect(bufferPool.PinnedPages()).To(BeEmpty(), "a page guard was never dropped")
+			Expect(bufferPool.Close()).To(Succeed())
+		})
+	})
+
+	It("should let readers share the page", func() {
+		first, err := bufferPool.FetchPageRead(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		defer first.Drop()
+
+		second, err := bufferPool.FetchPageRead(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		defer second.Drop()
+
+		Expect(second.Page()).To(BeIdenticalTo(first.Page()))
+	})
+
+	It("should keep readers out while the page is written", func() {
+		writeGuard, err := bufferPool.FetchPageWrite(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+
+		read := make(chan any)
+		go func() {
+			defer GinkgoRecover()
+			readGuard, readErr := bufferPool.FetchPageRead(pageNumber, schema)
+			Expect(readErr).ToNot(HaveOccurred())
+			key := readGuard.Page().(*table.DataPage).Get(0).GetKey().Val()
+			readGuard.Drop()
+			read <- key
+		}()
+
+		Consistently(read).ShouldNot(Receive())
+		writeGuard.Page().(*table.DataPage).Replace(0, table.NewRecordFromLiteral(42))
+		writeGuard.Drop()
+		Eventually(read).Should(Receive(Equal(int32(42))))
+	})
+
+	It("should not write the page while it is modified", func() {
+		writeGuard, err := bufferPool.FetchPageWrite(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		page := writeGuard.Page().(*table.DataPage)
+		page.Replace(0, table.NewRecordFromLiteral(42))
+		// Mark the page dirty without the latch.
+		_, err = bufferPool.FetchPage(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		bufferPool.Unpin(pageNumber, true)
+
+		flushed := make(chan error)
+		go func() {
+			flushed <- bufferPool.FlushPage(pageNumber)
+		}()
+
+		Consistently(flushed).ShouldNot(Receive())
+		page.Append(table.NewRecordFromLiteral(43))
+		writeGuard.Drop()
+		Eventually(flushed).Should(Receive(BeNil()))
+
+		// The page is written whole, with both modifications.
+		buf := make([]byte, config.PageSize)
+		Expect(diskManager.ReadPage(pageNumber, buf)).To(Succeed())
+		written := table.FromBytes(buf, schema).(*table.DataPage)
+		Expect(written.RecordCount()).To(Equal(uint16(2)))
+		Expect(written.Get(1).GetKey().Val()).To(Equal(int32(43)))
+	})
+
+	It("should only mark the page dirty when written", func() {
+		readGuard, err := bufferPool.FetchPageRead(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		readGuard.Drop()
+		writeGuard, err := bufferPool.FetchPageWrite(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		writeGuard.Drop()
+		Expect(bufferPool.FlushPage(pageNumber)).To(Succeed())
+		Expect(diskManager.writesOf(pageNumber)).To(Equal(1))
+
+		writeGuard, err = bufferPool.FetchPageWrite(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		writeGuard.Page().(*table.DataPage).Replace(0, table.NewRecordFromLiteral(42))
+		writeGuard.Drop()
+		Expect(bufferPool.FlushPage(pageNumber)).To(Succeed())
+		Expect(diskManager.writesOf(pageNumber)).To(Equal(2))
+	})
+
+	It("should release the pin once when dropped twice", func() {
+		held, err := bufferPool.FetchPageRead(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		guard, err := bufferPool.FetchPageRead(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+
+		guard.Drop()
+		guard.Drop()
+		Expect(bufferPool.PinnedPages()).To(ConsistOf(pageNumber))
+		held.Drop()
+	})
+
+	It("should report a guard never dropped", func() {
+		guard, err := bufferPool.FetchPageWrite(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bufferPool.PinnedPages()).To(ConsistOf(pageNumber))
+
+		guard.Drop()
+		Expect(bufferPool.PinnedPages()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,173 @@
+package memory_test
+
+import (
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Read-ahead", func() {
+	const depth = 4
+	// readAheadThreshold is the number of fetches in a row following the links starting the read-ahead.
+	const readAheadThreshold = 2
+
+	var diskManager *countingDiskManager
+	var bufferPool *memory.BufferPool
+	var schema *table.Schema
+	var leaves []table.PageNumber
+
+	newBufferPool := func(poolSize int, opts ...memory.BufferPoolOption) {
+		bufferPool = memory.NewBufferPool(poolSize, diskManager, memory.NewLRUKReplacer(2), opts...)
+		DeferCleanup(bufferPool.Close)
+	}
+
+	fetch := func(pageNumber table.PageNumber) {
+		_, err := bufferPool.FetchPage(pageNumber, schema)
+		Expect(err).NotTo(HaveOccurred())
+		bufferPool.Unpin(pageNumber, false)
+	}
+
+	readAheadStats := func() memory.ReadAheadStats {
+		return bufferPool.ReadAheadStats()
+	}
+
+	BeforeEach(func() {
+		diskManager = newCountingDiskManager()
+		schema = table.NewSchema().WithField("id", field.NewInteger())
+
+		// The leaves are linked like the leaf chain of a B+ tree.
+		pages := make([]*table.DataPage, 16)
+		leaves = make([]table.PageNumber, len(pages))
+		for i := range pages {
+			pages[i] = table.NewDataPage(true)
+			pages[i].Append(table.NewRecordFromLiteral(i))
+			leaves[i] = pages[i].PageNumber()
+		}
+		for i, p := range pages {
+			if i > 0 {
+				p.SetPrev(leaves[i-1])
+			}
+			if i < len(pages)-1 {
+				p.SetNext(leaves[i+1])
+			}
+			Expect(diskManager.WritePage(p.PageNumber(), p.Buffer())).To(Succeed())
+		}
+	})
+
+	It("should read the next leaves ahead of a sequential scan", func() {
+		newBufferPool(32, memory.WithReadAhead(depth))
+
+		fetch(leaves[0])
+		fetch(leaves[1])
+		Expect(readAheadStats().Prefetched).To(BeZero())
+
+		// The third leaf in a row makes the access sequential,
+		// and every leaf fetched afterwards keeps the read-ahead depth leaves ahead.
+		for i := 2; i < len(leaves); i++ {
+			fetch(leaves[i])
+			Eventually(readAheadStats).Should(HaveField("Prefetched", min(i-2+depth, len(leaves)-3)))
+		}
+
+		stats := readAheadStats()
+		Expect(stats.Prefetched).To(Equal(len(leaves) - 3))
+		Expect(stats.Hits).To(Equal(len(leaves) - 3))
+		Expect(stats.Misses).To(Equal(2))
+		for _, pageNumber := range leaves {
+			Expect(diskManager.readsOf(pageNumber)).To(Equal(1))
+		}
+	})
+
+	It("should read ahead of two scans interleaved", func() {
+		newBufferPool(32, memory.WithReadAhead(depth))
+
+		// Each scan goes along its own half of the leaves, and the fetches of the other one do not break it.
+		half := len(leaves) / 2
+		for i := 0; i < half; i++ {
+			for _, scan := range [][]table.PageNumber{leaves[:half], leaves[half:]} {
+				fetch(scan[i])
+				if i >= readAheadThreshold && i+1 < len(scan) {
+					Eventually(diskManager.readsOf).WithArguments(scan[i+1]).Should(Equal(1))
+				}
+			}
+		}
+
+		stats := readAheadStats()
+		Expect(stats.Prefetched).To(Equal(len(leaves) - 6))
+		Expect(stats.Hits).To(Equal(len(leaves) - 6))
+		Expect(stats.Misses).To(Equal(4))
+		for _, pageNumber := range leaves {
+			Expect(diskManager.readsOf(pageNumber)).To(Equal(1))
+		}
+	})
+
+	It("should count the misses when disabled", func() {
+		newBufferPool(32)
+		for _, pageNumber := range leaves {
+			fetch(pageNumber)
+		}
+
+		stats := readAheadStats()
+		Expect(stats.Prefetched).To(BeZero())
+		Expect(stats.Hits).To(BeZero())
+		Expect(stats.Misses).To(Equal(len(leaves) - 1))
+	})
+
+	It("should not read ahead random fetches", func() {
+		newBufferPool(32, memory.WithReadAhead(depth))
+		for _, i := range []int{3, 7, 1, 12, 5, 9} {
+			fetch(leaves[i])
+		}
+
+		Consistently(readAheadStats).Should(HaveField("Prefetched", 0))
+	})
+
+	It("should not read ahead once closed while reading a leaf", func() {
+		blockingManager := &blockingDiskManager{
+			countingDiskManager: diskManager,
+			blocked:             leaves[2],
+			reading:             make(chan struct{}, 1),
+			release:             make(chan struct{}),
+		}
+		bufferPool = memory.NewBufferPool(32, blockingManager, memory.NewLRUKReplacer(2), memory.WithReadAhead(depth))
+		fetch(leaves[0])
+		fetch(leaves[1])
+
+		// The third leaf in a row would schedule a read-ahead once read.
+		fetched := make(chan error, 1)
+		go func() {
+			_, err := bufferPool.FetchPage(leaves[2], schema)
+			fetched <- err
+		}()
+		Eventually(blockingManager.reading).Should(Receive())
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- bufferPool.Close()
+		}()
+		Consistently(closed).ShouldNot(Receive())
+
+		close(blockingManager.release)
+		Eventually(fetched).Should(Receive(MatchError(memory.ErrBufferPoolClosed)))
+		Eventually(closed).Should(Receive(BeNil()))
+		Expect(readAheadStats().Prefetched).To(BeZero())
+	})
+
+	It("should only read ahead into free frames", func() {
+		const poolSize = 5
+		newBufferPool(poolSize, memory.WithReadAhead(depth))
+		for _, pageNumber := range leaves[:3] {
+			fetch(pageNumber)
+		}
+
+		// The two free frames are filled, and the leaves fetched before are not evicted for the read-ahead.
+		Eventually(readAheadStats).Should(HaveField("Prefetched", poolSize-3))
+		Consistently(readAheadStats).Should(HaveField("Prefetched", poolSize-3))
+		for _, pageNumber := range leaves[:3] {
+			fetch(pageNumber)
+			Expect(diskManager.readsOf(pageNumber)).To(Equal(1))
+		}
+	})
+})
@@ -15,3 +15,15 @@ type Replacer interface {
 	SetEvictable(pageNumber table.PageNumber, evictable bool)
 	Remove(pageNumber table.PageNumber) error
 }
+
+// OnceAccessor is implemented by the replacers telling apart the pages not going to be accessed again soon,
+// such as the pages of a scan, so that they do not push out the pages accessed often.
+type OnceAccessor interface {
+	AccessOnce(pageNumber table.PageNumber)
+}
+
+// ResizableReplacer is implemented by the replacers depending on the size of the buffer pool,
+// which is told to them when the buffer pool is resized.
+type ResizableReplacer interface {
+	Resize(capacity int)
+}
@@ -0,0 +1,252 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var ErrInvalidInstances = errors.New("invalid number of buffer pool instances")
+
+// extentShift groups the pages by extents of 64 pages,
+// the pages of an extent are in the same instance so that a scan mostly stays in an instance.
+const extentShift = 6
+
+// ShardedBufferPool splits the buffer pool into several instances, each with its own lock and replacer,
+// and chooses the instance of a page by a hash of its page number.
+//
+// The fetches of pages in different instances do not contend for the same lock,
+// like the buffer pool instances of InnoDB.
+//
+// See also: https://dev.mysql.com/doc/refman/8.0/en/innodb-multiple-buffer-pools.html
+type ShardedBufferPool struct {
+	mu          sync.Mutex
+	closed      bool
+	diskManager disk.Manager
+	instances   []*BufferPool
+	// dumpPath is the file the resident pages of every instance are dumped to when the buffer pool is closed.
+	dumpPath string
+}
+
+// sharedDiskManager is the disk manager shared by the instances, which is closed by the sharded buffer pool.
+type sharedDiskManager struct {
+	disk.Manager
+}
+
+func (m sharedDiskManager) Close() error {
+	return nil
+}
+
+// NewShardedBufferPool returns a buffer pool of poolSize pages split into instances,
+// each using a replacer of the policy.
+func NewShardedBufferPool(
+	instances int,
+	poolSize int,
+	diskManager disk.Manager,
+	policy Policy,
+	opts ...BufferPoolOption,
+) (*ShardedBufferPool, error) {
+	if instances < 1 || instances > poolSize {
+		return nil, fmt.Errorf("%w: %d instances of %d pages", ErrInvalidInstances, instances, poolSize)
+	}
+
+	m := &ShardedBufferPool{
+		diskManager: diskManager,
+		instances:   make([]*BufferPool, instances),
+	}
+	for i := range m.instances {
+		instanceSize := m.instanceSize(i, poolSize)
+		replacer, err := NewReplacer(policy, instanceSize)
+		if err != nil {
+			return nil, err
+		}
+		m.instances[i] = NewBufferPool(instanceSize, sharedDiskManager{diskManager}, replacer, opts...)
+	}
+
+	// The instances are dumped together instead of each to the same file.
+	m.dumpPath = m.instances[0].dumpPath
+	// A sequential scan goes on across the instances, and reads ahead into the instances holding the pages.
+	tracker := newSequentialTracker()
+	for _, instance := range m.instances {
+		instance.dumpPath = ""
+		instance.tracker = tracker
+		instance.ownerOf = m.instanceOf
+	}
+	return m, nil
+}
+
+func (m *ShardedBufferPool) ApplyNewPage(spaceID table.SpaceID, p table.Page) error {
+	return m.instanceOf(p.PageNumber()).ApplyNewPage(spaceID, p)
+}
+
+func (m *ShardedBufferPool) FetchPage(
+	pageNumber table.PageNumber,
+	s *table.Schema,
+	opts ...FetchOption,
+) (table.Page, error) {
+	return m.instanceOf(pageNumber).FetchPage(pageNumber, s, opts...)
+}
+
+func (m *ShardedBufferPool) FetchPageRead(
+	pageNumber table.PageNumber,
+	s *table.Schema,
+	opts ...FetchOption,
+) (*ReadPageGuard, error) {
+	return m.instanceOf(pageNumber).FetchPageRead(pageNumber, s, opts...)
+}
+
+func (m *ShardedBufferPool) FetchPageWrite(
+	pageNumber table.PageNumber,
+	s *table.Schema,
+	opts ...FetchOption,
+) (*WritePageGuard, error) {
+	return m.instanceOf(pageNumber).FetchPageWrite(pageNumber, s, opts...)
+}
+
+func (m *ShardedBufferPool) Unpin(pageNumber table.PageNumber, markDirty bool) {
+	m.instanceOf(pageNumber).Unpin(pageNumber, markDirty)
+}
+
+func (m *ShardedBufferPool) DeletePage(pageNumber table.PageNumber) error {
+	return m.instanceOf(pageNumber).DeletePage(pageNumber)
+}
+
+func (m *ShardedBufferPool) FlushPage(pageNumber table.PageNumber) error {
+	return m.instanceOf(pageNumber).FlushPage(pageNumber)
+}
+
+func (m *ShardedBufferPool) FlushAll() error {
+	for _, instance := range m.instances {
+		if err := instance.FlushAll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadAheadStats returns the read-ahead statistics summed over the instances.
+func (m *ShardedBufferPool) ReadAheadStats() ReadAheadStats {
+	var stats ReadAheadStats
+	for _, instance := range m.instances {
+		instanceStats := instance.ReadAheadStats()
+		stats.Prefetched += instanceStats.Prefetched
+		stats.Hits += instanceStats.Hits
+		stats.Misses += instanceStats.Misses
+	}
+	return stats
+}
+
+// PoolSize returns the number of frames of the instances.
+func (m *ShardedBufferPool) PoolSize() int {
+	poolSize := 0
+	for _, instance := range m.instances {
+		poolSize += instance.PoolSize()
+	}
+	return poolSize
+}
+
+// Resize grows or shrinks the buffer pool to poolSize frames split into its instances,
+// the instances are resized at the same time.
+func (m *ShardedBufferPool) Resize(poolSize int) error {
+	if poolSize < len(m.instances) {
+		return fmt.Errorf("%w: %d pages for %d instances", ErrInvalidPoolSize, poolSize, len(m.instances))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.instances))
+	for i, instance := range m.instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = instance.Resize(m.instanceSize(i, poolSize))
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Dump writes the pages resident in every instance as BufferPool.Dump does.
+func (m *ShardedBufferPool) Dump(w io.Writer) error {
+	return writeDump(w, m.residentPages())
+}
+
+// DumpFile dumps the pages resident in every instance to the file, replacing it at once.
+func (m *ShardedBufferPool) DumpFile(path string) error {
+	return dumpFile(path, m.residentPages())
+}
+
+// Warm loads the pages of the dump into the free frames of their instances in the background,
+// as BufferPool.Warm does.
+func (m *ShardedBufferPool) Warm(
+	entries []DumpEntry,
+	schemaOf func(table.SpaceID) *table.Schema,
+	opts ...WarmOption,
+) *Warmer {
+	return startWarmer(m, entries, schemaOf, opts)
+}
+
+func (m *ShardedBufferPool) warmPage(entry DumpEntry, s *table.Schema) (bool, error) {
+	return m.instanceOf(entry.PageNumber).warmPage(entry, s)
+}
+
+func (m *ShardedBufferPool) foregroundReads() int {
+	reads := 0
+	for _, instance := range m.instances {
+		reads += instance.foregroundReads()
+	}
+	return reads
+}
+
+// residentPages returns the pages in every instance, sorted by space ID and page number.
+func (m *ShardedBufferPool) residentPages() []DumpEntry {
+	var entries []DumpEntry
+	for _, instance := range m.instances {
+		instance.mu.RLock()
+		entries = append(entries, instance.residentPages()...)
+		instance.mu.RUnlock()
+	}
+	sortDump(entries)
+	return entries
+}
+
+// Close closes every instance, then the disk manager they share,
+// the resident pages are dumped first if WithDumpAtShutdown is set.
+func (m *ShardedBufferPool) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	var errs []error
+	if m.dumpPath != "" {
+		errs = append(errs, dumpFile(m.dumpPath, m.residentPages()))
+	}
+	for _, instance := range m.instances {
+		errs = append(errs, instance.Close())
+	}
+	errs = append(errs, m.diskManager.Close())
+	return errors.Join(errs...)
+}
+
+// instanceSize returns the number of frames of the i-th instance of a buffer pool of poolSize frames,
+// the frames left over are spread over the first instances.
+func (m *ShardedBufferPool) instanceSize(i int, poolSize int) int {
+	instanceSize := poolSize / len(m.instances)
+	if i < poolSize%len(m.instances) {
+		instanceSize++
+	}
+	return instanceSize
+}
+
+// instanceOf returns the instance holding the page.
+func (m *ShardedBufferPool) instanceOf(pageNumber table.PageNumber) *BufferPool {
+	// The Fibonacci hashing spreads the consecutive extents over the instances.
+	h := (uint64(pageNumber) >> extentShift) * 0x9E3779B97F4A7C15 //nolint:mnd // 2^64 divided by the golden ratio.
+	return m.instances[(h>>32)%uint64(len(m.instances))]
+}
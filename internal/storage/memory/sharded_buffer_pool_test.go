@@ -0,0 +1,165 @@
+package memory_test
+
+import (
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Sharded buffer pool", func() {
+	const instances = 4
+	const poolSize = 4 * instances
+
+	var diskManager *countingDiskManager
+	var bufferPool *memory.ShardedBufferPool
+	var schema *table.Schema
+
+	newPage := func(key int) table.PageNumber {
+		p := table.NewDataPage(true)
+		p.Append(table.NewRecordFromLiteral(key))
+		Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+		bufferPool.Unpin(p.PageNumber(), true)
+		return p.PageNumber()
+	}
+
+	keyOf := func(pageNumber table.PageNumber) any {
+		p, err := bufferPool.FetchPage(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		defer bufferPool.Unpin(pageNumber, false)
+		return p.(*table.DataPage).Get(0).GetKey().Val()
+	}
+
+	BeforeEach(func() {
+		var err error
+		diskManager = newCountingDiskManager()
+		bufferPool, err = memory.NewShardedBufferPool(instances, poolSize, diskManager, memory.LRUKPolicy)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(bufferPool.Close)
+		schema = table.NewSchema().WithField("id", field.NewInteger())
+	})
+
+	It("should refuse an invalid number of instances", func() {
+		for _, n := range []int{0, poolSize + 1} {
+			_, err := memory.NewShardedBufferPool(n, poolSize, diskManager, memory.LRUKPolicy)
+			Expect(err).To(MatchError(memory.ErrInvalidInstances))
+		}
+	})
+
+	It("should refuse an unknown replacement policy", func() {
+		_, err := memory.NewShardedBufferPool(instances, poolSize, diskManager, "fifo")
+		Expect(err).To(MatchError(memory.ErrUnknownPolicy))
+	})
+
+	It("should keep the pages of an extent in one instance and spread the extents", func() {
+		const extentSize = 64
+		used := make(map[int]bool)
+		for extent := 0; extent < 16; extent++ {
+			first := table.PageNumber(extent * extentSize)
+			for i := table.PageNumber(0); i < extentSize; i++ {
+				Expect(bufferPool.InstanceIndex(first + i)).To(Equal(bufferPool.InstanceIndex(first)))
+			}
+			used[bufferPool.InstanceIndex(first)] = true
+		}
+		Expect(used).To(HaveLen(instances))
+	})
+
+	It("should serve the pages evicted from their instance", func() {
+		pageNumbers := make([]table.PageNumber, 3*poolSize)
+		for i := range pageNumbers {
+			pageNumbers[i] = newPage(i)
+		}
+		for round := 0; round < 2; round++ {
+			for i, pageNumber := range pageNumbers {
+				Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+			}
+		}
+	})
+
+	It("should resize its instances", func() {
+		pageNumbers := make([]table.PageNumber, 3*poolSize)
+		for i := range pageNumbers {
+			pageNumbers[i] = newPage(i)
+		}
+
+		Expect(bufferPool.Resize(instances - 1)).To(MatchError(memory.ErrInvalidPoolSize))
+		for _, size := range []int{instances, 2*poolSize + 1} {
+			Expect(bufferPool.Resize(size)).To(Succeed())
+			Expect(bufferPool.PoolSize()).To(Equal(size))
+			for i, pageNumber := range pageNumbers {
+				Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+			}
+		}
+	})
+
+	It("should read ahead a sequential scan across the instances", func() {
+		const depth = 4
+		const leafCount = 3 * 64
+
+		// The leaves are linked like the leaf chain of a B+ tree, over several extents.
+		pages := make([]*table.DataPage, leafCount)
+		leaves := make([]table.PageNumber, leafCount)
+		used := make(map[int]bool)
+		for i := range pages {
+			pages[i] = table.NewDataPage(true)
+			pages[i].Append(table.NewRecordFromLiteral(i))
+			leaves[i] = pages[i].PageNumber()
+			used[bufferPool.InstanceIndex(leaves[i])] = true
+		}
+		Expect(len(used)).To(BeNumerically(">", 1))
+		for i, p := range pages {
+			if i < len(pages)-1 {
+				p.SetNext(leaves[i+1])
+			}
+			Expect(diskManager.WritePage(p.PageNumber(), p.Buffer())).To(Succeed())
+		}
+
+		var err error
+		bufferPool, err = memory.NewShardedBufferPool(instances, instances*leafCount, diskManager, memory.LRUKPolicy,
+			memory.WithReadAhead(depth))
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(bufferPool.Close)
+
+		// The read-ahead keeps going at the extent boundaries, into the instances holding the leaves.
+		for i, pageNumber := range leaves {
+			Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+			if i >= 2 {
+				Eventually(bufferPool.ReadAheadStats).Should(HaveField("Prefetched", min(i-2+depth, leafCount-3)))
+			}
+		}
+
+		stats := bufferPool.ReadAheadStats()
+		Expect(stats.Hits).To(Equal(leafCount - 3))
+		Expect(stats.Misses).To(Equal(2))
+		for _, pageNumber := range leaves {
+			Expect(diskManager.readsOf(pageNumber)).To(Equal(1))
+		}
+	})
+
+	It("should flush and sync every instance", func() {
+		pageNumbers := make([]table.PageNumber, instances)
+		for i := range pageNumbers {
+			// The pages are an extent apart to fall in several instances.
+			p := table.NewDataPage(true)
+			pageNumbers[i] = p.PageNumber()
+			for range 64 {
+				table.NewDataPage(true)
+			}
+			p.Append(table.NewRecordFromLiteral(i))
+			Expect(bufferPool.ApplyNewPage(0, p)).To(Succeed())
+			bufferPool.Unpin(p.PageNumber(), true)
+		}
+		Expect(bufferPool.FlushAll()).To(Succeed())
+		for _, pageNumber := range pageNumbers {
+			Expect(diskManager.writesOf(pageNumber)).To(BeNumerically(">=", 1))
+		}
+
+		Expect(bufferPool.Close()).To(Succeed())
+		Expect(diskManager.syncCount()).To(Equal(2 * instances))
+		Expect(bufferPool.Close()).To(Succeed())
+		_, err := bufferPool.FetchPage(pageNumbers[0], schema)
+		Expect(err).To(MatchError(memory.ErrBufferPoolClosed))
+	})
+})
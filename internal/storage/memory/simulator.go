@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var ErrUnknownPolicy = errors.New("unknown replacement policy")
+
+// Policy is the name of a page replacement policy.
+type Policy string
+
+const (
+	LRUKPolicy  Policy = "lru-k"
+	ClockPolicy Policy = "clock"
+	ARCPolicy   Policy = "arc"
+	// MidpointPolicy is the LRU with midpoint insertion of InnoDB with the default settings.
+	MidpointPolicy Policy = "midpoint"
+)
+
+// DefaultLRUK is the k of the LRU-k replacers made by NewReplacer.
+const DefaultLRUK = 2
+
+// NewReplacer returns a replacer of the policy for a buffer pool of poolSize pages.
+func NewReplacer(policy Policy, poolSize int) (Replacer, error) {
+	switch policy {
+	case LRUKPolicy:
+		return NewLRUKReplacer(DefaultLRUK), nil
+	case ClockPolicy:
+		return NewClockReplacer(), nil
+	case ARCPolicy:
+		return NewARCReplacer(poolSize), nil
+	case MidpointPolicy:
+		return NewMidpointReplacer(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPolicy, policy)
+	}
+}
+
+// SimulationResult is the outcome of replaying a page access trace against a replacement policy.
+type SimulationResult struct {
+	Policy   Policy
+	Accesses int
+	Hits     int
+}
+
+// HitRatio returns the fraction of the accesses finding their page in the buffer pool.
+func (r *SimulationResult) HitRatio() float64 {
+	if r.Accesses == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Accesses)
+}
+
+func (r *SimulationResult) String() string {
+	return fmt.Sprintf("%s: %d/%d hits (%.2f%%)", r.Policy, r.Hits, r.Accesses, 100*r.HitRatio())
+}
+
+// Simulate replays the page access trace against the policy for a buffer pool of poolSize pages.
+//
+// Each access pins and unpins the page as the buffer pool does,
+// evicting a page chosen by the replacer when the page is not in the buffer pool and the pool is full.
+func Simulate(policy Policy, poolSize int, trace []table.PageNumber) (*SimulationResult, error) {
+	replacer, err := NewReplacer(policy, poolSize)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SimulationResult{Policy: policy, Accesses: len(trace)}
+	resident := make(map[table.PageNumber]struct{}, poolSize)
+	for _, pageNumber := range trace {
+		if _, ok := resident[pageNumber]; ok {
+			result.Hits++
+		} else {
+			if len(resident) >= poolSize {
+				evicted, evictErr := replacer.Evict()
+				if evictErr != nil {
+					return nil, evictErr
+				}
+				if evictErr = replacer.Remove(evicted); evictErr != nil {
+					return nil, evictErr
+				}
+				delete(resident, evicted)
+			}
+			resident[pageNumber] = struct{}{}
+		}
+
+		replacer.Access(pageNumber)
+		replacer.SetEvictable(pageNumber, false)
+		replacer.SetEvictable(pageNumber, true)
+	}
+	return result, nil
+}
+
+// ReadTrace reads a page access trace holding a page number per line,
+// the blank lines and the lines starting with # are skipped.
+func ReadTrace(r io.Reader) ([]table.PageNumber, error) {
+	var trace []table.PageNumber
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		pageNumber, err := strconv.ParseUint(text, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		trace = append(trace, table.PageNumber(pageNumber))
+	}
+	return trace, scanner.Err()
+}
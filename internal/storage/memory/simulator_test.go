@@ -0,0 +1,84 @@
+package memory_test
+
+import (
+	"math/rand/v2"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Simulator", func() {
+	const poolSize = 64
+
+	policies := []memory.Policy{memory.LRUKPolicy, memory.ClockPolicy, memory.ARCPolicy}
+
+	simulate := func(trace []table.PageNumber) map[memory.Policy]float64 {
+		hitRatios := make(map[memory.Policy]float64, len(policies))
+		for _, policy := range policies {
+			result, err := memory.Simulate(policy, poolSize, trace)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Accesses).To(Equal(len(trace)))
+			AddReportEntry(result.String())
+			hitRatios[policy] = result.HitRatio()
+		}
+		return hitRatios
+	}
+
+	It("should hit every page of a working set fitting in the buffer pool", func() {
+		var trace []table.PageNumber
+		for round := 0; round < 10; round++ {
+			for pageNumber := table.PageNumber(1); pageNumber <= poolSize; pageNumber++ {
+				trace = append(trace, pageNumber)
+			}
+		}
+
+		for _, hitRatio := range simulate(trace) {
+			Expect(hitRatio).To(BeNumerically("~", 0.9, 1e-9))
+		}
+	})
+
+	It("should keep a hot set through scans", func() {
+		const hotSetSize = poolSize / 2
+		rng := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // The trace needs no secure randomness.
+
+		var trace []table.PageNumber
+		scanned := table.PageNumber(1000)
+		for round := 0; round < 50; round++ {
+			for i := 0; i < 4*hotSetSize; i++ {
+				trace = append(trace, table.PageNumber(1+rng.IntN(hotSetSize)))
+			}
+			for i := 0; i < 2*poolSize; i++ {
+				scanned++
+				trace = append(trace, scanned)
+			}
+		}
+
+		hitRatios := simulate(trace)
+		// At best the hot pages hit after the first round and the scanned pages never do.
+		Expect(hitRatios[memory.ARCPolicy]).To(BeNumerically(">", 0.45))
+		Expect(hitRatios[memory.LRUKPolicy]).To(BeNumerically(">", 0.45))
+		Expect(hitRatios[memory.ARCPolicy]).To(BeNumerically(">", hitRatios[memory.ClockPolicy]))
+	})
+
+	It("should reject an unknown policy", func() {
+		_, err := memory.Simulate("fifo", poolSize, nil)
+		Expect(err).To(MatchError(memory.ErrUnknownPolicy))
+	})
+
+	Describe("reading a trace", func() {
+		It("should read a page number per line", func() {
+			trace, err := memory.ReadTrace(strings.NewReader("# a scan\n1\n2\n\n 3 \n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(trace).To(Equal([]table.PageNumber{1, 2, 3}))
+		})
+
+		It("should report the malformed line", func() {
+			_, err := memory.ReadTrace(strings.NewReader("1\npage\n"))
+			Expect(err).To(MatchError(ContainSubstring("line 2")))
+		})
+	})
+})
@@ -0,0 +1,191 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+const (
+	// DefaultWarmRate is the default number of pages a warmup loads per second, the default I/O capacity of InnoDB.
+	DefaultWarmRate = 200
+	// DefaultWarmLoadLimit is the default number of pages per second the fetches read from disk
+	// beyond which a warmup stops.
+	DefaultWarmLoadLimit = 100
+)
+
+// warmWindow is the period over which the pages read by the fetches are counted.
+const warmWindow = 100 * time.Millisecond
+
+// WarmStats tells how a warmup went.
+type WarmStats struct {
+	// Loaded is the number of pages read from disk.
+	Loaded int
+	// Skipped is the number of pages not read, because they were already resident, gone from disk,
+	// of a space without schema, or the buffer pool had no free frame.
+	Skipped int
+	// Stopped is true if the warmup stopped before the end of the dump,
+	// because the fetches read too many pages, it was stopped, or the buffer pool was closed.
+	Stopped bool
+}
+
+type WarmOption func(*warmOptions)
+
+type warmOptions struct {
+	rate      int
+	loadLimit int
+}
+
+// WithWarmRate sets the number of pages a warmup loads per second, 0 loads them as fast as possible.
+func WithWarmRate(pagesPerSecond int) WarmOption {
+	return func(o *warmOptions) {
+		o.rate = max(pagesPerSecond, 0)
+	}
+}
+
+// WithWarmLoadLimit sets the number of pages per second the fetches read from disk beyond which a warmup stops,
+// 0 never stops it.
+func WithWarmLoadLimit(pagesPerSecond int) WarmOption {
+	return func(o *warmOptions) {
+		o.loadLimit = max(pagesPerSecond, 0)
+	}
+}
+
+// warmTarget is a buffer pool a warmup loads pages into.
+type warmTarget interface {
+	// warmPage reads the page into a free frame if it is not resident, and returns whether it was read.
+	warmPage(entry DumpEntry, s *table.Schema) (bool, error)
+	// foregroundReads returns the number of pages read from disk by the fetches.
+	foregroundReads() int
+}
+
+// Warmer loads the pages of a dump back into a buffer pool in the background, such as after a restart.
+//
+// The pages are only loaded into the free frames at the warm rate,
+// and the warmup stops once the fetches read more pages per second than the load limit,
+// so that it does not get in the way of the foreground load.
+type Warmer struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	stats    WarmStats
+}
+
+// Warm loads the pages of the dump into the free frames of the buffer pool in the background,
+// schemaOf tells the schema of the pages of a space, the pages of the spaces without one are skipped.
+func (m *BufferPool) Warm(
+	entries []DumpEntry,
+	schemaOf func(table.SpaceID) *table.Schema,
+	opts ...WarmOption,
+) *Warmer {
+	return startWarmer(m, entries, schemaOf, opts)
+}
+
+func (m *BufferPool) warmPage(entry DumpEntry, s *table.Schema) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, loaded, err := m.loadFree(entry.PageNumber, s)
+	return loaded, err
+}
+
+func (m *BufferPool) foregroundReads() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.diskReads
+}
+
+func startWarmer(
+	target warmTarget,
+	entries []DumpEntry,
+	schemaOf func(table.SpaceID) *table.Schema,
+	opts []WarmOption,
+) *Warmer {
+	options := &warmOptions{rate: DefaultWarmRate, loadLimit: DefaultWarmLoadLimit}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	w := &Warmer{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	// The reads of the fetches are counted from now on, not from when the warmup gets to run.
+	go w.run(target, entries, schemaOf, options, target.foregroundReads())
+	return w
+}
+
+// Stop stops the warmup and waits for it to return.
+func (w *Warmer) Stop() WarmStats {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	return w.Wait()
+}
+
+// Wait waits for the warmup to load the whole dump or to stop.
+func (w *Warmer) Wait() WarmStats {
+	<-w.done
+	return w.stats
+}
+
+func (w *Warmer) run(
+	target warmTarget,
+	entries []DumpEntry,
+	schemaOf func(table.SpaceID) *table.Schema,
+	options *warmOptions,
+	windowReads int,
+) {
+	defer close(w.done)
+
+	var interval time.Duration
+	if options.rate > 0 {
+		interval = time.Second / time.Duration(options.rate)
+	}
+	windowStart := time.Now()
+	for _, entry := range entries {
+		select {
+		case <-w.stop:
+			w.stats.Stopped = true
+			return
+		default:
+		}
+
+		if elapsed := time.Since(windowStart); options.loadLimit > 0 && elapsed >= warmWindow {
+			reads := target.foregroundReads()
+			if float64(reads-windowReads) > float64(options.loadLimit)*elapsed.Seconds() {
+				w.stats.Stopped = true
+				return
+			}
+			windowStart, windowReads = time.Now(), reads
+		}
+
+		s := schemaOf(entry.SpaceID)
+		if s == nil {
+			w.stats.Skipped++
+			continue
+		}
+		loaded, err := target.warmPage(entry, s)
+		if errors.Is(err, ErrBufferPoolClosed) {
+			w.stats.Stopped = true
+			return
+		}
+		if !loaded {
+			w.stats.Skipped++
+			continue
+		}
+		w.stats.Loaded++
+
+		if interval > 0 {
+			select {
+			case <-w.stop:
+				w.stats.Stopped = true
+				return
+			case <-time.After(interval):
+			}
+		}
+	}
+}
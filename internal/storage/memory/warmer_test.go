@@ -0,0 +1,156 @@
+package memory_test
+
+import (
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/internal/field"
+	"github.com/Huangkai1008/libradb/internal/storage/disk"
+	"github.com/Huangkai1008/libradb/internal/storage/memory"
+	"github.com/Huangkai1008/libradb/internal/storage/table"
+)
+
+var _ = Describe("Warmer", func() {
+	const spaceID = table.SpaceID(1)
+
+	var diskManager *countingDiskManager
+	var bufferPool *memory.BufferPool
+	var schema *table.Schema
+
+	schemaOf := func(id table.SpaceID) *table.Schema {
+		if id == spaceID {
+			return schema
+		}
+		return nil
+	}
+
+	newBufferPool := func(poolSize int) {
+		bufferPool = memory.NewBufferPool(poolSize, diskManager, memory.NewLRUKReplacer(2))
+		DeferCleanup(bufferPool.Close)
+	}
+
+	keyOf := func(pageNumber table.PageNumber) any {
+		p, err := bufferPool.FetchPage(pageNumber, schema)
+		Expect(err).ToNot(HaveOccurred())
+		defer bufferPool.Unpin(pageNumber, false)
+		return p.(*table.DataPage).Get(0).GetKey().Val()
+	}
+
+	// dumpOf writes n pages holding their index to disk, and returns the dump listing them in the space.
+	dumpOf := func(n int) []memory.DumpEntry {
+		entries := make([]memory.DumpEntry, n)
+		for i := range entries {
+			p := table.NewDataPage(true)
+			p.Append(table.NewRecordFromLiteral(i))
+			Expect(diskManager.WritePage(p.PageNumber(), p.Buffer())).To(Succeed())
+			entries[i] = memory.DumpEntry{SpaceID: spaceID, PageNumber: p.PageNumber()}
+		}
+		return entries
+	}
+
+	BeforeEach(func() {
+		diskManager = newCountingDiskManager()
+		schema = table.NewSchema().WithField("id", field.NewInteger())
+	})
+
+	It("should load the pages dumped before a restart", func() {
+		const pages = 16
+		dir := GinkgoT().TempDir()
+		path := filepath.Join(dir, "buffer_pool.dump")
+
+		spaceManager, err := disk.NewSpaceManager(dir)
+		Expect(err).ToNot(HaveOccurred())
+		before := memory.NewBufferPool(pages, spaceManager, memory.NewLRUKReplacer(2), memory.WithDumpAtShutdown(path))
+		pageNumbers := make([]table.PageNumber, pages)
+		for i := range pageNumbers {
+			p := table.NewDataPage(true)
+			p.Append(table.NewRecordFromLiteral(i))
+			Expect(before.ApplyNewPage(spaceID, p)).To(Succeed())
+			before.Unpin(p.PageNumber(), true)
+			pageNumbers[i] = p.PageNumber()
+		}
+		Expect(before.Close()).To(Succeed())
+
+		spaceManager, err = disk.NewSpaceManager(dir)
+		Expect(err).ToNot(HaveOccurred())
+		diskManager = newCountingDiskManagerOf(spaceManager)
+		newBufferPool(2 * pages)
+		entries, err := memory.ReadDumpFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bufferPool.Warm(entries, schemaOf, memory.WithWarmRate(0)).Wait()).
+			To(Equal(memory.WarmStats{Loaded: pages}))
+
+		for i, pageNumber := range pageNumbers {
+			Expect(keyOf(pageNumber)).To(Equal(int32(i)))
+			Expect(diskManager.readsOf(pageNumber)).To(Equal(1))
+		}
+	})
+
+	It("should skip the pages of unknown spaces and not evict pages to load", func() {
+		const poolSize = 4
+		newBufferPool(poolSize)
+		entries := dumpOf(2 * poolSize)
+		entries[0].SpaceID = spaceID + 1
+
+		stats := bufferPool.Warm(entries, schemaOf, memory.WithWarmRate(0)).Wait()
+		Expect(stats).To(Equal(memory.WarmStats{Loaded: poolSize, Skipped: poolSize}))
+		for _, entry := range entries[1 : poolSize+1] {
+			Expect(diskManager.readsOf(entry.PageNumber)).To(Equal(1))
+		}
+		for _, entry := range append(entries[:1], entries[poolSize+1:]...) {
+			Expect(diskManager.readsOf(entry.PageNumber)).To(BeZero())
+		}
+	})
+
+	It("should load the pages at the warm rate until stopped", func() {
+		newBufferPool(32)
+		warmer := bufferPool.Warm(dumpOf(32), schemaOf, memory.WithWarmRate(10))
+
+		time.Sleep(150 * time.Millisecond)
+		stats := warmer.Stop()
+		Expect(stats.Stopped).To(BeTrue())
+		Expect(stats.Loaded).To(BeNumerically("~", 2, 1))
+		Expect(warmer.Stop()).To(Equal(stats))
+	})
+
+	It("should stop once the fetches read too many pages", func() {
+		const pages = 32
+		newBufferPool(2 * pages)
+		entries, foreground := dumpOf(pages), dumpOf(pages)
+		warmer := bufferPool.Warm(entries, schemaOf, memory.WithWarmRate(pages), memory.WithWarmLoadLimit(pages))
+
+		for i, entry := range foreground {
+			Expect(keyOf(entry.PageNumber)).To(Equal(int32(i)))
+		}
+		stats := warmer.Wait()
+		Expect(stats.Stopped).To(BeTrue())
+		Expect(stats.Loaded).To(BeNumerically("<", pages))
+	})
+
+	It("should stop when the buffer pool is closed", func() {
+		newBufferPool(32)
+		Expect(bufferPool.Close()).To(Succeed())
+
+		Expect(bufferPool.Warm(dumpOf(4), schemaOf).Wait()).To(Equal(memory.WarmStats{Stopped: true}))
+	})
+
+	It("should load the pages into the instances of a sharded buffer pool", func() {
+		const instances = 4
+		sharded, err := memory.NewShardedBufferPool(instances, 64, diskManager, memory.LRUKPolicy)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(sharded.Close)
+
+		entries := dumpOf(16)
+		Expect(sharded.Warm(entries, schemaOf, memory.WithWarmRate(0)).Wait()).
+			To(Equal(memory.WarmStats{Loaded: len(entries)}))
+		for _, entry := range entries {
+			_, err = sharded.FetchPage(entry.PageNumber, schema)
+			Expect(err).ToNot(HaveOccurred())
+			sharded.Unpin(entry.PageNumber, false)
+			Expect(diskManager.readsOf(entry.PageNumber)).To(Equal(1))
+		}
+	})
+})
@@ -1,6 +1,7 @@
 package table
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"strings"
@@ -18,6 +19,11 @@ const (
 	SupremumHeaderSize     = 5
 )
 
+// MaxRecordByteSize is the largest record a data page takes,
+// which is half the room for records so that a page always holds at least two of them.
+const MaxRecordByteSize = (config.PageSize - FileHeaderByteSize - DataPageHeaderByteSize -
+	directoryByteSize - FileTrailerByteSize) / 2
+
 // DataPage is the page that stores data.
 // DatePage implements by the heap file.
 type DataPage struct {
@@ -51,6 +57,18 @@ func (p *DataPage) Buffer() []byte {
 	return p.ToBytes()
 }
 
+func (p *DataPage) SpaceID() SpaceID {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.fileHeader.spaceID
+}
+
+func (p *DataPage) SetSpaceID(spaceID SpaceID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fileHeader.spaceID = spaceID
+}
+
 func (p *DataPage) IsLeaf() bool {
 	return p.pageHeader.isLeaf
 }
@@ -91,7 +109,7 @@ func (p *DataPage) Insert(index uint16, record *Record) {
 	defer p.mu.Unlock()
 
 	p.infimumRecord.Insert(int(index), record)
-	p.pageHeader.recordCount++
+	p.added(record)
 }
 
 func (p *DataPage) Append(record *Record) {
@@ -99,7 +117,22 @@ func (p *DataPage) Append(record *Record) {
 	defer p.mu.Unlock()
 
 	p.infimumRecord.Append(record)
-	p.pageHeader.recordCount++
+	p.added(record)
+}
+
+// Replace the record with given index and returns the replaced record.
+func (p *DataPage) Replace(index uint16, record *Record) *Record {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	replaced := p.infimumRecord.Get(int(index))
+	p.infimumRecord.Set(int(index), record)
+	p.pageHeader.recordByteSize += record.ByteSize() - replaced.ByteSize()
+	// A key taking the place of another may share more with the other keys.
+	if !bytes.Equal(keyBytesOf(record), keyBytesOf(replaced)) {
+		p.pageHeader.keyPrefixStale = true
+	}
+	return replaced
 }
 
 // Delete records with given index and returns the record.
@@ -109,6 +142,9 @@ func (p *DataPage) Delete(index uint16) *Record {
 
 	removed := p.infimumRecord.Remove(int(index))
 	p.pageHeader.recordCount--
+	p.pageHeader.recordByteSize -= removed.ByteSize()
+	// The other keys may share more without the removed one.
+	p.pageHeader.keyPrefixStale = true
 	return removed
 }
 
@@ -126,6 +162,51 @@ func (p *DataPage) Shrink(endIndex uint16) []*Record {
 	return records
 }
 
+// ByteSize returns the number of bytes the page takes,
+// the records no longer fit in the page if it exceeds the page size.
+//
+// It is kept in the page header as the records are inserted, replaced and removed,
+// only the key prefix is found again over the records after a removal.
+func (p *DataPage) ByteSize() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size := FileHeaderByteSize + DataPageHeaderByteSize + directoryByteSize + FileTrailerByteSize +
+		p.pageHeader.recordByteSize
+	if p.pageHeader.recordCount < 2 { //nolint:mnd // a single key shares nothing.
+		return size
+	}
+	// Each record leaves out the key prefix, which is stored once.
+	prefixLength := len(p.keyPrefix())
+	return size + prefixLength - int(p.pageHeader.recordCount)*prefixLength
+}
+
+// added counts the inserted record in the page header, along with its bytes and its share of the key prefix.
+func (p *DataPage) added(record *Record) {
+	h := p.pageHeader
+	h.recordCount++
+	h.recordByteSize += record.ByteSize()
+	switch {
+	case h.recordCount == 1:
+		h.keyPrefix, h.keyPrefixStale = keyBytesOf(record), false
+	case !h.keyPrefixStale:
+		key := keyBytesOf(record)
+		n := 0
+		for n < len(h.keyPrefix) && n < len(key) && h.keyPrefix[n] == key[n] {
+			n++
+		}
+		h.keyPrefix = h.keyPrefix[:n]
+	}
+}
+
+// keyPrefix returns the key prefix shared by the records, finding it again over the records if it is stale.
+func (p *DataPage) keyPrefix() []byte {
+	if p.pageHeader.keyPrefixStale {
+		p.pageHeader.keyPrefix, p.pageHeader.keyPrefixStale = keyPrefix(p.infimumRecord.Values()), false
+	}
+	return p.pageHeader.keyPrefix
+}
+
 func (p *DataPage) RecordCount() uint16 {
 	return p.pageHeader.recordCount
 }
@@ -155,6 +236,8 @@ func (p *DataPage) keys() []field.Value {
 // +-------------------+
 // | Page Header       |
 // +-------------------+
+// | Key Prefix        |
+// +-------------------+
 // | Infimum Record    |
 // +-------------------+
 // | Supremum Record   |
@@ -165,6 +248,9 @@ func (p *DataPage) keys() []field.Value {
 // +-------------------+
 // | File Trailer      |
 // +-------------------+ <- Page Size.
+//
+// The key prefix shared by all the records of the page is stored once,
+// and each record only stores the rest of its key.
 func (p *DataPage) ToBytes() []byte {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -175,13 +261,20 @@ func (p *DataPage) ToBytes() []byte {
 	copy(buf[offset:], p.fileHeader.toBytes())
 	offset += FileHeaderByteSize
 
+	records := p.infimumRecord.Values()
+	keyPrefix := keyPrefix(records)
+	if len(records) >= 2 { //nolint:mnd // a single key shares nothing.
+		p.pageHeader.keyPrefix, p.pageHeader.keyPrefixStale = keyPrefix, false
+	}
+	p.pageHeader.keyPrefixLength = uint16(len(keyPrefix))
 	copy(buf[offset:], p.pageHeader.toBytes())
 	offset += DataPageHeaderByteSize
 
-	recordCount := p.RecordCount()
-	for i := uint16(0); i < recordCount; i++ {
-		record := p.infimumRecord.Get(int(i))
-		recordBytes := record.toBytes()
+	copy(buf[offset:], keyPrefix)
+	offset += len(keyPrefix)
+
+	for _, record := range records {
+		recordBytes := record.toBytes(len(keyPrefix))
 		copy(buf[offset:], recordBytes)
 		offset += len(recordBytes)
 	}
@@ -207,13 +300,21 @@ func DataPageFromBytes(buf []byte, schema *Schema) *DataPage {
 	page.pageHeader = pageHeaderFromBytes(buf[offset:])
 	offset += DataPageHeaderByteSize
 
+	if !page.IsLeaf() {
+		schema = indexSchema
+	}
+
+	keyPrefix := buf[offset : offset+int(page.pageHeader.keyPrefixLength)]
+	offset += len(keyPrefix)
+
+	// The records are counted again as they are inserted.
 	recordCount := page.RecordCount()
+	page.pageHeader.recordCount = 0
 	for i := uint16(0); i < recordCount; i++ {
-		record, recordSize := recordFromBytes(buf[offset:], schema)
+		record, recordSize := recordFromBytes(buf[offset:], schema, keyPrefix)
 		page.Insert(i, record)
 		offset += recordSize
 	}
-	page.pageHeader.recordCount = recordCount
 
 	endOffset := config.PageSize - FileTrailerByteSize
 	page.directory = fromBytesDirectory(buf[endOffset-4 : endOffset])
@@ -223,6 +324,64 @@ func DataPageFromBytes(buf []byte, schema *Schema) *DataPage {
 	return page
 }
 
+// indexSchema is the schema of the records stored in a non-leaf page.
+// An index record is a pair of the encoded key and the child page number,
+// so non-leaf pages are read the same way whatever the key type is.
+//
+//nolint:gochecknoglobals // The schema is never modified.
+var indexSchema = NewSchema().
+	WithField("key", field.NewBinary()).
+	WithField("page_number", field.NewInteger())
+
+// keyPrefix returns the longest prefix shared by the variable-length keys of the records,
+// or nil if there are fewer than two records.
+func keyPrefix(records []*Record) []byte {
+	if len(records) < 2 { //nolint:mnd // a single key shares nothing.
+		return nil
+	}
+
+	var prefix []byte
+	for i, record := range records {
+		key := record.GetKey()
+		if field.IsNull(key) || !field.IsVarLen(key.Type()) {
+			return nil
+		}
+
+		keyBytes := key.ToBytes()
+		if i == 0 {
+			prefix = keyBytes
+			continue
+		}
+		n := 0
+		for n < len(prefix) && n < len(keyBytes) && prefix[n] == keyBytes[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+// keyBytesOf returns the bytes of the key of the record a key prefix is shared from,
+// which are none for a key of fixed length.
+func keyBytesOf(record *Record) []byte {
+	key := record.GetKey()
+	if field.IsNull(key) || !field.IsVarLen(key.Type()) {
+		return []byte{}
+	}
+	return key.ToBytes()
+}
+
+// DataPageByteSize returns the number of bytes a data page holding the records takes,
+// which must not exceed the page size.
+func DataPageByteSize(records []*Record) int {
+	prefix := keyPrefix(records)
+	size := FileHeaderByteSize + DataPageHeaderByteSize + len(prefix) + directoryByteSize + FileTrailerByteSize
+	for _, record := range records {
+		size += len(record.toBytes(len(prefix)))
+	}
+	return size
+}
+
 func (p *DataPage) String() string {
 	var buffer strings.Builder
 	buffer.WriteString("DataPage(")
@@ -238,6 +397,13 @@ type pageHeader struct {
 	isLeaf bool
 	// the number of records stored in the page.
 	recordCount uint16
+	// the length of the key prefix shared by the records.
+	keyPrefixLength uint16
+	// the number of bytes the records take without key prefix compression.
+	recordByteSize int
+	// the key prefix shared by the records, kept as they are inserted unless stale after a removal.
+	keyPrefix      []byte
+	keyPrefixStale bool
 }
 
 func (h *pageHeader) toBytes() []byte {
@@ -248,12 +414,14 @@ func (h *pageHeader) toBytes() []byte {
 		buf[0] = 0
 	}
 	binary.LittleEndian.PutUint16(buf[1:], h.recordCount)
+	binary.LittleEndian.PutUint16(buf[3:], h.keyPrefixLength)
 	return buf
 }
 
 func pageHeaderFromBytes(buf []byte) *pageHeader {
 	return &pageHeader{
-		isLeaf:      buf[0] == 1,
-		recordCount: binary.LittleEndian.Uint16(buf[1:]),
+		isLeaf:          buf[0] == 1,
+		recordCount:     binary.LittleEndian.Uint16(buf[1:]),
+		keyPrefixLength: binary.LittleEndian.Uint16(buf[3:]),
 	}
 }
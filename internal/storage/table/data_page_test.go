@@ -1,10 +1,13 @@
 package table_test
 
 import (
+	"bytes"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/Huangkai1008/libradb/internal/config"
 	"github.com/Huangkai1008/libradb/internal/field"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
 )
@@ -88,6 +91,90 @@ func TestDataPage_Shrink(t *testing.T) {
 	assert.EqualValues(t, 4, p.RecordCount())
 }
 
+func TestDataPage_Replace(t *testing.T) {
+	p := table.NewDataPage(true)
+	for i := 0; i < 3; i++ {
+		p.Append(table.NewRecordFromLiteral(i, "name"))
+	}
+
+	replaced := p.Replace(1, table.NewRecordFromLiteral(1, "new name"))
+
+	assert.True(t, replaced.Equal(table.NewRecordFromLiteral(1, "name")))
+	assert.True(t, p.Get(1).Equal(table.NewRecordFromLiteral(1, "new name")))
+	assert.EqualValues(t, 3, p.RecordCount())
+}
+
+func TestDataPage_ByteSize(t *testing.T) {
+	t.Run("should grow with the records", func(t *testing.T) {
+		p := table.NewDataPage(true)
+		empty := p.ByteSize()
+
+		record := table.NewRecordFromLiteral(1, "name")
+		p.Append(record)
+
+		assert.Equal(t, empty+record.ByteSize(), p.ByteSize())
+		assert.Equal(t, table.DataPageByteSize([]*table.Record{record}), p.ByteSize())
+	})
+
+	t.Run("should shrink with the shared key prefix", func(t *testing.T) {
+		records := []*table.Record{
+			table.NewRecordFromLiteral("https://example.com/1", 1),
+			table.NewRecordFromLiteral("https://example.com/2", 2),
+		}
+		uncompressed := table.DataPageByteSize(nil) + records[0].ByteSize() + records[1].ByteSize()
+
+		assert.Less(t, table.DataPageByteSize(records), uncompressed)
+	})
+
+	t.Run("should keep the byte size of the records as they change", func(t *testing.T) {
+		p := table.NewDataPage(true)
+		records := func() []*table.Record {
+			values := make([]*table.Record, p.RecordCount())
+			for i := range values {
+				values[i] = p.Get(uint16(i))
+			}
+			return values
+		}
+
+		p.Append(table.NewRecordFromLiteral("https://example.com/a/1", 1))
+		p.Append(table.NewRecordFromLiteral("https://example.com/a/2", 2))
+		assert.Equal(t, table.DataPageByteSize(records()), p.ByteSize())
+		p.Insert(0, table.NewRecordFromLiteral("https://example.com/", 0))
+		assert.Equal(t, table.DataPageByteSize(records()), p.ByteSize())
+		p.Replace(0, table.NewRecordFromLiteral("https://example.com/a/0", 0))
+		assert.Equal(t, table.DataPageByteSize(records()), p.ByteSize())
+		p.Replace(1, table.NewRecordFromLiteral("https://example.com/a/1", "a longer value"))
+		assert.Equal(t, table.DataPageByteSize(records()), p.ByteSize())
+		p.Insert(3, table.NewRecordFromLiteral("ftp://example.com/", 3))
+		assert.Equal(t, table.DataPageByteSize(records()), p.ByteSize())
+		p.Delete(3)
+		assert.Equal(t, table.DataPageByteSize(records()), p.ByteSize())
+		p.Shrink(1)
+		assert.Equal(t, table.DataPageByteSize(records()), p.ByteSize())
+		p.Delete(0)
+		assert.Equal(t, table.DataPageByteSize(nil), p.ByteSize())
+
+		for i := 0; i < 3; i++ {
+			p.Append(table.NewRecordFromLiteral(fmt.Sprintf("https://example.com/b/%d", i), i))
+		}
+		newP := table.DataPageFromBytes(p.Buffer(), table.NewSchema().
+			WithField("url", field.NewVarchar()).
+			WithField("id", field.NewInteger()))
+		assert.Equal(t, p.ByteSize(), newP.ByteSize())
+		assert.Equal(t, table.DataPageByteSize(records()), newP.ByteSize())
+	})
+
+	t.Run("should exceed the page size when the records do not fit", func(t *testing.T) {
+		p := table.NewDataPage(true)
+		for i := 0; p.ByteSize() <= config.PageSize; i++ {
+			p.Append(table.NewRecordFromLiteral(i, fmt.Sprintf("name-%d", i)))
+		}
+
+		assert.Greater(t, p.ByteSize(), config.PageSize)
+		assert.Less(t, table.MaxRecordByteSize, config.PageSize/2)
+	})
+}
+
 func TestDataPage_Buffer(t *testing.T) {
 	schema := table.NewSchema().
 		WithField("id", field.NewInteger()).
@@ -120,6 +207,23 @@ func TestDataPage_Buffer(t *testing.T) {
 		assert.Equal(t, buffer, newP.Buffer())
 	})
 
+	t.Run("with index records", func(t *testing.T) {
+		p := table.NewDataPage(false)
+		records := []*table.Record{
+			table.NewRecordFromLiteral([]byte{0x01, 0x80, 0x00, 0x00, 0x04}, 10),
+			table.NewRecordFromLiteral([]byte{0x01, 0x80, 0x00, 0x00, 0x09}, 11),
+		}
+		for _, record := range records {
+			p.Append(record)
+		}
+
+		buffer := p.Buffer()
+		newP := table.DataPageFromBytes(buffer, schema)
+		assert.False(t, newP.IsLeaf())
+		assert.True(t, newP.Get(1).Equal(records[1]))
+		assert.Equal(t, buffer, newP.Buffer())
+	})
+
 	p := table.NewDataPage(true)
 
 	buffer := p.Buffer()
@@ -127,3 +231,74 @@ func TestDataPage_Buffer(t *testing.T) {
 
 	assert.Equal(t, buffer, newP.Buffer())
 }
+
+func TestDataPage_KeyPrefixCompression(t *testing.T) {
+	schema := table.NewSchema().
+		WithField("url", field.NewVarchar()).
+		WithField("visits", field.NewInteger())
+	const prefix = "https://example.com/articles/"
+	prefixBytes := field.NewValue(field.NewVarchar(), prefix).ToBytes()
+
+	roundTrip := func(t *testing.T, p *table.DataPage, schema *table.Schema, records []*table.Record) []byte {
+		t.Helper()
+		for _, record := range records {
+			p.Append(record)
+		}
+
+		buffer := p.Buffer()
+		newP := table.DataPageFromBytes(buffer, schema)
+		assert.EqualValues(t, len(records), newP.RecordCount())
+		for i, record := range records {
+			assert.True(t, newP.Get(uint16(i)).Equal(record), "record %d", i)
+		}
+		assert.Equal(t, buffer, newP.Buffer())
+		return buffer
+	}
+
+	t.Run("should store the shared key prefix once", func(t *testing.T) {
+		var records []*table.Record
+		for i := 0; i < 10; i++ {
+			records = append(records, table.NewRecordFromLiteral(fmt.Sprintf("%s%d", prefix, i), i))
+		}
+
+		buffer := roundTrip(t, table.NewDataPage(true), schema, records)
+		assert.Equal(t, 1, bytes.Count(buffer, prefixBytes))
+	})
+
+	t.Run("should keep a key equal to the prefix", func(t *testing.T) {
+		records := []*table.Record{
+			table.NewRecordFromLiteral(prefix, 1),
+			table.NewRecordFromLiteral(prefix+"a", 2),
+			table.NewRecordFromLiteral(prefix+"ab", 3),
+		}
+
+		roundTrip(t, table.NewDataPage(true), schema, records)
+	})
+
+	t.Run("should keep keys sharing no prefix", func(t *testing.T) {
+		records := []*table.Record{
+			table.NewRecordFromLiteral("", 1),
+			table.NewRecordFromLiteral("a", 2),
+			table.NewRecordFromLiteral("b", 3),
+		}
+
+		roundTrip(t, table.NewDataPage(true), schema, records)
+	})
+
+	t.Run("should keep a single key", func(t *testing.T) {
+		buffer := roundTrip(t, table.NewDataPage(true), schema, []*table.Record{
+			table.NewRecordFromLiteral(prefix, 1),
+		})
+		assert.Equal(t, 1, bytes.Count(buffer, prefixBytes))
+	})
+
+	t.Run("should compress the keys of index records", func(t *testing.T) {
+		var records []*table.Record
+		for i := 0; i < 10; i++ {
+			records = append(records, table.NewRecordFromLiteral(append([]byte(prefix), byte(i)), i))
+		}
+
+		buffer := roundTrip(t, table.NewDataPage(false), schema, records)
+		assert.Equal(t, 1, bytes.Count(buffer, []byte(prefix)))
+	})
+}
@@ -28,9 +28,14 @@ const (
 	CurPageNumberEnvKey = "CUR_PAGE_NUMBER"
 )
 
+// PageNumberGenerator hands out the page numbers of the new pages,
+// the numbers of the deallocated pages first, the most recently released first.
 type PageNumberGenerator struct {
 	curPageNumber PageNumber
-	mu            sync.Mutex
+	// released are the released page numbers, the ones no longer in freed were reclaimed.
+	released []PageNumber
+	freed    map[PageNumber]struct{}
+	mu       sync.Mutex
 }
 
 func NewPageNumberGenerator() *PageNumberGenerator {
@@ -46,6 +51,7 @@ func NewPageNumberGenerator() *PageNumberGenerator {
 	// Initialize the generator with the determined page number
 	return &PageNumberGenerator{
 		curPageNumber: PageNumber(pageNumber),
+		freed:         make(map[PageNumber]struct{}),
 	}
 }
 
@@ -53,10 +59,48 @@ func (g *PageNumberGenerator) NextPageNumber() PageNumber {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	for len(g.released) > 0 {
+		pageNumber := g.released[len(g.released)-1]
+		g.released = g.released[:len(g.released)-1]
+		if _, ok := g.freed[pageNumber]; ok {
+			delete(g.freed, pageNumber)
+			return pageNumber
+		}
+	}
 	g.curPageNumber++
 	return g.curPageNumber
 }
 
+// Release the page number of a deallocated page, so that it is handed out again.
+func (g *PageNumberGenerator) Release(pageNumber PageNumber) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.freed[pageNumber]; ok || pageNumber == InvalidPageNumber {
+		return
+	}
+	g.freed[pageNumber] = struct{}{}
+	g.released = append(g.released, pageNumber)
+}
+
+// Reclaim the released page number of a page written again, so that it is not handed out any more.
+func (g *PageNumberGenerator) Reclaim(pageNumber PageNumber) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.freed, pageNumber)
+}
+
+// ReleasePageNumber releases the page number of a deallocated page, so that a new page takes it.
+func ReleasePageNumber(pageNumber PageNumber) {
+	newPageNumberGenerator().Release(pageNumber)
+}
+
+// ReclaimPageNumber reclaims the released page number of a page written again.
+func ReclaimPageNumber(pageNumber PageNumber) {
+	newPageNumberGenerator().Reclaim(pageNumber)
+}
+
 type pageOffset = uint16
 
 // Page represents a page in the storage.
@@ -65,6 +109,10 @@ type Page interface {
 	PageNumber() PageNumber
 	// Buffer returns the byte slice of the page.
 	Buffer() []byte
+	// SpaceID returns the ID of the table space the page belongs to.
+	SpaceID() SpaceID
+	// SetSpaceID sets the ID of the table space the page belongs to.
+	SetSpaceID(spaceID SpaceID)
 }
 
 func FromBytes(buf []byte, s *Schema) Page {
@@ -86,6 +134,9 @@ type fileHeader struct {
 	prevPageNumber PageNumber
 	// The nextPageNumber is the page number of the next page in the file.
 	nextPageNumber PageNumber
+	// The spaceID is the ID of the table space the page belongs to,
+	// so that the space of a page read from disk is known.
+	spaceID SpaceID
 }
 
 func newFileHeader(pageType Type) *fileHeader {
@@ -110,7 +161,10 @@ func (h *fileHeader) toBytes() []byte {
 	offset += 4
 	// The next 4 bytes are the nextPageNumber.
 	binary.LittleEndian.PutUint32(buf[offset:offset+4], uint32(h.nextPageNumber))
-	// The next 24 bytes are reserved for future use.
+	offset += 4
+	// The next 4 bytes are the spaceID.
+	binary.LittleEndian.PutUint32(buf[offset:offset+4], uint32(h.spaceID))
+	// The next 20 bytes are reserved for future use.
 	return buf
 }
 
@@ -131,11 +185,15 @@ func fileHeaderFromBytes(buf []byte) *fileHeader {
 	offset += 4
 	// The next 4 bytes are the nextPageNumber.
 	nextPageNumber := PageNumber(binary.LittleEndian.Uint32(buf[offset : offset+4]))
+	offset += 4
+	// The next 4 bytes are the spaceID.
+	spaceID := SpaceID(binary.LittleEndian.Uint32(buf[offset : offset+4]))
 	return &fileHeader{
 		pageNumber:     pageNumber,
 		pageType:       pageType,
 		prevPageNumber: prevPageNumber,
 		nextPageNumber: nextPageNumber,
+		spaceID:        spaceID,
 	}
 }
 
@@ -4,6 +4,9 @@ import (
 	"encoding/binary"
 )
 
+// directoryByteSize is the byte size of the directory of the infimum and supremum slots.
+const directoryByteSize = 2 * 2
+
 // We divide the normal records info groups, each group has a slot.
 // The pageOffset is the address offset of the last record in the group on the page.
 // slotOffsets sorted in ascending order.
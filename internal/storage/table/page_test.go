@@ -17,4 +17,35 @@ func TestPageFromBytes(t *testing.T) {
 		newP := table.FromBytes(contents, s)
 		assert.Equal(t, contents, newP.Buffer())
 	})
+
+	t.Run("should keep the space ID of the page", func(t *testing.T) {
+		p := table.NewDataPage(true)
+		p.SetSpaceID(7)
+
+		newP := table.FromBytes(p.Buffer(), table.NewSchema())
+		assert.Equal(t, table.SpaceID(7), newP.SpaceID())
+	})
+}
+
+func TestPageNumberGenerator(t *testing.T) {
+	t.Run("should hand out the released page numbers first", func(t *testing.T) {
+		g := table.NewPageNumberGenerator()
+		first, second, third := g.NextPageNumber(), g.NextPageNumber(), g.NextPageNumber()
+		g.Release(first)
+		g.Release(second)
+		g.Release(second)
+
+		assert.Equal(t, second, g.NextPageNumber())
+		assert.Equal(t, first, g.NextPageNumber())
+		assert.Equal(t, third+1, g.NextPageNumber())
+	})
+
+	t.Run("should not hand out the reclaimed page numbers", func(t *testing.T) {
+		g := table.NewPageNumberGenerator()
+		first, second := g.NextPageNumber(), g.NextPageNumber()
+		g.Release(first)
+		g.Reclaim(first)
+
+		assert.Equal(t, second+1, g.NextPageNumber())
+	})
 }
@@ -62,6 +62,8 @@ func NewRecordFromLiteral(values ...any) *Record {
 			record.values[i] = field.NewValue(field.NewFloat(), v)
 		case bool:
 			record.values[i] = field.NewValue(field.NewBoolean(), v)
+		case []byte:
+			record.values[i] = field.NewValue(field.NewBinary(), v)
 		default:
 			panic(fmt.Sprintf("unsupported type: %T", v))
 		}
@@ -98,36 +100,64 @@ func (r *Record) Concat(other *Record) *Record {
 	return NewRecord(append(r.values, other.values...)...)
 }
 
+// ByteSize returns the number of bytes the record takes in a page without key prefix compression.
+func (r *Record) ByteSize() int {
+	return len(r.toBytes(0))
+}
+
+// ToBytes converts the record to the byte slice it takes in a page without key prefix compression.
+func (r *Record) ToBytes() []byte {
+	return r.toBytes(0)
+}
+
+// RecordFromBytes returns the record of the schema the bytes start with, and its byte size.
+func RecordFromBytes(buf []byte, schema *Schema) (*Record, int) {
+	return recordFromBytes(buf, schema, nil)
+}
+
 func (r *Record) String() string {
 	return fmt.Sprintf("%v", r.values)
 }
 
-func (r *Record) toBytes() []byte {
+// toBytes converts the record to a byte slice,
+// leaving out the first keyPrefixLength bytes of a variable-length key,
+// which are stored once per page.
+func (r *Record) toBytes(keyPrefixLength int) []byte {
 	// Record header part toke fixed 5 bytes.
 	header := make([]byte, RecordHeaderByteSize)
 	if r.header.deleted {
 		header[0] = 1
 	}
 
+	valueBytes := make([][]byte, len(r.values))
+	for i, fieldValue := range r.values {
+		if field.IsNull(fieldValue) {
+			continue
+		}
+		valueBytes[i] = fieldValue.ToBytes()
+		if i == 0 && field.IsVarLen(fieldValue.Type()) {
+			valueBytes[i] = valueBytes[i][keyPrefixLength:]
+		}
+	}
+
 	// Store variable length field byte size.
-	for _, fieldValue := range r.values {
+	for i, fieldValue := range r.values {
 		if field.IsVarLen(fieldValue.Type()) {
-			header = binary.LittleEndian.AppendUint32(header, uint32(len(fieldValue.ToBytes())))
+			header = binary.LittleEndian.AppendUint32(header, uint32(len(valueBytes[i])))
 		}
 	}
 
 	buf := bytes.NewBuffer(header)
-	for _, fieldValue := range r.values {
-		if !field.IsNull(fieldValue) {
-			buf.Write(fieldValue.ToBytes())
-		}
+	for _, b := range valueBytes {
+		buf.Write(b)
 	}
 
 	return buf.Bytes()
 }
 
-// recordFromBytes returns a record from the given bytes and the offset.
-func recordFromBytes(buf []byte, schema *Schema) (*Record, int) {
+// recordFromBytes returns a record from the given bytes and the offset,
+// prepending the key prefix to a variable-length key.
+func recordFromBytes(buf []byte, schema *Schema, keyPrefix []byte) (*Record, int) {
 	offset := 0
 	header := &recordHeader{
 		deleted: buf[0] == 1,
@@ -147,7 +177,11 @@ func recordFromBytes(buf []byte, schema *Schema) (*Record, int) {
 	values := make([]field.Value, len(fieldTypes))
 	for i, fieldType := range fieldTypes {
 		if field.IsVarLen(fieldType) {
-			values[i], _ = field.FromBytes(fieldType, buf[offset:offset+int(varLenFieldSizes[i])])
+			valueBytes := buf[offset : offset+int(varLenFieldSizes[i])]
+			if i == 0 && len(keyPrefix) > 0 {
+				valueBytes = append(append([]byte{}, keyPrefix...), valueBytes...)
+			}
+			values[i], _ = field.FromBytes(fieldType, valueBytes)
 			offset += int(varLenFieldSizes[i])
 		} else {
 			byteSize := fieldTypes[i].ByteSize()
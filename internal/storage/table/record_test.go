@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/Huangkai1008/libradb/internal/field"
 	"github.com/Huangkai1008/libradb/internal/storage/table"
 )
 
@@ -139,3 +140,18 @@ func TestRecord_Concat(t *testing.T) {
 		})
 	}
 }
+
+func TestRecord_ToBytes(t *testing.T) {
+	schema := table.NewSchema().
+		WithField("id", field.NewInteger()).
+		WithField("name", field.NewVarchar()).
+		WithField("score", field.NewFloat())
+	record := table.NewRecordFromLiteral(1, "Hello", 1.5)
+
+	buf := record.ToBytes()
+	assert.Len(t, buf, record.ByteSize())
+
+	decoded, n := table.RecordFromBytes(append(buf, 0xFF), schema)
+	assert.True(t, record.Equal(decoded))
+	assert.Equal(t, len(buf), n)
+}
@@ -0,0 +1,544 @@
+package ds
+
+import (
+	"bytes"
+	"iter"
+	"sort"
+)
+
+type artKind uint8
+
+const (
+	artLeaf artKind = iota
+	artNode4
+	artNode16
+	artNode48
+	artNode256
+)
+
+const (
+	node4Capacity   = 4
+	node16Capacity  = 16
+	node48Capacity  = 48
+	node256Capacity = 256
+	// A node shrinks once it holds fewer children than the node a size down can,
+	// with some slack so that it does not grow and shrink back and forth.
+	node16MinSize  = 3
+	node48MinSize  = 12
+	node256MinSize = 37
+)
+
+// artNode is either a leaf holding a key and its value,
+// or an inner node of 4, 16, 48 or 256 children indexed by the next key byte.
+type artNode[V any] struct {
+	kind artKind
+
+	// prefix is the path compressed into the inner node,
+	// the bytes every key below shares after the byte leading to the node.
+	prefix []byte
+	// term is the leaf of the key ending right after the prefix, if any.
+	term *artNode[V]
+	// keys are the sorted bytes of the children of a node4 or node16,
+	// and map a byte to its child slot plus one in a node48.
+	keys     []byte
+	children []*artNode[V]
+	size     int
+
+	key   []byte
+	value V
+}
+
+// ART is an adaptive radix tree, an ordered map of byte string keys.
+//
+// Inner nodes grow from 4 to 16, 48 and 256 children as needed, and single-child paths are
+// compressed into the node prefixes, so the tree takes little memory and a lookup visits
+// at most one node per key byte, comparing no key but the one in the leaf.
+//
+// See V. Leis et al., The Adaptive Radix Tree: ARTful Indexing for Main-Memory Databases.
+// An ART is not safe for concurrent use.
+type ART[V any] struct {
+	root   *artNode[V]
+	length int
+}
+
+func NewART[V any]() *ART[V] {
+	return &ART[V]{}
+}
+
+// Len returns the number of keys.
+func (t *ART[V]) Len() int {
+	return t.length
+}
+
+// Get returns the value of the key, and false if the key is absent.
+func (t *ART[V]) Get(key []byte) (V, bool) {
+	n, depth := t.root, 0
+	for n != nil {
+		if n.kind == artLeaf {
+			if bytes.Equal(n.key, key) {
+				return n.value, true
+			}
+			break
+		}
+
+		if !bytes.HasPrefix(key[depth:], n.prefix) {
+			break
+		}
+		depth += len(n.prefix)
+		if depth == len(key) {
+			n = n.term
+			continue
+		}
+		n = n.child(key[depth])
+		depth++
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Put the value under the key, and returns true if it replaces the value of the key.
+// The tree keeps the key, which must not be modified afterwards.
+func (t *ART[V]) Put(key []byte, value V) bool {
+	replaced := put(&t.root, key, value, 0)
+	if !replaced {
+		t.length++
+	}
+	return replaced
+}
+
+// Delete the key, and returns false if the key is absent.
+func (t *ART[V]) Delete(key []byte) bool {
+	deleted := remove(&t.root, key, 0)
+	if deleted {
+		t.length--
+	}
+	return deleted
+}
+
+// All returns a sequence of all the key-value pairs in ascending key order.
+func (t *ART[V]) All() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		walk(t.root, yield)
+	}
+}
+
+// Prefix returns a sequence of the key-value pairs whose key starts with the prefix,
+// in ascending key order.
+func (t *ART[V]) Prefix(prefix []byte) iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		n, depth := t.root, 0
+		for n != nil {
+			if n.kind == artLeaf {
+				if bytes.HasPrefix(n.key, prefix) {
+					yield(n.key, n.value)
+				}
+				return
+			}
+
+			rest := prefix[depth:]
+			if len(rest) <= len(n.prefix) {
+				if bytes.HasPrefix(n.prefix, rest) {
+					walk(n, yield)
+				}
+				return
+			}
+			if !bytes.HasPrefix(rest, n.prefix) {
+				return
+			}
+			depth += len(n.prefix)
+			n = n.child(prefix[depth])
+			depth++
+		}
+	}
+}
+
+// Range returns a sequence of the key-value pairs whose key lies in [lo, hi),
+// in ascending key order. A nil lo or hi leaves the corresponding side of the range unbounded.
+func (t *ART[V]) Range(lo, hi []byte) iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		bounded := func(key []byte, value V) bool {
+			if hi != nil && bytes.Compare(key, hi) >= 0 {
+				return false
+			}
+			return yield(key, value)
+		}
+		if lo == nil {
+			walk(t.root, bounded)
+			return
+		}
+		seek(t.root, lo, 0, bounded)
+	}
+}
+
+// walk yields the key-value pairs of the subtree in ascending key order,
+// and returns false once yield does.
+func walk[V any](n *artNode[V], yield func([]byte, V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.kind == artLeaf {
+		return yield(n.key, n.value)
+	}
+
+	// A key ending at the node is a prefix of, so less than, the keys below it.
+	if !walk(n.term, yield) {
+		return false
+	}
+	for _, child := range n.sortedChildren() {
+		if !walk(child, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// seek yields the key-value pairs of the subtree not less than lo in ascending key order,
+// and returns false once yield does.
+func seek[V any](n *artNode[V], lo []byte, depth int, yield func([]byte, V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.kind == artLeaf {
+		if bytes.Compare(n.key, lo) >= 0 {
+			return yield(n.key, n.value)
+		}
+		return true
+	}
+
+	rest := lo[depth:]
+	switch c := bytes.Compare(n.prefix, rest[:min(len(n.prefix), len(rest))]); {
+	case c > 0:
+		return walk(n, yield)
+	case c < 0:
+		return true
+	}
+	if len(rest) <= len(n.prefix) {
+		return walk(n, yield)
+	}
+
+	// The key ending at the node is a proper prefix of lo, so it is less than lo.
+	depth += len(n.prefix)
+	b := lo[depth]
+	keys := n.sortedKeys()
+	for i, child := range n.sortedChildren() {
+		switch c := keys[i]; {
+		case c < b:
+			continue
+		case c == b:
+			if !seek(child, lo, depth+1, yield) {
+				return false
+			}
+		default:
+			if !walk(child, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func newLeaf[V any](key []byte, value V) *artNode[V] {
+	return &artNode[V]{kind: artLeaf, key: key, value: value}
+}
+
+func newNode4[V any](prefix []byte) *artNode[V] {
+	return &artNode[V]{
+		kind:     artNode4,
+		prefix:   prefix,
+		keys:     make([]byte, 0, node4Capacity),
+		children: make([]*artNode[V], 0, node4Capacity),
+	}
+}
+
+// put the value under the key in the subtree the ref points to, depth bytes of the key down,
+// and returns true if it replaces the value of the key.
+func put[V any](ref **artNode[V], key []byte, value V, depth int) bool {
+	n := *ref
+	if n == nil {
+		*ref = newLeaf(key, value)
+		return false
+	}
+
+	if n.kind == artLeaf {
+		if bytes.Equal(n.key, key) {
+			n.value = value
+			return true
+		}
+
+		// Split the leaf into a node4 holding both leaves.
+		p := commonPrefixLength(n.key[depth:], key[depth:])
+		inner := newNode4[V](bytes.Clone(key[depth : depth+p]))
+		inner.addLeaf(n, depth+p)
+		inner.addLeaf(newLeaf(key, value), depth+p)
+		*ref = inner
+		return false
+	}
+
+	p := commonPrefixLength(n.prefix, key[depth:])
+	if p < len(n.prefix) {
+		// Split the prefix of the node at the first differing byte.
+		inner := newNode4[V](n.prefix[:p:p])
+		inner.addChild(n.prefix[p], n)
+		n.prefix = n.prefix[p+1:]
+		inner.addLeaf(newLeaf(key, value), depth+p)
+		*ref = inner
+		return false
+	}
+
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.term != nil {
+			n.term.value = value
+			return true
+		}
+		n.term = newLeaf(key, value)
+		return false
+	}
+
+	if childRef := n.childRef(key[depth]); childRef != nil {
+		return put(childRef, key, value, depth+1)
+	}
+	if n.isFull() {
+		n.grow()
+	}
+	n.addChild(key[depth], newLeaf(key, value))
+	return false
+}
+
+// remove the key from the subtree the ref points to, depth bytes of the key down,
+// and returns false if the key is absent.
+func remove[V any](ref **artNode[V], key []byte, depth int) bool {
+	n := *ref
+	if n == nil {
+		return false
+	}
+	if n.kind == artLeaf {
+		if !bytes.Equal(n.key, key) {
+			return false
+		}
+		*ref = nil
+		return true
+	}
+
+	if !bytes.HasPrefix(key[depth:], n.prefix) {
+		return false
+	}
+	depth += len(n.prefix)
+	if depth == len(key) {
+		if n.term == nil {
+			return false
+		}
+		n.term = nil
+	} else {
+		childRef := n.childRef(key[depth])
+		if childRef == nil || !remove(childRef, key, depth+1) {
+			return false
+		}
+		if *childRef == nil {
+			n.removeChild(key[depth])
+		}
+	}
+
+	*ref = n.shrink()
+	return true
+}
+
+// addLeaf adds the leaf under the node, whose keys are depth bytes long up to the node.
+func (n *artNode[V]) addLeaf(leaf *artNode[V], depth int) {
+	if depth == len(leaf.key) {
+		n.term = leaf
+		return
+	}
+	n.addChild(leaf.key[depth], leaf)
+}
+
+func (n *artNode[V]) isFull() bool {
+	return n.size == cap(n.children) && n.kind != artNode256
+}
+
+// child returns the child of the byte, or nil.
+func (n *artNode[V]) child(b byte) *artNode[V] {
+	if ref := n.childRef(b); ref != nil {
+		return *ref
+	}
+	return nil
+}
+
+// childRef returns a reference to the child of the byte, or nil.
+func (n *artNode[V]) childRef(b byte) **artNode[V] {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := sort.Search(n.size, func(i int) bool { return n.keys[i] >= b })
+		if i < n.size && n.keys[i] == b {
+			return &n.children[i]
+		}
+	case artNode48:
+		if slot := n.keys[b]; slot > 0 {
+			return &n.children[slot-1]
+		}
+	case artNode256:
+		if n.children[b] != nil {
+			return &n.children[b]
+		}
+	case artLeaf:
+	}
+	return nil
+}
+
+// addChild adds the child of the byte, the node must not be full.
+func (n *artNode[V]) addChild(b byte, child *artNode[V]) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := sort.Search(n.size, func(i int) bool { return n.keys[i] >= b })
+		n.keys = append(n.keys, 0)
+		copy(n.keys[i+1:], n.keys[i:])
+		n.keys[i] = b
+		n.children = append(n.children, nil)
+		copy(n.children[i+1:], n.children[i:])
+		n.children[i] = child
+	case artNode48:
+		slot := 0
+		for n.children[slot] != nil {
+			slot++
+		}
+		n.children[slot] = child
+		n.keys[b] = byte(slot + 1)
+	case artNode256:
+		n.children[b] = child
+	case artLeaf:
+		panic("leaf has no children")
+	}
+	n.size++
+}
+
+func (n *artNode[V]) removeChild(b byte) {
+	switch n.kind {
+	case artNode4, artNode16:
+		i := sort.Search(n.size, func(i int) bool { return n.keys[i] >= b })
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		n.children = append(n.children[:i], n.children[i+1:]...)
+	case artNode48:
+		n.children[n.keys[b]-1] = nil
+		n.keys[b] = 0
+	case artNode256:
+		n.children[b] = nil
+	case artLeaf:
+		panic("leaf has no children")
+	}
+	n.size--
+}
+
+// grow the node to the next larger kind, keeping its children.
+func (n *artNode[V]) grow() {
+	keys, children := n.sortedKeys(), n.sortedChildren()
+	switch n.kind {
+	case artNode4:
+		n.kind = artNode16
+		n.keys = make([]byte, 0, node16Capacity)
+		n.children = make([]*artNode[V], 0, node16Capacity)
+	case artNode16:
+		n.kind = artNode48
+		n.keys = make([]byte, node256Capacity)
+		n.children = make([]*artNode[V], node48Capacity)
+	case artNode48:
+		n.kind = artNode256
+		n.keys = nil
+		n.children = make([]*artNode[V], node256Capacity)
+	case artNode256, artLeaf:
+		return
+	}
+	n.refill(keys, children)
+}
+
+// shrink returns the node shrunk to a smaller kind once it holds few children,
+// its only child merged with it, or its term leaf if it has no children.
+func (n *artNode[V]) shrink() *artNode[V] {
+	keys, children := n.sortedKeys(), n.sortedChildren()
+	switch {
+	case n.size == 0:
+		return n.term
+	case n.size == 1 && n.term == nil:
+		child := children[0]
+		if child.kind != artLeaf {
+			prefix := make([]byte, 0, len(n.prefix)+1+len(child.prefix))
+			prefix = append(append(append(prefix, n.prefix...), keys[0]), child.prefix...)
+			child.prefix = prefix
+		}
+		return child
+	case n.kind == artNode16 && n.size <= node16MinSize:
+		n.kind = artNode4
+	case n.kind == artNode48 && n.size <= node48MinSize:
+		n.kind = artNode16
+	case n.kind == artNode256 && n.size <= node256MinSize:
+		n.kind = artNode48
+	default:
+		return n
+	}
+
+	switch n.kind {
+	case artNode4:
+		n.keys = make([]byte, 0, node4Capacity)
+		n.children = make([]*artNode[V], 0, node4Capacity)
+	case artNode16:
+		n.keys = make([]byte, 0, node16Capacity)
+		n.children = make([]*artNode[V], 0, node16Capacity)
+	case artNode48:
+		n.keys = make([]byte, node256Capacity)
+		n.children = make([]*artNode[V], node48Capacity)
+	case artNode256, artLeaf:
+	}
+	n.refill(keys, children)
+	return n
+}
+
+func (n *artNode[V]) refill(keys []byte, children []*artNode[V]) {
+	n.size = 0
+	for i, b := range keys {
+		n.addChild(b, children[i])
+	}
+}
+
+// sortedKeys returns the bytes of the children in ascending order.
+func (n *artNode[V]) sortedKeys() []byte {
+	switch n.kind {
+	case artNode4, artNode16:
+		return bytes.Clone(n.keys)
+	case artNode48, artNode256:
+		keys := make([]byte, 0, n.size)
+		for b := 0; b < node256Capacity; b++ {
+			if n.child(byte(b)) != nil {
+				keys = append(keys, byte(b))
+			}
+		}
+		return keys
+	case artLeaf:
+	}
+	return nil
+}
+
+// sortedChildren returns the children in ascending order of their bytes.
+func (n *artNode[V]) sortedChildren() []*artNode[V] {
+	switch n.kind {
+	case artNode4, artNode16:
+		return n.children[:n.size:n.size]
+	case artNode48, artNode256:
+		children := make([]*artNode[V], 0, n.size)
+		for b := 0; b < node256Capacity; b++ {
+			if child := n.child(byte(b)); child != nil {
+				children = append(children, child)
+			}
+		}
+		return children
+	case artLeaf:
+	}
+	return nil
+}
+
+func commonPrefixLength(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
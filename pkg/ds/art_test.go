@@ -0,0 +1,145 @@
+package ds_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+var _ = Describe("ART", func() {
+	var tree *ds.ART[int]
+
+	keysOf := func(seq func(func([]byte, int) bool)) []string {
+		var keys []string
+		for key := range seq {
+			keys = append(keys, string(key))
+		}
+		return keys
+	}
+
+	BeforeEach(func() {
+		tree = ds.NewART[int]()
+	})
+
+	It("should be empty", func() {
+		Expect(tree.Len()).To(BeZero())
+		_, ok := tree.Get([]byte("a"))
+		Expect(ok).To(BeFalse())
+		Expect(tree.Delete([]byte("a"))).To(BeFalse())
+		Expect(keysOf(tree.All())).To(BeEmpty())
+	})
+
+	It("should keep keys that are prefixes of others", func() {
+		for i, key := range []string{"abc", "", "ab", "abcd", "a", "b"} {
+			Expect(tree.Put([]byte(key), i)).To(BeFalse())
+		}
+		Expect(tree.Put([]byte("ab"), 10)).To(BeTrue())
+
+		value, ok := tree.Get([]byte("ab"))
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal(10))
+		_, ok = tree.Get([]byte("abcde"))
+		Expect(ok).To(BeFalse())
+		Expect(keysOf(tree.All())).To(Equal([]string{"", "a", "ab", "abc", "abcd", "b"}))
+
+		Expect(tree.Delete([]byte("abc"))).To(BeTrue())
+		Expect(tree.Delete([]byte("abc"))).To(BeFalse())
+		Expect(keysOf(tree.All())).To(Equal([]string{"", "a", "ab", "abcd", "b"}))
+		Expect(tree.Len()).To(Equal(5))
+	})
+
+	It("should scan the keys of a prefix", func() {
+		for i, key := range []string{"apple", "app", "apply", "apt", "banana", "ap"} {
+			tree.Put([]byte(key), i)
+		}
+
+		Expect(keysOf(tree.Prefix([]byte("app")))).To(Equal([]string{"app", "apple", "apply"}))
+		Expect(keysOf(tree.Prefix([]byte("appl")))).To(Equal([]string{"apple", "apply"}))
+		Expect(keysOf(tree.Prefix([]byte("ap")))).To(Equal([]string{"ap", "app", "apple", "apply", "apt"}))
+		Expect(keysOf(tree.Prefix([]byte("b")))).To(Equal([]string{"banana"}))
+		Expect(keysOf(tree.Prefix([]byte("c")))).To(BeEmpty())
+		Expect(keysOf(tree.Prefix([]byte("applesauce")))).To(BeEmpty())
+		Expect(keysOf(tree.Prefix(nil))).To(HaveLen(6))
+	})
+
+	It("should match a sorted map through growing and shrinking nodes", func() {
+		const keyCount = 5000
+		model := make(map[string]int)
+		key := func() []byte {
+			// Two random bytes under a few shared prefixes fill every kind of node.
+			buf := make([]byte, 0, 8)
+			buf = append(buf, "xyz"[:rand.IntN(4)]...)
+			return binary.BigEndian.AppendUint16(buf, uint16(rand.IntN(1<<12)))
+		}
+
+		for i := 0; i < keyCount; i++ {
+			k := key()
+			_, present := model[string(k)]
+			Expect(tree.Put(k, i)).To(Equal(present))
+			model[string(k)] = i
+		}
+		for i := 0; i < keyCount; i++ {
+			k := key()
+			_, present := model[string(k)]
+			Expect(tree.Delete(k)).To(Equal(present))
+			delete(model, string(k))
+		}
+		Expect(tree.Len()).To(Equal(len(model)))
+
+		sorted := make([]string, 0, len(model))
+		for k, v := range model {
+			sorted = append(sorted, k)
+			value, ok := tree.Get([]byte(k))
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal(v))
+		}
+		slices.Sort(sorted)
+		Expect(keysOf(tree.All())).To(Equal(sorted))
+
+		for i := 0; i < 100; i++ {
+			lo, hi := key(), key()
+			if bytes.Compare(lo, hi) > 0 {
+				lo, hi = hi, lo
+			}
+			var expected []string
+			for _, k := range sorted {
+				if k >= string(lo) && k < string(hi) {
+					expected = append(expected, k)
+				}
+			}
+			Expect(keysOf(tree.Range(lo, hi))).To(Equal(expected), "range [%x, %x)", lo, hi)
+		}
+
+		for _, k := range sorted {
+			Expect(tree.Delete([]byte(k))).To(BeTrue())
+		}
+		Expect(tree.Len()).To(BeZero())
+		Expect(keysOf(tree.All())).To(BeEmpty())
+	})
+
+	It("should range over unbounded sides and stop early", func() {
+		for i, key := range strings.Split("a b c d e f", " ") {
+			tree.Put([]byte(key), i)
+		}
+
+		Expect(keysOf(tree.Range(nil, []byte("c")))).To(Equal([]string{"a", "b"}))
+		Expect(keysOf(tree.Range([]byte("bb"), nil))).To(Equal([]string{"c", "d", "e", "f"}))
+		Expect(keysOf(tree.Range([]byte("c"), []byte("c")))).To(BeEmpty())
+
+		var keys []string
+		for key := range tree.All() {
+			keys = append(keys, string(key))
+			if len(keys) == 2 {
+				break
+			}
+		}
+		Expect(keys).To(Equal([]string{"a", "b"}))
+	})
+})
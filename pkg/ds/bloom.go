@@ -0,0 +1,138 @@
+package ds
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+// ErrInvalidBloomFilter is returned when unmarshalling malformed Bloom filter bytes.
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter")
+
+// bloomHeaderByteSize is the byte size of bits length, hash count, count and capacity.
+const bloomHeaderByteSize = 8 + 4 + 8 + 8
+
+// BloomFilter is a set which may report false positives but never false negatives.
+//
+// The bit array and the number of hash functions are sized from the expected number of items
+// and the false-positive rate, the k hashes are derived from a 64-bit FNV-1a hash
+// by double hashing, see Kirsch and Mitzenmacher, Less Hashing, Same Performance.
+type BloomFilter struct {
+	bits []uint64
+	// m is the number of bits.
+	m uint64
+	// k is the number of hash functions.
+	k uint32
+	// count is the number of items added.
+	count uint64
+	// capacity is the number of items the filter is sized for.
+	capacity uint64
+}
+
+// NewBloomFilter creates a Bloom filter of capacity items at the false-positive rate fpRate.
+func NewBloomFilter(capacity int, fpRate float64) *BloomFilter {
+	capacity = max(capacity, 1)
+	fpRate = min(max(fpRate, math.SmallestNonzeroFloat64), 1)
+
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64) //nolint:mnd // at least a word of bits.
+	k := uint32(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	k = max(k, 1)
+
+	return &BloomFilter{
+		bits:     make([]uint64, (m+63)/64), //nolint:mnd // 64 bits a word.
+		m:        m,
+		k:        k,
+		capacity: uint64(capacity),
+	}
+}
+
+// Add the item to the filter.
+func (f *BloomFilter) Add(item []byte) {
+	h1, h2 := bloomHash(item)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// MayContain returns false if the item was never added, true if it probably was.
+func (f *BloomFilter) MayContain(item []byte) bool {
+	h1, h2 := bloomHash(item)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of items added.
+func (f *BloomFilter) Count() int {
+	return int(f.count)
+}
+
+// Capacity returns the number of items the filter is sized for,
+// adding more raises the false-positive rate above the one it is created with.
+func (f *BloomFilter) Capacity() int {
+	return int(f.capacity)
+}
+
+// MarshalBinary encodes the filter into bytes.
+func (f *BloomFilter) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, bloomHeaderByteSize+8*len(f.bits))
+	buf = binary.LittleEndian.AppendUint64(buf, f.m)
+	buf = binary.LittleEndian.AppendUint32(buf, f.k)
+	buf = binary.LittleEndian.AppendUint64(buf, f.count)
+	buf = binary.LittleEndian.AppendUint64(buf, f.capacity)
+	for _, word := range f.bits {
+		buf = binary.LittleEndian.AppendUint64(buf, word)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes the filter from the bytes MarshalBinary returns.
+func (f *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < bloomHeaderByteSize {
+		return ErrInvalidBloomFilter
+	}
+
+	m := binary.LittleEndian.Uint64(data[0:8])
+	k := binary.LittleEndian.Uint32(data[8:12])
+	words := data[bloomHeaderByteSize:]
+	if m == 0 || k == 0 || uint64(len(words)) != (m+63)/64*8 {
+		return ErrInvalidBloomFilter
+	}
+
+	f.m = m
+	f.k = k
+	f.count = binary.LittleEndian.Uint64(data[12:20])
+	f.capacity = binary.LittleEndian.Uint64(data[20:28])
+	f.bits = make([]uint64, len(words)/8) //nolint:mnd // 8 bytes a word.
+	for i := range f.bits {
+		f.bits[i] = binary.LittleEndian.Uint64(words[i*8:])
+	}
+	return nil
+}
+
+// bloomHash returns the two hashes the k hashes are derived from,
+// the second one is odd so that it never maps every hash onto the same bit.
+func bloomHash(item []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write(item)
+	h1 := h.Sum64()
+
+	h2 := splitMix64(h1)
+	return h1, h2 | 1
+}
+
+// splitMix64 returns the finalizer of SplitMix64 of x, which spreads every bit of x over the result.
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9 //nolint:mnd // SplitMix64 constant.
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb //nolint:mnd // SplitMix64 constant.
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,65 @@
+package ds_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+var _ = Describe("BloomFilter", func() {
+	const capacity = 10000
+
+	item := func(prefix string, i int) []byte {
+		return []byte(fmt.Sprintf("%s-%d", prefix, i))
+	}
+
+	It("should contain every item added", func() {
+		filter := ds.NewBloomFilter(capacity, 0.01)
+		for i := 0; i < capacity; i++ {
+			filter.Add(item("in", i))
+		}
+
+		Expect(filter.Count()).To(Equal(capacity))
+		for i := 0; i < capacity; i++ {
+			Expect(filter.MayContain(item("in", i))).To(BeTrue())
+		}
+	})
+
+	DescribeTable("should keep false positives near the rate",
+		func(fpRate float64) {
+			filter := ds.NewBloomFilter(capacity, fpRate)
+			for i := 0; i < capacity; i++ {
+				filter.Add(item("in", i))
+			}
+
+			falsePositives := 0
+			for i := 0; i < capacity; i++ {
+				if filter.MayContain(item("out", i)) {
+					falsePositives++
+				}
+			}
+			Expect(float64(falsePositives) / capacity).To(BeNumerically("<", 2*fpRate))
+		},
+		Entry("at 10%", 0.1),
+		Entry("at 1%", 0.01),
+		Entry("at 0.1%", 0.001),
+	)
+
+	It("should round trip through bytes", func() {
+		filter := ds.NewBloomFilter(100, 0.01)
+		for i := 0; i < 100; i++ {
+			filter.Add(item("in", i))
+		}
+
+		buf, err := filter.MarshalBinary()
+		Expect(err).ToNot(HaveOccurred())
+
+		decoded := &ds.BloomFilter{}
+		Expect(decoded.UnmarshalBinary(buf)).To(Succeed())
+		Expect(decoded).To(Equal(filter))
+		Expect(decoded.UnmarshalBinary(buf[:len(buf)-1])).To(MatchError(ds.ErrInvalidBloomFilter))
+	})
+})
@@ -13,6 +13,10 @@ type LinkedList[T comparable] interface {
 	Insert(index int, value T)
 	// Remove the element at the given index from the list and return it.
 	Remove(index int) T
+	// Set the element at the given index.
+	Set(index int, value T)
+	// Values returns all the elements in order.
+	Values() []T
 }
 
 type DoublyLinkedList[T comparable] struct {
@@ -47,3 +51,11 @@ func (d *DoublyLinkedList[T]) Remove(index int) T {
 	d.list.Remove(index)
 	return element
 }
+
+func (d *DoublyLinkedList[T]) Set(index int, value T) {
+	d.list.Set(index, value)
+}
+
+func (d *DoublyLinkedList[T]) Values() []T {
+	return d.list.Values()
+}
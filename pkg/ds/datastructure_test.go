@@ -30,6 +30,13 @@ var _ = Describe("LinkedList", func() {
 			linkedList.Insert(2, 99)
 		})
 
+		Specify("set item", func() {
+			linkedList.Set(2, 98)
+			Expect(linkedList.Get(2)).To(Equal(98))
+			Expect(linkedList.Values()[:4]).To(Equal([]int{0, 1, 98, 2}))
+			Expect(linkedList.Values()).To(HaveLen(linkedList.Size()))
+		})
+
 		It("can remove element", func() {
 			linkedList.Remove(8)
 			linkedList.Remove(18)
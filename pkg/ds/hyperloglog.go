@@ -0,0 +1,92 @@
+package ds
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// MinHyperLogLogPrecision and MaxHyperLogLogPrecision bound the precision of a HyperLogLog sketch.
+	MinHyperLogLogPrecision = 4
+	MaxHyperLogLogPrecision = 16
+)
+
+// HyperLogLog estimates the number of distinct items added to it in 2^precision bytes,
+// with a standard error of about 1.04 / sqrt(2^precision).
+//
+// Each item is hashed to 64 bits, the first precision bits pick a register,
+// which keeps the maximum position of the first set bit among the rest of the hashes.
+// See P. Flajolet et al., HyperLogLog: the analysis of a near-optimal cardinality estimation algorithm,
+// with the linear counting correction of small cardinalities by S. Heule et al., HyperLogLog in Practice.
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// NewHyperLogLog creates a HyperLogLog sketch of the precision,
+// clamped to [MinHyperLogLogPrecision, MaxHyperLogLogPrecision].
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	precision = min(max(precision, MinHyperLogLogPrecision), MaxHyperLogLogPrecision)
+	return &HyperLogLog{
+		precision: precision,
+		registers: make([]uint8, 1<<precision),
+	}
+}
+
+// Add the item to the sketch.
+func (s *HyperLogLog) Add(item []byte) {
+	h := fnv.New64a()
+	_, _ = h.Write(item)
+	hash := splitMix64(h.Sum64())
+
+	register := hash >> (64 - s.precision)
+	// The sentinel bit bounds the position when the rest of the hash is zero.
+	rest := hash<<s.precision | 1<<(s.precision-1)
+	s.registers[register] = max(s.registers[register], uint8(bits.LeadingZeros64(rest)+1))
+}
+
+// Estimate returns the estimated number of distinct items added.
+func (s *HyperLogLog) Estimate() int {
+	m := float64(len(s.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := hyperLogLogAlpha(len(s.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 { //nolint:mnd // the threshold of linear counting.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// Merge the items of the other sketch of the same precision into the sketch,
+// so that it estimates the number of distinct items added to either of them.
+func (s *HyperLogLog) Merge(other *HyperLogLog) {
+	if s.precision != other.precision {
+		panic("merging HyperLogLog sketches of different precisions")
+	}
+	for i, r := range other.registers {
+		s.registers[i] = max(s.registers[i], r)
+	}
+}
+
+// hyperLogLogAlpha returns the constant correcting the bias of the estimate of m registers.
+//
+//nolint:mnd // The constants are given by the paper.
+func hyperLogLogAlpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
@@ -0,0 +1,49 @@
+package ds_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+var _ = Describe("HyperLogLog", func() {
+	item := func(i int) []byte {
+		return []byte(fmt.Sprintf("item-%d", i))
+	}
+
+	It("should estimate nothing when empty", func() {
+		Expect(ds.NewHyperLogLog(12).Estimate()).To(BeZero())
+	})
+
+	DescribeTable("should estimate the distinct items within a few standard errors",
+		func(distinct int) {
+			sketch := ds.NewHyperLogLog(12)
+			for round := 0; round < 3; round++ {
+				for i := 0; i < distinct; i++ {
+					sketch.Add(item(i))
+				}
+			}
+
+			// The standard error is 1.04 / sqrt(4096), about 1.6%.
+			Expect(sketch.Estimate()).To(BeNumerically("~", distinct, float64(distinct)*0.05+1))
+		},
+		Entry("a few", 10),
+		Entry("linear counting", 1000),
+		Entry("many", 100000),
+	)
+
+	It("should merge sketches", func() {
+		a, b := ds.NewHyperLogLog(12), ds.NewHyperLogLog(12)
+		for i := 0; i < 20000; i++ {
+			a.Add(item(i))
+			b.Add(item(i + 10000))
+		}
+
+		a.Merge(b)
+		Expect(a.Estimate()).To(BeNumerically("~", 30000, 1500))
+		Expect(func() { a.Merge(ds.NewHyperLogLog(10)) }).To(Panic())
+	})
+})
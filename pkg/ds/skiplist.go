@@ -0,0 +1,126 @@
+package ds
+
+import (
+	"iter"
+	"math/rand/v2"
+)
+
+const (
+	// skipListMaxLevel bounds the levels of a skip list, enough for 4^12 items.
+	skipListMaxLevel = 12
+	// skipListBranching is the inverse of the probability a node is promoted a level up.
+	skipListBranching = 4
+)
+
+type skipNode[K, V any] struct {
+	key   K
+	value V
+	next  []*skipNode[K, V]
+}
+
+// SkipList is an ordered map keeping its keys in lists of decreasing sparsity,
+// so that searching, inserting and seeking take O(log n) expected time.
+//
+// See W. Pugh, Skip Lists: A Probabilistic Alternative to Balanced Trees.
+// A SkipList is not safe for concurrent use.
+type SkipList[K, V any] struct {
+	head    *skipNode[K, V]
+	level   int
+	length  int
+	compare func(a, b K) int
+	rand    *rand.Rand
+}
+
+// NewSkipList creates a skip list ordering the keys by compare.
+func NewSkipList[K, V any](compare func(a, b K) int) *SkipList[K, V] {
+	return &SkipList[K, V]{
+		head:    &skipNode[K, V]{next: make([]*skipNode[K, V], skipListMaxLevel)},
+		level:   1,
+		compare: compare,
+		rand:    rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())), //nolint:gosec // Levels need no crypto.
+	}
+}
+
+// Put the value under the key, and returns true if it replaces the value of the key.
+func (s *SkipList[K, V]) Put(key K, value V) bool {
+	var update [skipListMaxLevel]*skipNode[K, V]
+	node := s.head
+	for level := s.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && s.compare(node.next[level].key, key) < 0 {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+
+	if next := node.next[0]; next != nil && s.compare(next.key, key) == 0 {
+		next.value = value
+		return true
+	}
+
+	level := s.randomLevel()
+	for ; s.level < level; s.level++ {
+		update[s.level] = s.head
+	}
+	node = &skipNode[K, V]{key: key, value: value, next: make([]*skipNode[K, V], level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	s.length++
+	return false
+}
+
+// Get returns the value of the key, and false if the key is absent.
+func (s *SkipList[K, V]) Get(key K) (V, bool) {
+	if node := s.seek(key); node != nil && s.compare(node.key, key) == 0 {
+		return node.value, true
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Len returns the number of keys.
+func (s *SkipList[K, V]) Len() int {
+	return s.length
+}
+
+// All returns a sequence of all the key-value pairs in ascending key order.
+func (s *SkipList[K, V]) All() iter.Seq2[K, V] {
+	return s.from(s.head.next[0])
+}
+
+// Seek returns a sequence of the key-value pairs from the first key not less than key,
+// in ascending key order.
+func (s *SkipList[K, V]) Seek(key K) iter.Seq2[K, V] {
+	return s.from(s.seek(key))
+}
+
+func (s *SkipList[K, V]) from(node *skipNode[K, V]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for ; node != nil; node = node.next[0] {
+			if !yield(node.key, node.value) {
+				return
+			}
+		}
+	}
+}
+
+// seek returns the first node whose key is not less than key, or nil.
+func (s *SkipList[K, V]) seek(key K) *skipNode[K, V] {
+	node := s.head
+	for level := s.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && s.compare(node.next[level].key, key) < 0 {
+			node = node.next[level]
+		}
+	}
+	return node.next[0]
+}
+
+func (s *SkipList[K, V]) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && s.rand.IntN(skipListBranching) == 0 {
+		level++
+	}
+	return level
+}
@@ -0,0 +1,70 @@
+package ds_test
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"slices"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:revive  // ginkgo
+	. "github.com/onsi/gomega"    //nolint:revive  // ginkgo
+
+	"github.com/Huangkai1008/libradb/pkg/ds"
+)
+
+var _ = Describe("SkipList", func() {
+	var skipList *ds.SkipList[int, string]
+
+	BeforeEach(func() {
+		skipList = ds.NewSkipList[int, string](cmp.Compare[int])
+	})
+
+	It("should be empty", func() {
+		Expect(skipList.Len()).To(BeZero())
+		_, ok := skipList.Get(1)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should keep the keys sorted", func() {
+		keys := rand.Perm(1000)
+		for _, key := range keys {
+			Expect(skipList.Put(key, "v")).To(BeFalse())
+		}
+		Expect(skipList.Len()).To(Equal(1000))
+
+		var sorted []int
+		for key := range skipList.All() {
+			sorted = append(sorted, key)
+		}
+		Expect(slices.IsSorted(sorted)).To(BeTrue())
+		Expect(sorted).To(HaveLen(1000))
+	})
+
+	It("should replace the value of a key", func() {
+		Expect(skipList.Put(1, "a")).To(BeFalse())
+		Expect(skipList.Put(1, "b")).To(BeTrue())
+
+		value, ok := skipList.Get(1)
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("b"))
+		Expect(skipList.Len()).To(Equal(1))
+	})
+
+	It("should seek to the first key not less than the key", func() {
+		for key := 0; key < 100; key += 10 {
+			skipList.Put(key, "v")
+		}
+
+		var keys []int
+		for key := range skipList.Seek(35) {
+			keys = append(keys, key)
+			if len(keys) == 3 {
+				break
+			}
+		}
+		Expect(keys).To(Equal([]int{40, 50, 60}))
+
+		for range skipList.Seek(91) {
+			Fail("no key is not less than 91")
+		}
+	})
+})
@@ -1,11 +1,21 @@
 package typing
 
+import "io"
+
 type Comparable[T any] interface {
 	Compare(t T) int
 }
 
+// Iterator walks through a sequence of items.
+//
+// Next returns the zero value of T once the sequence is exhausted
+// or an error occurs, callers should check Err to tell them apart.
+// Close must be called to release the resources held by the iterator.
 type Iterator[T any] interface {
 	Next() T
+	// Err returns the first error encountered during the iteration.
+	Err() error
+	io.Closer
 }
 
 type BacktrackingIterator[T any] interface {